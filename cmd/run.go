@@ -4,38 +4,115 @@ Copyright © 2025 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
-	"sync"
+	"log"
+	"os"
 	"time"
 
 	"github.com/azaurus1/swarm/internal/drone"
+	"github.com/azaurus1/swarm/internal/multicast"
 	"github.com/azaurus1/swarm/internal/radio"
+	"github.com/azaurus1/swarm/internal/routing"
+	"github.com/azaurus1/swarm/internal/scenario"
+	"github.com/azaurus1/swarm/internal/sim"
 	"github.com/spf13/cobra"
 )
 
+var (
+	scenarioFile string
+	seed         int64
+	duration     time.Duration
+)
+
 // runCmd represents the run command
 var runCmd = &cobra.Command{
 	Use:   "run",
 	Short: "Run the simulation",
-	Run: func(cmd *cobra.Command, args []string) {
-		var wg sync.WaitGroup
-		var dataChannels []chan []byte
-		var radioChan chan []byte
-		var simDuration time.Duration
-		var lBound, rBound, tBound, bBound float64
-
-		lBound = 0
-		rBound = 550
-		bBound = 0
-		tBound = 550
-
-		drones := []drone.Drone{
-			{Id: "1", X: 1, Y: 50, VX: 0.1, VY: 0, TransmissionRange: 1, DataChan: make(chan []byte, 1024)},
-			{Id: "2", X: 2, Y: 50, VX: 0, VY: 0, TransmissionRange: 1, DataChan: make(chan []byte, 1024)},
-			{Id: "3", X: 3, Y: 50, VX: 0, VY: 0, TransmissionRange: 1, DataChan: make(chan []byte, 1024)},
-			{Id: "4", X: 4, Y: 50, VX: 0, VY: 0, TransmissionRange: 1, DataChan: make(chan []byte, 1024)},
-			{Id: "5", X: 5, Y: 50, VX: 0, VY: 0, TransmissionRange: 1, DataChan: make(chan []byte, 1024)},
-		}
-		r := radio.Radio{}
+	// scenario validation errors are already precise, the usage text only buries them
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sc := scenario.Default()
+		if scenarioFile != "" {
+			loaded, err := scenario.Load(scenarioFile)
+			if err != nil {
+				return err
+			}
+			sc = loaded
+		}
+
+		if cmd.Flags().Changed("seed") {
+			sc.Seed = seed
+		}
+		if cmd.Flags().Changed("duration") {
+			sc.Duration = duration
+		}
+
+		sched := sim.NewScheduler(sc.Seed)
+
+		// stamp log lines with virtual time so two runs of the same scenario
+		// and seed produce identical traces
+		log.SetFlags(0)
+		log.SetOutput(sched.LogWriter(os.Stderr))
+
+		log.Printf("Running scenario %q with %d drones for %s (seed %d)", sc.Name, len(sc.Drones), sc.Duration, sc.Seed)
+
+		drones := make([]drone.Drone, 0, len(sc.Drones))
+		for _, spec := range sc.Drones {
+			drones = append(drones, drone.Drone{
+				Id:                spec.ID,
+				X:                 spec.X,
+				Y:                 spec.Y,
+				VX:                spec.VX,
+				VY:                spec.VY,
+				TransmissionRange: spec.TransmissionRange,
+				Routing:           routingProtocol(sc, spec, sched),
+				PendingQueueLimit: sc.PendingQueueLimit,
+				Groups:            spec.Groups,
+				Multicast: multicast.Config{
+					AnnounceInterval: sc.Multicast.AnnounceInterval,
+					MemberTimeout:    sc.Multicast.MemberTimeout,
+					TTL:              sc.Multicast.TTL,
+					DupHoldTime:      sc.Multicast.DupHoldTime,
+				},
+			})
+		}
+		r := radio.Radio{
+			Model:           propagationModel(sc.Radio),
+			Sensitivity:     sc.Radio.SensitivityDBm,
+			Loss:            lossModel(sc.Radio),
+			ProcessingDelay: sc.Radio.ProcessingDelay,
+			Jitter:          sc.Radio.Jitter,
+			RetryLimit:      *sc.Radio.RetryLimit,
+		}
+
+		if sc.MAC != nil {
+			r.MAC = &radio.MAC{
+				Bitrate:     sc.MAC.BitrateBps,
+				HeaderBytes: sc.MAC.HeaderBytes,
+				SlotTime:    sc.MAC.SlotTime,
+				DIFS:        sc.MAC.DIFS,
+				CWMin:       sc.MAC.CWMin,
+				CWMax:       sc.MAC.CWMax,
+				QueueLimit:  sc.MAC.QueueLimit,
+			}
+		}
+
+		if sc.Radio.SINR != nil {
+			r.SINR = &radio.SINR{
+				Threshold:    sc.Radio.SINR.ThresholdDB,
+				NoiseFloor:   sc.Radio.SINR.NoiseFloorDBm,
+				CarrierSense: *sc.Radio.SINR.CarrierSenseDBm,
+			}
+		}
+
+		if r.Model != nil {
+			for i := range drones {
+				if sc.Radio.TxPowerDBm != nil {
+					drones[i].TxPower = *sc.Radio.TxPowerDBm
+				} else {
+					drones[i].TxPower = radio.CalibratedTxPower(r.Model, r.Sensitivity, drones[i].TransmissionRange)
+				}
+			}
+		}
 
 		droneMap := make(map[string]*drone.Drone)
 
@@ -45,47 +122,95 @@ var runCmd = &cobra.Command{
 
 		r.Drones = droneMap
 
-		wg.Add(1)
-		radioChan = make(chan []byte, 1024)
-
-		for _, d := range drones {
-			wg.Add(1)
-			dataChannels = append(dataChannels, d.DataChan)
+		// drones only ever send while handling an event, the radio drains
+		// this after every event
+		radioQueue := sim.NewQueue()
 
-			go d.Start(&wg, radioChan)
+		for i := range drones {
+			drones[i].Start(sched, radioQueue)
 		}
 
-		go r.Serve(&wg, radioChan)
+		r.Serve(sched, radioQueue)
 
-		// simulate time passing
-		simDuration = 100 * time.Millisecond
-		simTicker := time.NewTicker(simDuration)
-		done := make(chan bool)
-
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for {
-				select {
-				case <-done:
-					return
-				case <-simTicker.C:
-					// loop drones, update locations
-					for _, drone := range r.Drones {
-						drone.UpdateLocation(simDuration, lBound, rBound, tBound, bBound)
-					}
+		for _, t := range sc.Traffic {
+			src := droneMap[t.From]
+			t := t
+
+			sched.At(t.At, func() {
+				switch t.Type {
+				case scenario.TrafficRREQ:
+					src.SendRREQ(t.To)
+				case scenario.TrafficData:
+					src.SendData(t.To, []byte(t.Data))
+				case scenario.TrafficControl:
+					src.SendCommand(t.To, t.Command, t.Params)
+				case scenario.TrafficJoin:
+					src.JoinGroup(t.Group)
+				case scenario.TrafficLeave:
+					src.LeaveGroup(t.Group)
+				case scenario.TrafficMulticast:
+					src.SendMulticast(t.Group, []byte(t.Data))
 				}
+			})
+		}
+
+		// simulate time passing
+		sched.Every(sc.Tick, sc.Tick, func() {
+			// loop drones, update locations
+			for i := range drones {
+				drones[i].UpdateLocation(sc.Tick, sc.Arena.Left, sc.Arena.Right, sc.Arena.Top, sc.Arena.Bottom)
 			}
-		}()
+		})
+
+		sched.Run(sc.Duration)
 
-		// for _, c := range dataChannels {
-		// 	c <- "testing"
-		// }
+		log.Printf("Simulation finished: %s", r.Stats)
 
-		wg.Wait()
+		return nil
 	},
 }
 
+// propagationModel builds the radio's propagation model, nil keeps the disk model
+func propagationModel(spec scenario.RadioSpec) radio.PropagationModel {
+	var model radio.PropagationModel
+
+	switch spec.Model {
+	case scenario.ModelFreeSpace:
+		model = radio.NewFreeSpace(spec.FrequencyHz)
+	case scenario.ModelLogDistance:
+		model = radio.NewLogDistance(spec.FrequencyHz, spec.ReferenceDistance, spec.PathLossExponent, spec.ShadowingSigmaDB)
+	case scenario.ModelTwoRayGround:
+		model = radio.NewTwoRayGround(spec.FrequencyHz, spec.AntennaHeight)
+	default:
+		return nil
+	}
+
+	switch spec.Fading {
+	case scenario.FadingRayleigh:
+		model = radio.NewRayleighFading(model)
+	case scenario.FadingRician:
+		model = radio.NewRicianFading(model, spec.RicianK)
+	}
+
+	return model
+}
+
+// lossModel builds the radio's loss model, nil delivers every frame that arrives
+func lossModel(spec scenario.RadioSpec) radio.LossModel {
+	switch spec.Loss {
+	case scenario.LossLinkQuality:
+		return radio.LinkQualityLoss{}
+	case scenario.LossPERCurve:
+		points := make([]radio.PERPoint, 0, len(spec.PERCurve))
+		for _, p := range spec.PERCurve {
+			points = append(points, radio.PERPoint{Quality: p.Quality, PER: p.PER})
+		}
+		return radio.NewPERCurve(points)
+	}
+
+	return nil
+}
+
 func init() {
 	rootCmd.AddCommand(runCmd)
 
@@ -97,5 +222,143 @@ func init() {
 
 	// Cobra supports local flags which will only run when this command
 	// is called directly, e.g.:
-	// runCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	runCmd.Flags().Int64Var(&seed, "seed", scenario.DefaultSeed, "random seed, overrides the scenario's seed")
+	runCmd.Flags().DurationVar(&duration, "duration", scenario.DefaultDuration, "virtual time to simulate, overrides the scenario's duration")
+	runCmd.Flags().StringVarP(&scenarioFile, "scenario", "s", "", "scenario file (YAML or JSON) describing the arena, drones and traffic")
+}
+
+// routingProtocol builds the routing protocol the scenario picked for a drone
+func routingProtocol(sc *scenario.Scenario, spec scenario.DroneSpec, sched *sim.Scheduler) routing.Protocol {
+	switch sc.Routing {
+	case scenario.RoutingOLSR:
+		olsr := sc.OLSR
+		if spec.OLSR != nil {
+			olsr = *spec.OLSR
+		}
+
+		return routing.NewOLSR(routing.OLSRConfig{
+			HelloInterval:       olsr.HelloInterval,
+			TCInterval:          olsr.TCInterval,
+			NeighbHoldTime:      olsr.NeighbHoldTime,
+			TopHoldTime:         olsr.TopHoldTime,
+			DupHoldTime:         olsr.DupHoldTime,
+			Willingness:         olsr.Willingness,
+			ExpiryCheckInterval: olsr.ExpiryCheckInterval,
+		}, sched)
+	case scenario.RoutingDSR:
+		dsr := sc.DSR
+		if spec.DSR != nil {
+			dsr = *spec.DSR
+		}
+
+		return routing.NewDSR(routing.DSRConfig{
+			DiscoveryHopLimit:     dsr.DiscoveryHopLimit,
+			NonpropRequestTimeout: dsr.NonpropRequestTimeout,
+			RequestPeriod:         dsr.RequestPeriod,
+			MaxRequestPeriod:      dsr.MaxRequestPeriod,
+			MaxRequestRexmt:       dsr.MaxRequestRexmt,
+			RouteCacheTimeout:     dsr.RouteCacheTimeout,
+			MaxSalvageCount:       dsr.MaxSalvageCount,
+			SendBufferTimeout:     dsr.SendBufferTimeout,
+			ExpiryCheckInterval:   dsr.ExpiryCheckInterval,
+		}, sched)
+	case scenario.RoutingGPSR:
+		gpsr := sc.GPSR
+		if spec.GPSR != nil {
+			gpsr = *spec.GPSR
+		}
+
+		return routing.NewGPSR(routing.GPSRConfig{
+			BeaconInterval:      gpsr.BeaconInterval,
+			AllowedBeaconLoss:   gpsr.AllowedBeaconLoss,
+			MaxHops:             gpsr.MaxHops,
+			LocationTimeout:     gpsr.LocationTimeout,
+			QueryTTL:            gpsr.QueryTTL,
+			QueryTimeout:        gpsr.QueryTimeout,
+			QueryRetries:        gpsr.QueryRetries,
+			ExpiryCheckInterval: gpsr.ExpiryCheckInterval,
+		}, sched)
+	case scenario.RoutingBATMAN:
+		batman := sc.BATMAN
+		if spec.BATMAN != nil {
+			batman = *spec.BATMAN
+		}
+
+		return routing.NewBATMAN(routing.BATMANConfig{
+			OriginatorInterval:  batman.OriginatorInterval,
+			TTL:                 batman.TTL,
+			WindowSize:          batman.WindowSize,
+			BidirectTimeout:     batman.BidirectTimeout,
+			PurgeTimeout:        batman.PurgeTimeout,
+			ExpiryCheckInterval: batman.ExpiryCheckInterval,
+		}, sched)
+	case scenario.RoutingDTN:
+		dtn := sc.DTN
+		if spec.DTN != nil {
+			dtn = *spec.DTN
+		}
+
+		return routing.NewDTN(routing.DTNConfig{
+			Mode:                dtn.Mode,
+			HelloInterval:       dtn.HelloInterval,
+			AllowedHelloLoss:    dtn.AllowedHelloLoss,
+			SummaryInterval:     dtn.SummaryInterval,
+			BufferSize:          dtn.BufferSize,
+			MessageLifetime:     dtn.MessageLifetime,
+			Copies:              dtn.Copies,
+			PInit:               dtn.PInit,
+			Beta:                dtn.Beta,
+			Gamma:               dtn.Gamma,
+			AgingUnit:           dtn.AgingUnit,
+			ExpiryCheckInterval: dtn.ExpiryCheckInterval,
+		}, sched)
+	default: // scenario.RoutingAODV, validation rejects unknown protocols
+		aodv := sc.AODV
+		if spec.AODV != nil {
+			aodv = *spec.AODV
+		}
+
+		return routing.NewAODVListener(aodvConfig(aodv), sched)
+	}
+}
+
+// aodvConfig passes the scenario's AODV parameters on, the zero ones are
+// defaulted by the routing layer
+func aodvConfig(spec scenario.AODVSpec) routing.AODVConfig {
+	return routing.AODVConfig{
+		ActiveRouteTimeout:   spec.ActiveRouteTimeout,
+		AllowedHelloLoss:     spec.AllowedHelloLoss,
+		BlacklistTimeout:     spec.BlacklistTimeout,
+		DeletePeriod:         spec.DeletePeriod,
+		HelloInterval:        spec.HelloInterval,
+		LocalAddTTL:          spec.LocalAddTTL,
+		MaxRepairTTL:         spec.MaxRepairTTL,
+		MyRouteTimeout:       spec.MyRouteTimeout,
+		NetDiameter:          spec.NetDiameter,
+		NextHopWait:          spec.NextHopWait,
+		NodeTraversalTime:    spec.NodeTraversalTime,
+		PathDiscoveryTime:    spec.PathDiscoveryTime,
+		RERRRateLimit:        spec.RERRRateLimit,
+		RREQRetries:          spec.RREQRetries,
+		RREQRateLimit:        spec.RREQRateLimit,
+		TimeoutBuffer:        spec.TimeoutBuffer,
+		TTLStart:             spec.TTLStart,
+		TTLIncrement:         spec.TTLIncrement,
+		TTLThreshold:         spec.TTLThreshold,
+		ExpiryCheckInterval:  spec.ExpiryCheckInterval,
+		Gratuitous:           enabled(spec.Gratuitous),
+		DestinationOnly:      enabled(spec.DestinationOnly),
+		RREPAck:              enabled(spec.RREPAck),
+		ETX:                  enabled(spec.ETX),
+		LinkExpiration:       enabled(spec.LinkExpiration),
+		LinkExpirationMargin: spec.LinkExpirationMargin,
+		Multipath:            enabled(spec.Multipath),
+		MaxPaths:             spec.MaxPaths,
+		LoadBalance:          enabled(spec.LoadBalance),
+	}
+}
+
+// enabled reports whether a scenario switch is on, unset means off
+func enabled(b *bool) bool {
+	return b != nil && *b
 }
@@ -6,6 +6,7 @@ require (
 	github.com/gopxl/pixel/v2 v2.3.0
 	github.com/spf13/cobra v1.8.1
 	golang.org/x/image v0.20.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
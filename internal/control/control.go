@@ -7,61 +7,54 @@ import (
 	"time"
 
 	"github.com/azaurus1/swarm/internal/routing"
+	"github.com/azaurus1/swarm/internal/sim"
 	"github.com/azaurus1/swarm/internal/types"
 )
 
 type ControlLayer struct {
 	ReceivedCommands map[string]time.Time
 	Mutex            *sync.Mutex
+	Clock            sim.Clock
 }
 
-func NewControlLayer() *ControlLayer {
+func NewControlLayer(clock sim.Clock) *ControlLayer {
 	return &ControlLayer{
 		ReceivedCommands: make(map[string]time.Time),
 		Mutex:            &sync.Mutex{},
+		Clock:            clock,
 	}
 }
 
-func (c *ControlLayer) HandleCommand(droneId string, droneSeqNum int, droneMsg types.DroneMessage, radioChan chan []byte, aodv *routing.AODVListener) {
+func (c *ControlLayer) HandleCommand(droneId string, droneMsg types.DroneMessage, radioQueue *sim.Queue, router routing.Protocol) {
 	cMsg := droneMsg.ControlPayload
 
 	if droneId != cMsg.RecipientID {
 		if _, exists := c.ReceivedCommands[cMsg.Checksum]; !exists {
-			c.ReceivedCommands[cMsg.Checksum] = time.Now()
+			c.ReceivedCommands[cMsg.Checksum] = c.Clock.Now()
 		} else {
 			return
 		}
 
-		routeExists := aodv.CheckForRoute(cMsg.RecipientID)
+		nextHop, routeExists := router.NextHop(cMsg.RecipientID)
 
 		if routeExists {
+			// unicast to the next hop, only it will pick the frame up
 			droneMsg.Source = droneId
+			droneMsg.NextHop = nextHop
 
 			dData, err := json.Marshal(droneMsg)
 			if err != nil {
 				log.Println("error marshalling control message for rebroadcast ", err)
 			}
 
-			radioChan <- dData
+			radioQueue.Push(dData)
+		} else if droneId != cMsg.SenderID {
+			// we were asked to forward this but have no route, the drone we
+			// got it from needs to know its route is broken
+			router.Unreachable(cMsg.RecipientID, droneMsg.Source)
 		} else {
-			// send RREQ
-			rreq := types.DroneMessage{
-				Source: "1",
-				Type:   "AODV",
-				AODVPayload: types.AODVMessage{
-					Source:                droneId,
-					Type:                  1,
-					RREQID:                "1738",
-					DestinationId:         cMsg.RecipientID,
-					OriginatorId:          cMsg.SenderID,
-					OriginatorSequenceNum: droneSeqNum,
-					UnknownSequenceNum:    true,
-				},
-			}
-
-			data, _ := json.Marshal(rreq)
-
-			radioChan <- data
+			// ask the routing protocol for a route
+			router.RequestRoute(cMsg.RecipientID)
 		}
 	} else {
 		log.Println("I have received a command for me")
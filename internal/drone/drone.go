@@ -1,15 +1,18 @@
 package drone
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
-	"sync"
 	"time"
 
 	"github.com/azaurus1/swarm/internal/control"
 	"github.com/azaurus1/swarm/internal/messaging"
+	"github.com/azaurus1/swarm/internal/multicast"
 	"github.com/azaurus1/swarm/internal/routing"
+	"github.com/azaurus1/swarm/internal/sim"
 	"github.com/azaurus1/swarm/internal/types"
 )
 
@@ -20,220 +23,206 @@ type Drone struct {
 	VX                float64
 	VY                float64
 	TransmissionRange float64
-	SequenceNumber    int
-	DataChan          chan []byte
-	PathDiscoveryTime time.Duration
-	TransportLayer    *messaging.TransportLayer
-	AODVListener      *routing.AODVListener
-	ContolLayer       *control.ControlLayer
+	TxPower           float64 // dBm, only used with a propagation model
+	// Routing is the MANET routing protocol the drone runs, AODV with its
+	// default parameters if it is left unset
+	Routing        routing.Protocol
+	TransportLayer *messaging.TransportLayer
+	ContolLayer    *control.ControlLayer
+	MulticastLayer *multicast.MulticastLayer
+	// Groups are the multicast groups the drone starts out in, Multicast
+	// sets how their membership is spread
+	Groups    []string
+	Multicast multicast.Config
+	// PendingQueueLimit is how many packets per destination wait for a route,
+	// the rest are dropped, 64 if unset
+	PendingQueueLimit int
+
+	sched      *sim.Scheduler
+	radioQueue *sim.Queue
+	// messages sent so far, keeps checksums of repeated payloads distinct
+	sent int
 }
 
-func (d *Drone) Start(wg *sync.WaitGroup, radioChan chan []byte) {
-	defer wg.Done()
+// Start wires the drone's protocol layers to the scheduler and schedules its
+// routing protocol and expiry timers, nothing happens until the scheduler runs.
+func (d *Drone) Start(sched *sim.Scheduler, radioQueue *sim.Queue) {
+	if d.Id == "" {
+		log.Println("Drone ID is empty at start!")
+		return
+	}
 
-	//
-	d.PathDiscoveryTime = 30 * time.Second
+	d.sched = sched
+	d.radioQueue = radioQueue
 
-	d.AODVListener = routing.NewAODVListener()
-	d.TransportLayer = messaging.NewTransportLayer()
-	d.ContolLayer = control.NewControlLayer()
-	// hello ticker
-	helloTicker := time.NewTicker(1000 * time.Millisecond)
-	// expiry ticke
-	expirationTicker := time.NewTicker(1000 * time.Millisecond)
+	if d.Routing == nil {
+		d.Routing = routing.NewAODVListener(routing.AODVConfig{}, sched)
+	}
+	if d.PendingQueueLimit == 0 {
+		d.PendingQueueLimit = 64
+	}
+	d.TransportLayer = messaging.NewTransportLayer(sched, d.PendingQueueLimit)
+	d.ContolLayer = control.NewControlLayer(sched)
+	d.MulticastLayer = multicast.NewMulticastLayer(d.Multicast, sched)
+
+	d.Routing.SetRouteEvents(routing.RouteEvents{
+		// packets held during route discovery go out as soon as the route is in
+		OnRoute: func(destination string) {
+			d.TransportLayer.Flush(d.Id, destination, d.radioQueue, d.Routing)
+		},
+		OnNoRoute: func(destination string) {
+			d.TransportLayer.DropPending(d.Id, destination, "route discovery failed")
+		},
+	})
+	d.Routing.Start(d, sched, radioQueue)
+	d.MulticastLayer.Start(d.Id, d.Groups, sched, radioQueue)
+
+	// handling expired neighbours, routes and packets
+	tick := d.Routing.TickInterval()
+	sched.Every(tick, tick, func() {
+		d.Routing.Tick()
+		d.TransportLayer.ExpirePending(d.Id, d.Routing.PendingTimeout())
+		d.MulticastLayer.Expire()
+	})
+}
 
-	done := make(chan bool)
+// Receive handles a message the radio has delivered to this drone
+func (d *Drone) Receive(msg []byte) {
+	log.Printf("drone %s > message received: %s", d.Id, msg)
 
-	if d.Id == "" {
-		log.Println("Drone ID is empty at start!")
+	// unmarshall
+	var droneMsg types.DroneMessage
+
+	err := json.Unmarshal(msg, &droneMsg)
+	if err != nil {
+		log.Printf("Failed to unmarshal message: %v", err)
 		return
 	}
 
-	// data in - dataChan (this is data from radio/air)
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		for msg := range d.DataChan {
-			log.Printf("drone %s > message received: %s", d.Id, msg)
-
-			// unmarshall
-			var droneMsg types.DroneMessage
-
-			err := json.Unmarshal(msg, &droneMsg)
-			if err != nil {
-				log.Printf("Failed to unmarshal message: %v", err)
-				continue
-			}
-
-			switch droneMsg.Type {
-			case "AODV":
-				aMsg := droneMsg.AODVPayload
-
-				if aMsg.TTL < aMsg.HopCount+1 {
-					// log.Println("TTL expired, discarding message")
-				}
-				// log.Printf("Drone %s routing table: ", d.Id)
-				d.AODVListener.HandleAODVMessage(d.Id, d.PathDiscoveryTime, aMsg, radioChan)
-			case "DATA":
-				d.TransportLayer.HandleDataMessage(d.Id, d.SequenceNumber, droneMsg, radioChan, d.AODVListener)
-			case "CONTROL":
-				d.ContolLayer.HandleCommand(d.Id, d.SequenceNumber, droneMsg, radioChan, d.AODVListener)
-			}
-		}
-	}()
-
-	// send a HELLO for neighbour discovery
-	// hellos should actually be RREP with TTL of 1
-	wg.Add(1)
-	go func() {
-		// handling expired neighbours
-		defer wg.Done()
-		defer helloTicker.Stop()
-
-		for {
-			select {
-			case <-done:
-				return
-			case <-helloTicker.C:
-				helloMsg := types.AODVMessage{
-					Source:                 d.Id,
-					Type:                   2,
-					HopCount:               1,
-					DestinationId:          d.Id,
-					DestinationSequenceNum: 1,
-					OriginatorId:           d.Id,
-					OriginatorSequenceNum:  1,
-					TTL:                    1,
-				}
-
-				helloDMsg := types.DroneMessage{
-					Source:      helloMsg.Source,
-					Type:        "AODV",
-					AODVPayload: helloMsg,
-				}
-
-				data, _ := json.Marshal(helloDMsg)
-
-				radioChan <- data
-			}
-
-		}
-
-	}()
-
-	// Expiration ticker
-	wg.Add(1)
-	go func() {
-		// handling expired neighbours
-		defer wg.Done()
-		defer expirationTicker.Stop()
-
-		for {
-			select {
-			case <-done:
-				return
-			case <-expirationTicker.C:
-				d.AODVListener.CheckExpiredNeighbours()
-			}
-
-		}
-
-	}()
-
-	// sending a RREQ
-	if d.Id == "1" {
-
-		reqDMsg := types.DroneMessage{
-			Source: "1",
-			Type:   "AODV",
-			AODVPayload: types.AODVMessage{
-				Source:                "1",
-				Type:                  1,
-				RREQID:                "1738",
-				DestinationId:         "5",
-				OriginatorId:          "1",
-				OriginatorSequenceNum: d.SequenceNumber,
-				UnknownSequenceNum:    true,
-			},
-		}
-
-		data, err := json.Marshal(reqDMsg)
-		if err != nil {
-			log.Println("error marshalling drone message: ", err)
-		}
-
-		radioChan <- data
-		d.SequenceNumber++
+	d.Routing.HeardFrom(droneMsg.Source)
+
+	switch droneMsg.Type {
+	case d.Routing.Name():
+		d.Routing.HandleMessage(droneMsg)
+	case "DATA":
+		d.TransportLayer.HandleDataMessage(d.Id, droneMsg, d.radioQueue, d.Routing)
+	case "CONTROL":
+		d.ContolLayer.HandleCommand(d.Id, droneMsg, d.radioQueue, d.Routing)
+	case "GROUP":
+		d.MulticastLayer.HandleAnnouncement(droneMsg)
+	case "MULTICAST":
+		d.MulticastLayer.HandleData(droneMsg)
+	}
+}
+
+// LinkFailed is called by the radio when a unicast frame to nextHop couldn't
+// be delivered, the link is treated as broken. A DATA message in the frame
+// may still be salvaged along another route.
+func (d *Drone) LinkFailed(nextHop string, msg []byte) {
+	log.Printf("drone %s > link to %s failed", d.Id, nextHop)
+	d.Routing.LinkFailed(nextHop)
+
+	var droneMsg types.DroneMessage
+	if err := json.Unmarshal(msg, &droneMsg); err == nil && droneMsg.Type == "DATA" {
+		d.TransportLayer.Salvage(d.Id, droneMsg, d.radioQueue, d.Routing)
+	}
+}
+
+// ID, Position, Velocity and Range make the drone a routing.Node
+func (d *Drone) ID() string {
+	return d.Id
+}
+
+func (d *Drone) Position() types.Position {
+	return types.Position{X: d.X, Y: d.Y}
+}
+
+func (d *Drone) Velocity() types.Velocity {
+	return types.Velocity{X: d.VX, Y: d.VY}
+}
+
+func (d *Drone) Range() float64 {
+	return d.TransmissionRange
+}
+
+// SendRREQ asks the routing protocol for a route to destination, with AODV
+// this starts a route discovery
+func (d *Drone) SendRREQ(destination string) {
+	d.Routing.RequestRoute(destination)
+}
+
+// SendData sends a DATA message to recipient, it goes through the transport
+// layer like any other so it follows the route to recipient
+func (d *Drone) SendData(recipient string, payload []byte) {
+	reqDMsg := types.DroneMessage{
+		Source: d.Id,
+		Type:   "DATA",
+		DataPayload: types.DataMessage{
+			Checksum:    d.checksum(recipient, string(payload)),
+			RecipientID: recipient,
+			SenderID:    d.Id,
+			Data:        payload,
+		},
+	}
+
+	d.sent++
+	d.TransportLayer.HandleDataMessage(d.Id, reqDMsg, d.radioQueue, d.Routing)
+}
+
+// SendCommand sends a CONTROL message to recipient along the route to it
+func (d *Drone) SendCommand(recipient string, command string, params map[string]string) {
+	reqDMsg := types.DroneMessage{
+		Source: d.Id,
+		Type:   "CONTROL",
+		ControlPayload: types.ControlMessage{
+			Checksum:    d.checksum(recipient, command, fmt.Sprint(params)),
+			RecipientID: recipient,
+			SenderID:    d.Id,
+			Command:     command,
+			Params:      params,
+		},
+	}
+
+	d.sent++
+	d.ContolLayer.HandleCommand(d.Id, reqDMsg, d.radioQueue, d.Routing)
+}
+
+// SendMulticast sends a DATA message to every member of group
+func (d *Drone) SendMulticast(group string, payload []byte) {
+	reqDMsg := types.DroneMessage{
+		Source: d.Id,
+		Type:   "MULTICAST",
+		DataPayload: types.DataMessage{
+			Checksum: d.checksum(group, string(payload)),
+			SenderID: d.Id,
+			Group:    group,
+			Data:     payload,
+		},
+	}
+
+	d.sent++
+	d.MulticastLayer.HandleData(reqDMsg)
+}
+
+// JoinGroup and LeaveGroup change the multicast groups the drone is in
+func (d *Drone) JoinGroup(group string) {
+	d.MulticastLayer.Join(group)
+}
+
+func (d *Drone) LeaveGroup(group string) {
+	d.MulticastLayer.Leave(group)
+}
 
+// checksums are used by the transport and control layers to drop duplicates,
+// so a message counter is mixed in to keep repeated payloads distinct
+func (d *Drone) checksum(parts ...string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s/%d", d.Id, d.sent)
+	for _, p := range parts {
+		fmt.Fprintf(h, "/%s", p)
 	}
 
-	wg.Add(1)
-	go func() {
-		// handling expired neighbours
-		defer wg.Done()
-		// sending a DATA
-
-		time.Sleep(3 * time.Second)
-
-		if d.Id == "1" {
-
-			reqDMsg := types.DroneMessage{
-				Source: "1",
-				Type:   "DATA",
-				DataPayload: types.DataMessage{
-					Checksum:    "1738",
-					RecipientID: "5",
-					SenderID:    "1",
-					Data:        []byte("Hello"),
-				},
-			}
-
-			data, err := json.Marshal(reqDMsg)
-			if err != nil {
-				log.Println("error marshalling drone message: ", err)
-			}
-
-			radioChan <- data
-			d.SequenceNumber++
-
-		}
-	}()
-
-	wg.Add(1)
-	go func() {
-		// handling expired neighbours
-		defer wg.Done()
-		// sending a DATA
-
-		time.Sleep(3 * time.Second)
-
-		if d.Id == "1" {
-
-			reqDMsg := types.DroneMessage{
-				Source: "1",
-				Type:   "CONTROL",
-				ControlPayload: types.ControlMessage{
-					Checksum:    "1738",
-					RecipientID: "5",
-					SenderID:    "1",
-					Command:     "move",
-					Params: map[string]string{
-						"x": "2",
-						"y": "1",
-					},
-				},
-			}
-
-			data, err := json.Marshal(reqDMsg)
-			if err != nil {
-				log.Println("error marshalling drone message: ", err)
-			}
-
-			radioChan <- data
-			d.SequenceNumber++
-
-		}
-	}()
+	return hex.EncodeToString(h.Sum(nil))
 }
 
 func (d *Drone) ToString() string {
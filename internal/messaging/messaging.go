@@ -1,73 +1,131 @@
 package messaging
 
 import (
-	"encoding/json"
 	"log"
 	"sync"
 	"time"
 
 	"github.com/azaurus1/swarm/internal/routing"
+	"github.com/azaurus1/swarm/internal/sim"
 	"github.com/azaurus1/swarm/internal/types"
 )
 
 type TransportLayer struct {
 	ReceivedMessages map[string]time.Time
 	Mutex            *sync.Mutex
+	Clock            sim.Clock
+	// packets we originated that are waiting for a route, by recipient, at
+	// most QueueLimit each
+	Pending    map[string][]PendingPacket
+	QueueLimit int
 }
 
-func NewTransportLayer() *TransportLayer {
+func NewTransportLayer(clock sim.Clock, queueLimit int) *TransportLayer {
 	return &TransportLayer{
 		ReceivedMessages: make(map[string]time.Time),
 		Mutex:            &sync.Mutex{},
+		Clock:            clock,
+		Pending:          make(map[string][]PendingPacket),
+		QueueLimit:       queueLimit,
 	}
 }
 
-func (t *TransportLayer) HandleDataMessage(droneId string, droneSeqNum int, droneMsg types.DroneMessage, radioChan chan []byte, aodv *routing.AODVListener) {
+func (t *TransportLayer) HandleDataMessage(droneId string, droneMsg types.DroneMessage, radioQueue *sim.Queue, router routing.Protocol) {
 	dMsg := droneMsg.DataPayload
 
+	if custodian, ok := router.(routing.Custodian); ok {
+		t.carry(droneId, droneMsg, custodian)
+		return
+	}
+
 	if droneId != dMsg.RecipientID {
 		if _, exists := t.ReceivedMessages[dMsg.Checksum]; !exists {
 			// add to received messages map
-			t.ReceivedMessages[dMsg.Checksum] = time.Now()
+			t.ReceivedMessages[dMsg.Checksum] = t.Clock.Now()
 		} else {
 			return
 		}
 
-		routeExists := aodv.CheckForRoute(dMsg.RecipientID)
+		next, routeExists := nextHop(router, &droneMsg)
 
 		if routeExists {
-			// get next hop, then send message
-			// propagate message
-			droneMsg.Source = droneId
-
-			dData, err := json.Marshal(droneMsg)
-			if err != nil {
-				log.Println("error marshalling data message for rebroadcast")
+			t.send(droneId, next, droneMsg, radioQueue)
+		} else if router.Repairing(dMsg.RecipientID) {
+			// the route broke just ahead of us and is being repaired, hold
+			// the packet until it is back
+			t.queue(droneId, dMsg.RecipientID, droneMsg)
+		} else if droneId != dMsg.SenderID {
+			// we were asked to forward this but have no route, the drone we
+			// got it from needs to know its route is broken
+			router.Unreachable(dMsg.RecipientID, droneMsg.Source)
+		} else {
+			// hold the packet and ask for a route, unless one is already on its way
+			if !t.queue(droneId, dMsg.RecipientID, droneMsg) {
+				router.RequestRoute(dMsg.RecipientID)
 			}
+		}
+	} else {
+		log.Printf("%s - I have received a data message", droneId)
+
+	}
+}
+
+// carry hands a DATA message to a delay tolerant protocol to store, or tells
+// it the message reached us. Copies come from every carrier we meet so they
+// are dropped here too once we have it.
+func (t *TransportLayer) carry(droneId string, droneMsg types.DroneMessage, custodian routing.Custodian) {
+	dMsg := droneMsg.DataPayload
+	if _, exists := t.ReceivedMessages[dMsg.Checksum]; exists {
+		return
+	}
+	t.ReceivedMessages[dMsg.Checksum] = t.Clock.Now()
 
-			radioChan <- dData
+	if droneId == dMsg.RecipientID {
+		log.Printf("%s - I have received a data message", droneId)
+		custodian.Delivered(dMsg)
+		return
+	}
+
+	custodian.Store(dMsg, droneMsg.Source)
+}
+
+// Salvage gives a DATA message the link layer couldn't deliver another route
+// if the routing protocol has one, one of our own waits for a new route
+// otherwise. A protocol that routes by recipient only salvages it if it
+// already switched to another next hop, AOMDV failing over for example, or
+// holds it while the route is repaired (RFC3561 6.12).
+func (t *TransportLayer) Salvage(droneId string, droneMsg types.DroneMessage, radioQueue *sim.Queue, router routing.Protocol) {
+	if _, ok := router.(routing.Custodian); ok {
+		log.Printf("%s: handing packet for %s to %s failed, still carrying it", droneId, droneMsg.DataPayload.RecipientID, droneMsg.NextHop)
+		return
+	}
+
+	packetRouter, ok := router.(routing.PacketRouter)
+	if !ok {
+		recipient := droneMsg.DataPayload.RecipientID
+		if next, exists := router.NextHop(recipient); exists && next != droneMsg.NextHop {
+			log.Printf("%s: salvaging packet for %s via %s", droneId, recipient, next)
+			t.send(droneId, next, droneMsg, radioQueue)
+		} else if router.Repairing(recipient) {
+			log.Printf("%s: holding packet for %s until its route is repaired", droneId, recipient)
+			t.queue(droneId, recipient, droneMsg)
 		} else {
-			// send RREQ
-			rreq := types.DroneMessage{
-				Source: "1",
-				Type:   "AODV",
-				AODVPayload: types.AODVMessage{
-					Source:                droneId,
-					Type:                  1,
-					RREQID:                "1738",
-					DestinationId:         dMsg.RecipientID,
-					OriginatorId:          dMsg.SenderID,
-					OriginatorSequenceNum: droneSeqNum,
-					UnknownSequenceNum:    true,
-				},
-			}
+			log.Printf("%s: link to %s failed and there is no other route to %s, dropping packet", droneId, droneMsg.NextHop, recipient)
+		}
+		return
+	}
 
-			data, _ := json.Marshal(rreq)
+	dMsg := &droneMsg.DataPayload
 
-			radioChan <- data
+	if next, salvaged := packetRouter.SalvagePacket(dMsg); salvaged {
+		log.Printf("%s: salvaging packet for %s via %s", droneId, dMsg.RecipientID, next)
+		t.send(droneId, next, droneMsg, radioQueue)
+	} else if droneId == dMsg.SenderID {
+		dMsg.SourceRoute = nil
+		if !t.queue(droneId, dMsg.RecipientID, droneMsg) {
+			router.RequestRoute(dMsg.RecipientID)
 		}
 	} else {
-		log.Printf("%s - I have received a data message", droneId)
-
+		log.Printf("%s: no other route to %s, dropping packet", droneId, dMsg.RecipientID)
 	}
 }
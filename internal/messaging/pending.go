@@ -0,0 +1,128 @@
+package messaging
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/azaurus1/swarm/internal/routing"
+	"github.com/azaurus1/swarm/internal/sim"
+	"github.com/azaurus1/swarm/internal/types"
+)
+
+// PendingPacket is a DATA message held until a route to its recipient exists
+type PendingPacket struct {
+	Msg    types.DroneMessage
+	Queued time.Time
+}
+
+// queue holds droneMsg until a route to destination is found, it reports
+// whether a discovery was already running for it
+func (t *TransportLayer) queue(droneId string, destination string, droneMsg types.DroneMessage) bool {
+	pending, discovering := t.Pending[destination]
+
+	if len(pending) >= t.QueueLimit {
+		log.Printf("%s: pending queue for %s full, dropping packet", droneId, destination)
+		return discovering
+	}
+
+	t.Pending[destination] = append(pending, PendingPacket{Msg: droneMsg, Queued: t.Clock.Now()})
+
+	return discovering
+}
+
+// Flush sends the packets waiting for destination once a route to it exists
+func (t *TransportLayer) Flush(droneId string, destination string, radioQueue *sim.Queue, router routing.Protocol) {
+	pending, exists := t.Pending[destination]
+	if !exists {
+		return
+	}
+
+	delete(t.Pending, destination)
+
+	// each packet is routed once, routing may rewrite the header it carries
+	sent := 0
+	for _, p := range pending {
+		next, routeExists := nextHop(router, &p.Msg)
+		if !routeExists {
+			t.Pending[destination] = append(t.Pending[destination], p)
+			continue
+		}
+
+		t.send(droneId, next, p.Msg, radioQueue)
+		sent++
+	}
+
+	if sent > 0 {
+		log.Printf("%s: route to %s found, sent %d pending packets", droneId, destination, sent)
+	}
+}
+
+// ExpirePending drops the packets that have waited longer than timeout for a
+// route, the others keep waiting
+func (t *TransportLayer) ExpirePending(droneId string, timeout time.Duration) {
+	// in key order, so the drops are logged the same way every run
+	destinations := make([]string, 0, len(t.Pending))
+	for destination := range t.Pending {
+		destinations = append(destinations, destination)
+	}
+	sort.Strings(destinations)
+
+	now := t.Clock.Now()
+	for _, destination := range destinations {
+		var waiting []PendingPacket
+		for _, p := range t.Pending[destination] {
+			if now.Sub(p.Queued) <= timeout {
+				waiting = append(waiting, p)
+			}
+		}
+
+		expired := len(t.Pending[destination]) - len(waiting)
+		if expired == 0 {
+			continue
+		}
+		if len(waiting) == 0 {
+			t.DropPending(droneId, destination, "route discovery timed out")
+			continue
+		}
+
+		log.Printf("%s: dropping %d packets for %s: route discovery timed out", droneId, expired, destination)
+		t.Pending[destination] = waiting
+	}
+}
+
+// DropPending gives up on every packet waiting for destination
+func (t *TransportLayer) DropPending(droneId string, destination string, reason string) {
+	pending, exists := t.Pending[destination]
+	if !exists {
+		return
+	}
+
+	log.Printf("%s: dropping %d packets for %s: %s", droneId, len(pending), destination, reason)
+
+	delete(t.Pending, destination)
+}
+
+// nextHop asks the routing protocol where a DATA message goes next, by the
+// route it carries if the protocol routes packets that way
+func nextHop(router routing.Protocol, droneMsg *types.DroneMessage) (string, bool) {
+	if packetRouter, ok := router.(routing.PacketRouter); ok {
+		return packetRouter.RoutePacket(&droneMsg.DataPayload)
+	}
+
+	return router.NextHop(droneMsg.DataPayload.RecipientID)
+}
+
+func (t *TransportLayer) send(droneId string, nextHop string, droneMsg types.DroneMessage, radioQueue *sim.Queue) {
+	// unicast to the next hop, only it will pick the frame up
+	droneMsg.Source = droneId
+	droneMsg.NextHop = nextHop
+
+	dData, err := json.Marshal(droneMsg)
+	if err != nil {
+		log.Println("error marshalling data message for rebroadcast")
+	}
+
+	radioQueue.Push(dData)
+}
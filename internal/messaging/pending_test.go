@@ -0,0 +1,171 @@
+package messaging
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/azaurus1/swarm/internal/routing"
+	"github.com/azaurus1/swarm/internal/sim"
+	"github.com/azaurus1/swarm/internal/types"
+)
+
+// testRouter knows the routes it is given and counts the discoveries asked of it
+type testRouter struct {
+	routes    map[string]string
+	requested []string
+}
+
+func (r *testRouter) Name() string                                   { return "TEST" }
+func (r *testRouter) Start(routing.Node, *sim.Scheduler, *sim.Queue) {}
+func (r *testRouter) HandleMessage(types.DroneMessage)               {}
+func (r *testRouter) Tick()                                          {}
+func (r *testRouter) TickInterval() time.Duration                    { return time.Second }
+func (r *testRouter) PendingTimeout() time.Duration                  { return 10 * time.Second }
+func (r *testRouter) HeardFrom(string)                               {}
+func (r *testRouter) LinkFailed(string)                              {}
+func (r *testRouter) RequestRoute(destination string)                { r.requested = append(r.requested, destination) }
+func (r *testRouter) Repairing(string) bool                          { return false }
+func (r *testRouter) Unreachable(string, string)                     {}
+func (r *testRouter) SetRouteEvents(routing.RouteEvents)             {}
+func (r *testRouter) NextHop(destination string) (next string, exists bool) {
+	next, exists = r.routes[destination]
+	return next, exists
+}
+
+// originate has drone a send a packet to recipient
+func originate(t *TransportLayer, router routing.Protocol, queue *sim.Queue, recipient string, n int) {
+	t.HandleDataMessage("a", types.DroneMessage{
+		Source: "a",
+		Type:   "DATA",
+		DataPayload: types.DataMessage{
+			Checksum:    fmt.Sprintf("%s-%d", recipient, n),
+			RecipientID: recipient,
+			SenderID:    "a",
+		},
+	}, queue, router)
+}
+
+// sent is the checksums and next hops of the frames in queue
+func sent(queue *sim.Queue) []string {
+	var frames []string
+	for {
+		frame, ok := queue.Pop()
+		if !ok {
+			return frames
+		}
+		var msg types.DroneMessage
+		json.Unmarshal(frame, &msg)
+		frames = append(frames, msg.DataPayload.Checksum+">"+msg.NextHop)
+	}
+}
+
+// held is the checksums of the packets waiting for destination
+func held(t *TransportLayer, destination string) []string {
+	var checksums []string
+	for _, p := range t.Pending[destination] {
+		checksums = append(checksums, p.Msg.DataPayload.Checksum)
+	}
+	return checksums
+}
+
+func TestQueueAndFlush(t *testing.T) {
+	sched := sim.NewScheduler(1)
+	queue := sim.NewQueue()
+	router := &testRouter{routes: make(map[string]string)}
+	transport := NewTransportLayer(sched, 64)
+
+	originate(transport, router, queue, "d", 1)
+	originate(transport, router, queue, "d", 2)
+
+	if frames := sent(queue); len(frames) != 0 {
+		t.Fatalf("sent %v without a route", frames)
+	}
+	if want := []string{"d"}; !slices.Equal(router.requested, want) {
+		t.Errorf("requested routes to %v, want %v", router.requested, want)
+	}
+	if want := []string{"d-1", "d-2"}; !slices.Equal(held(transport, "d"), want) {
+		t.Errorf("holding %v, want %v", held(transport, "d"), want)
+	}
+
+	router.routes["d"] = "b"
+	transport.Flush("a", "d", queue, router)
+
+	if want := []string{"d-1>b", "d-2>b"}; !slices.Equal(sent(queue), want) {
+		t.Errorf("flushed frames don't match %v", want)
+	}
+	if _, waiting := transport.Pending["d"]; waiting {
+		t.Errorf("still holding %v after the flush", held(transport, "d"))
+	}
+}
+
+func TestQueueOverflow(t *testing.T) {
+	tests := []struct {
+		name    string
+		limit   int
+		packets int
+		held    []string
+	}{
+		{"under the limit", 3, 2, []string{"d-1", "d-2"}},
+		{"at the limit", 2, 2, []string{"d-1", "d-2"}},
+		{"over the limit", 2, 4, []string{"d-1", "d-2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := &testRouter{routes: make(map[string]string)}
+			transport := NewTransportLayer(sim.NewScheduler(1), tt.limit)
+
+			for i := 1; i <= tt.packets; i++ {
+				originate(transport, router, sim.NewQueue(), "d", i)
+			}
+
+			if got := held(transport, "d"); !slices.Equal(got, tt.held) {
+				t.Errorf("holding %v, want %v", got, tt.held)
+			}
+			if len(router.requested) != 1 {
+				t.Errorf("requested %d routes, want 1", len(router.requested))
+			}
+		})
+	}
+}
+
+func TestExpirePending(t *testing.T) {
+	tests := []struct {
+		name  string
+		at    time.Duration
+		held  []string
+		other []string
+	}{
+		{"none expired", 10 * time.Second, []string{"d-1", "d-2"}, []string{"e-1"}},
+		{"oldest expired", 12 * time.Second, []string{"d-2"}, []string{"e-1"}},
+		{"all expired", 16 * time.Second, nil, []string{"e-1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sched := sim.NewScheduler(1)
+			router := &testRouter{routes: make(map[string]string)}
+			transport := NewTransportLayer(sched, 64)
+
+			sched.At(time.Second, func() { originate(transport, router, sim.NewQueue(), "d", 1) })
+			sched.At(5*time.Second, func() { originate(transport, router, sim.NewQueue(), "d", 2) })
+			sched.At(8*time.Second, func() { originate(transport, router, sim.NewQueue(), "e", 1) })
+			sched.Run(tt.at)
+
+			transport.ExpirePending("a", router.PendingTimeout())
+
+			if got := held(transport, "d"); !slices.Equal(got, tt.held) {
+				t.Errorf("holding %v for d, want %v", got, tt.held)
+			}
+			if _, waiting := transport.Pending["d"]; waiting != (tt.held != nil) {
+				t.Errorf("discovery for d still running: %v, want %v", waiting, tt.held != nil)
+			}
+			if got := held(transport, "e"); !slices.Equal(got, tt.other) {
+				t.Errorf("holding %v for e, want %v", got, tt.other)
+			}
+		})
+	}
+}
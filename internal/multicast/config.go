@@ -0,0 +1,35 @@
+package multicast
+
+import "time"
+
+// Config sets how members announce their groups and how far group traffic
+// travels
+type Config struct {
+	// AnnounceInterval is how often a member floods the groups it belongs
+	// to, one that isn't heard from for MemberTimeout is taken to have gone
+	AnnounceInterval time.Duration
+	MemberTimeout    time.Duration
+	// TTL is how many hops announcements and group packets travel
+	TTL int
+	// DupHoldTime is how long a group packet is remembered so copies of it
+	// aren't handled again
+	DupHoldTime time.Duration
+}
+
+// WithDefaults returns the config with every zero field set to its default
+func (c Config) WithDefaults() Config {
+	if c.AnnounceInterval == 0 {
+		c.AnnounceInterval = 5 * time.Second
+	}
+	if c.MemberTimeout == 0 {
+		c.MemberTimeout = 3 * c.AnnounceInterval
+	}
+	if c.TTL == 0 {
+		c.TTL = 16
+	}
+	if c.DupHoldTime == 0 {
+		c.DupHoldTime = 30 * time.Second
+	}
+
+	return c
+}
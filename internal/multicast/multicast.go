@@ -0,0 +1,316 @@
+package multicast
+
+import (
+	"encoding/json"
+	"log"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/azaurus1/swarm/internal/sim"
+	"github.com/azaurus1/swarm/internal/types"
+)
+
+// MulticastLayer delivers DATA packets to every member of a group. Members
+// flood announcements of their groups so every drone knows how many hops
+// away each member is, and a group packet is only passed on by drones that
+// are closer to one of its members than the drone they heard it from. A
+// packet whose sender knows of no members yet is flooded instead.
+type MulticastLayer struct {
+	Config Config
+	Clock  sim.Clock
+	// Groups are the groups we belong to
+	Groups map[string]bool
+	// Members are the drones we have heard announce groups, by ID
+	Members map[string]*Member
+	// ReceivedMessages are the group packets handled in the last
+	// DupHoldTime, by checksum
+	ReceivedMessages map[string]time.Time
+
+	// the drone we run on, its radio and the scheduler, set by Start
+	droneId    string
+	radioQueue *sim.Queue
+	sched      *sim.Scheduler
+
+	// our announcement sequence number, and whether they are scheduled yet
+	sequenceNumber int
+	announcing     bool
+}
+
+// A Member is a drone that belongs to at least one group
+type Member struct {
+	ID     string
+	Groups []string
+	// Hops is how far away it is, along the shortest way its announcement
+	// came
+	Hops           int
+	SequenceNumber int
+	LastHeard      time.Time
+}
+
+func NewMulticastLayer(config Config, clock sim.Clock) *MulticastLayer {
+	return &MulticastLayer{
+		Config:           config.WithDefaults(),
+		Clock:            clock,
+		Groups:           make(map[string]bool),
+		Members:          make(map[string]*Member),
+		ReceivedMessages: make(map[string]time.Time),
+	}
+}
+
+// Start binds the layer to the drone, it starts out in groups. Drones that
+// belong to no group send nothing until they join one.
+func (m *MulticastLayer) Start(droneId string, groups []string, sched *sim.Scheduler, radioQueue *sim.Queue) {
+	m.droneId = droneId
+	m.radioQueue = radioQueue
+	m.sched = sched
+
+	for _, group := range groups {
+		m.Groups[group] = true
+	}
+	if len(m.Groups) > 0 {
+		m.scheduleAnnouncements()
+	}
+}
+
+// scheduleAnnouncements starts the periodic announcements, offset by a
+// random fraction of their interval so members don't all transmit at once
+func (m *MulticastLayer) scheduleAnnouncements() {
+	if m.announcing {
+		return
+	}
+	m.announcing = true
+
+	offset := time.Duration(m.sched.Rand.Int63n(int64(m.Config.AnnounceInterval)))
+	m.sched.Every(offset, m.Config.AnnounceInterval, func() {
+		if len(m.Groups) > 0 {
+			m.announce()
+		}
+	})
+}
+
+// Join adds us to group and tells the swarm right away
+func (m *MulticastLayer) Join(group string) {
+	if m.Groups[group] {
+		return
+	}
+
+	log.Printf("%s: joining group %s", m.droneId, group)
+
+	m.Groups[group] = true
+	m.announce()
+	m.scheduleAnnouncements()
+}
+
+// Leave takes us out of group, the announcement without it tells the swarm
+func (m *MulticastLayer) Leave(group string) {
+	if !m.Groups[group] {
+		return
+	}
+
+	log.Printf("%s: leaving group %s", m.droneId, group)
+
+	delete(m.Groups, group)
+	m.announce()
+}
+
+// announce floods the groups we belong to
+func (m *MulticastLayer) announce() {
+	m.sequenceNumber = seqNext(m.sequenceNumber)
+
+	m.send("GROUP", types.DroneMessage{
+		GroupPayload: &types.GroupMessage{
+			Member:         m.droneId,
+			Groups:         sortedKeys(m.Groups),
+			SequenceNumber: m.sequenceNumber,
+			TTL:            m.Config.TTL,
+		},
+	})
+}
+
+// HandleAnnouncement records a member's groups and passes the announcement
+// on. A later copy of one we already have is only passed on if it came a
+// shorter way, so the drones beyond us learn the shorter distance too.
+func (m *MulticastLayer) HandleAnnouncement(droneMsg types.DroneMessage) {
+	g := droneMsg.GroupPayload
+	if g == nil || g.Member == m.droneId {
+		return
+	}
+
+	hops := g.HopCount + 1
+
+	if member, known := m.Members[g.Member]; known && !seqNewer(g.SequenceNumber, member.SequenceNumber) {
+		if g.SequenceNumber == member.SequenceNumber && hops < member.Hops {
+			member.Hops = hops
+			m.forward(*g, hops)
+		}
+		return
+	}
+
+	if len(g.Groups) == 0 {
+		if _, known := m.Members[g.Member]; known {
+			log.Printf("%s: %s left its groups", m.droneId, g.Member)
+		}
+		// kept with no groups so older copies of its announcements don't
+		// bring it back
+		m.Members[g.Member] = &Member{ID: g.Member, SequenceNumber: g.SequenceNumber, LastHeard: m.Clock.Now()}
+	} else {
+		m.Members[g.Member] = &Member{
+			ID:             g.Member,
+			Groups:         g.Groups,
+			Hops:           hops,
+			SequenceNumber: g.SequenceNumber,
+			LastHeard:      m.Clock.Now(),
+		}
+	}
+
+	m.forward(*g, hops)
+}
+
+// forward passes an announcement on, hops from its member, while its TTL
+// lasts
+func (m *MulticastLayer) forward(g types.GroupMessage, hops int) {
+	if g.TTL <= 1 {
+		return
+	}
+
+	g.HopCount = hops
+	g.TTL--
+	m.send("GROUP", types.DroneMessage{GroupPayload: &g})
+}
+
+// Expire forgets the members we haven't heard from for MemberTimeout and
+// the group packets handled more than DupHoldTime ago
+func (m *MulticastLayer) Expire() {
+	for id, received := range m.ReceivedMessages {
+		if m.Clock.Now().Sub(received) > m.Config.DupHoldTime {
+			delete(m.ReceivedMessages, id)
+		}
+	}
+
+	for _, id := range sortedKeys(m.Members) {
+		if m.Clock.Now().Sub(m.Members[id].LastHeard) > m.Config.MemberTimeout {
+			if len(m.Members[id].Groups) > 0 {
+				log.Printf("%s: member %s timed out", m.droneId, id)
+			}
+			delete(m.Members, id)
+		}
+	}
+}
+
+// HandleData delivers a group packet if we are a member and passes it on if
+// it gets closer to a member that way, a packet of our own goes out to
+// every member we know of
+func (m *MulticastLayer) HandleData(droneMsg types.DroneMessage) {
+	dMsg := droneMsg.DataPayload
+
+	if _, exists := m.ReceivedMessages[dMsg.Checksum]; exists {
+		return
+	}
+	m.ReceivedMessages[dMsg.Checksum] = m.Clock.Now()
+
+	ours := m.memberHops(dMsg.Group)
+
+	if dMsg.SenderID == m.droneId {
+		if !m.otherMembers(ours) {
+			log.Printf("%s: no members of %s known, flooding", m.droneId, dMsg.Group)
+			ours = nil
+		}
+		dMsg.TTL = m.Config.TTL
+	} else {
+		if m.Groups[dMsg.Group] {
+			log.Printf("%s - I have received a multicast message for %s", m.droneId, dMsg.Group)
+		}
+
+		if dMsg.TTL <= 1 || !m.closer(ours, dMsg.MemberHops) {
+			return
+		}
+		dMsg.TTL--
+
+		// a flooded packet stays flooded, the drones it reaches may not
+		// know the members either
+		if len(dMsg.MemberHops) == 0 {
+			ours = nil
+		}
+	}
+
+	dMsg.MemberHops = ours
+	droneMsg.DataPayload = dMsg
+	m.send("MULTICAST", droneMsg)
+}
+
+// memberHops is how far away each member of group we know of is, we are
+// no hops away if we are one
+func (m *MulticastLayer) memberHops(group string) map[string]int {
+	hops := make(map[string]int)
+	for _, id := range sortedKeys(m.Members) {
+		if member := m.Members[id]; slices.Contains(member.Groups, group) {
+			hops[id] = member.Hops
+		}
+	}
+	if m.Groups[group] {
+		hops[m.droneId] = 0
+	}
+
+	return hops
+}
+
+// otherMembers is true if hops has members other than us
+func (m *MulticastLayer) otherMembers(hops map[string]int) bool {
+	_, self := hops[m.droneId]
+
+	return len(hops) > 0 && !(len(hops) == 1 && self)
+}
+
+// closer is true if the packet gets closer to some member other than us
+// through us than it was at the drone we heard it from, or if that drone
+// flooded it
+func (m *MulticastLayer) closer(ours map[string]int, theirs map[string]int) bool {
+	if len(theirs) == 0 {
+		return true
+	}
+
+	for id, hops := range ours {
+		if their, known := theirs[id]; id != m.droneId && (!known || hops < their) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// send broadcasts droneMsg as a frame of the given type
+func (m *MulticastLayer) send(msgType string, droneMsg types.DroneMessage) {
+	droneMsg.Source = m.droneId
+	droneMsg.NextHop = ""
+	droneMsg.Type = msgType
+
+	data, err := json.Marshal(droneMsg)
+	if err != nil {
+		log.Println("error marshalling multicast message ", err)
+	}
+
+	m.radioQueue.Push(data)
+}
+
+// announcement sequence numbers are 32 bit and roll over like AODV's, a is
+// newer than b if the signed difference is positive (RFC3561 6.1)
+func seqNewer(a int, b int) bool {
+	return int32(uint32(a)-uint32(b)) > 0
+}
+
+func seqNext(s int) int {
+	return int(uint32(s) + 1)
+}
+
+// map iteration order is random, walk maps in key order so runs stay
+// reproducible
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,126 @@
+package multicast
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/azaurus1/swarm/internal/sim"
+	"github.com/azaurus1/swarm/internal/types"
+)
+
+const maxSeq = 1<<32 - 1
+
+func TestHandleAnnouncement(t *testing.T) {
+	tests := []struct {
+		name string
+		// what we know of member m before the announcement, if anything
+		known     *Member
+		announced types.GroupMessage
+		hops      int
+		forwarded bool
+	}{
+		{
+			name:      "new member",
+			announced: types.GroupMessage{Member: "m", Groups: []string{"g"}, SequenceNumber: 1, HopCount: 2, TTL: 16},
+			hops:      3,
+			forwarded: true,
+		},
+		{
+			name:      "newer announcement",
+			known:     &Member{ID: "m", Groups: []string{"g"}, Hops: 1, SequenceNumber: 1},
+			announced: types.GroupMessage{Member: "m", Groups: []string{"g"}, SequenceNumber: 2, HopCount: 4, TTL: 16},
+			hops:      5,
+			forwarded: true,
+		},
+		{
+			name:      "newer across rollover",
+			known:     &Member{ID: "m", Groups: []string{"g"}, Hops: 1, SequenceNumber: maxSeq},
+			announced: types.GroupMessage{Member: "m", Groups: []string{"g"}, SequenceNumber: 0, HopCount: 4, TTL: 16},
+			hops:      5,
+			forwarded: true,
+		},
+		{
+			name:      "older announcement",
+			known:     &Member{ID: "m", Groups: []string{"g"}, Hops: 4, SequenceNumber: 0},
+			announced: types.GroupMessage{Member: "m", Groups: []string{"g"}, SequenceNumber: maxSeq, HopCount: 1, TTL: 16},
+			hops:      4,
+			forwarded: false,
+		},
+		{
+			name:      "same announcement, shorter way",
+			known:     &Member{ID: "m", Groups: []string{"g"}, Hops: 4, SequenceNumber: 7},
+			announced: types.GroupMessage{Member: "m", Groups: []string{"g"}, SequenceNumber: 7, HopCount: 1, TTL: 16},
+			hops:      2,
+			forwarded: true,
+		},
+		{
+			name:      "same announcement, longer way",
+			known:     &Member{ID: "m", Groups: []string{"g"}, Hops: 2, SequenceNumber: 7},
+			announced: types.GroupMessage{Member: "m", Groups: []string{"g"}, SequenceNumber: 7, HopCount: 3, TTL: 16},
+			hops:      2,
+			forwarded: false,
+		},
+		{
+			name:      "out of hops",
+			announced: types.GroupMessage{Member: "m", Groups: []string{"g"}, SequenceNumber: 1, HopCount: 2, TTL: 1},
+			hops:      3,
+			forwarded: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sched := sim.NewScheduler(1)
+			queue := sim.NewQueue()
+			m := NewMulticastLayer(Config{}, sched)
+			m.Start("a", nil, sched, queue)
+			if tt.known != nil {
+				m.Members["m"] = tt.known
+			}
+
+			announced := tt.announced
+			m.HandleAnnouncement(types.DroneMessage{Source: "n", Type: "GROUP", GroupPayload: &announced})
+
+			if hops := m.Members["m"].Hops; hops != tt.hops {
+				t.Errorf("m is %d hops away, want %d", hops, tt.hops)
+			}
+
+			frame, sent := queue.Pop()
+			if sent != tt.forwarded {
+				t.Fatalf("forwarded %v, want %v", sent, tt.forwarded)
+			}
+			if !sent {
+				return
+			}
+
+			var msg types.DroneMessage
+			if err := json.Unmarshal(frame, &msg); err != nil {
+				t.Fatal(err)
+			}
+			if g := msg.GroupPayload; g.HopCount != tt.hops || g.TTL != tt.announced.TTL-1 {
+				t.Errorf("forwarded with %d hops and TTL %d, want %d and %d", g.HopCount, g.TTL, tt.hops, tt.announced.TTL-1)
+			}
+		})
+	}
+}
+
+func TestExpireReceivedMessages(t *testing.T) {
+	sched := sim.NewScheduler(1)
+	m := NewMulticastLayer(Config{DupHoldTime: 10 * time.Second}, sched)
+	m.Start("a", nil, sched, sim.NewQueue())
+
+	m.ReceivedMessages["old"] = sched.Now()
+	sched.Run(6 * time.Second)
+	m.ReceivedMessages["new"] = sched.Now()
+	sched.Run(11 * time.Second)
+
+	m.Expire()
+
+	if _, kept := m.ReceivedMessages["old"]; kept {
+		t.Error("packet handled 11s ago still remembered")
+	}
+	if _, kept := m.ReceivedMessages["new"]; !kept {
+		t.Error("packet handled 5s ago forgotten")
+	}
+}
@@ -0,0 +1,72 @@
+package radio
+
+import (
+	"sort"
+)
+
+// A LossModel gives the probability that a frame is lost on a link of the
+// given quality, as returned by calculateLinkQuality.
+type LossModel interface {
+	LossProbability(quality float64) float64
+}
+
+// LinkQualityLoss loses frames with probability 1 - quality, so links at the
+// edge of range lose almost everything and drones on top of each other
+// lose nothing.
+type LinkQualityLoss struct{}
+
+func (LinkQualityLoss) LossProbability(quality float64) float64 {
+	return clamp01(1 - quality)
+}
+
+// PERPoint is a single point of a packet error rate curve.
+type PERPoint struct {
+	Quality float64
+	PER     float64
+}
+
+// PERCurve interpolates linearly between configured points, qualities
+// outside the curve take the PER of the nearest end.
+type PERCurve []PERPoint
+
+func NewPERCurve(points []PERPoint) PERCurve {
+	curve := make(PERCurve, len(points))
+	copy(curve, points)
+
+	sort.Slice(curve, func(i, j int) bool {
+		return curve[i].Quality < curve[j].Quality
+	})
+
+	return curve
+}
+
+func (c PERCurve) LossProbability(quality float64) float64 {
+	if len(c) == 0 {
+		return 0
+	}
+
+	if quality <= c[0].Quality {
+		return clamp01(c[0].PER)
+	}
+
+	for i := 1; i < len(c); i++ {
+		if quality <= c[i].Quality {
+			lo, hi := c[i-1], c[i]
+			t := (quality - lo.Quality) / (hi.Quality - lo.Quality)
+
+			return clamp01(lo.PER + t*(hi.PER-lo.PER))
+		}
+	}
+
+	return clamp01(c[len(c)-1].PER)
+}
+
+func clamp01(v float64) float64 {
+	if v < 0 {
+		return 0
+	}
+	if v > 1 {
+		return 1
+	}
+	return v
+}
@@ -0,0 +1,119 @@
+package radio
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/azaurus1/swarm/internal/drone"
+	"github.com/azaurus1/swarm/internal/sim"
+)
+
+func TestPERCurve(t *testing.T) {
+	// given out of order, NewPERCurve sorts by quality
+	curve := NewPERCurve([]PERPoint{
+		{Quality: 0.9, PER: 0.05},
+		{Quality: 0.1, PER: 0.8},
+		{Quality: 0.5, PER: 0.2},
+	})
+
+	tests := []struct {
+		name    string
+		quality float64
+		per     float64
+	}{
+		{"out of range", 0, 0.8},
+		{"below the curve", 0.05, 0.8},
+		{"first point", 0.1, 0.8},
+		{"between the first two", 0.3, 0.5},
+		{"middle point", 0.5, 0.2},
+		{"between the last two", 0.7, 0.125},
+		{"last point", 0.9, 0.05},
+		{"above the curve", 0.95, 0.05},
+		{"on top of each other", 1, 0.05},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if per := curve.LossProbability(tt.quality); math.Abs(per-tt.per) > 1e-9 {
+				t.Errorf("LossProbability(%g) = %g, want %g", tt.quality, per, tt.per)
+			}
+		})
+	}
+}
+
+func TestPERCurveClamped(t *testing.T) {
+	tests := []struct {
+		name    string
+		curve   PERCurve
+		quality float64
+		per     float64
+	}{
+		{"empty curve is lossless", NewPERCurve(nil), 0.5, 0},
+		{"single point", NewPERCurve([]PERPoint{{Quality: 0.5, PER: 0.3}}), 0.9, 0.3},
+		{"above one", PERCurve{{Quality: 0, PER: 1.5}}, 0, 1},
+		{"below zero", PERCurve{{Quality: 0, PER: -0.5}}, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if per := tt.curve.LossProbability(tt.quality); per != tt.per {
+				t.Errorf("LossProbability(%g) = %g, want %g", tt.quality, per, tt.per)
+			}
+		})
+	}
+}
+
+func TestLinkQualityLoss(t *testing.T) {
+	tests := []struct {
+		quality float64
+		loss    float64
+	}{
+		{0, 1},
+		{0.25, 0.75},
+		{1, 0},
+	}
+
+	for _, tt := range tests {
+		if loss := (LinkQualityLoss{}).LossProbability(tt.quality); math.Abs(loss-tt.loss) > 1e-9 {
+			t.Errorf("LossProbability(%g) = %g, want %g", tt.quality, loss, tt.loss)
+		}
+	}
+}
+
+func TestDelay(t *testing.T) {
+	// 300km apart, a millisecond at the speed of light
+	distance := 300e3
+	propagation := time.Duration(distance / speedOfLight * float64(time.Second))
+
+	tests := []struct {
+		name       string
+		processing time.Duration
+		jitter     time.Duration
+	}{
+		{"propagation only", 0, 0},
+		{"processing", 2 * time.Millisecond, 0},
+		{"jitter", 2 * time.Millisecond, 5 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Radio{
+				Drones: map[string]*drone.Drone{
+					"a": {Id: "a"},
+					"b": {Id: "b", X: distance},
+				},
+				ProcessingDelay: tt.processing,
+				Jitter:          tt.jitter,
+				sched:           sim.NewScheduler(1),
+			}
+
+			least := propagation + tt.processing
+			for range 100 {
+				if delay := r.delay("a", "b"); delay < least || delay > least+tt.jitter {
+					t.Fatalf("delay %s, want between %s and %s", delay, least, least+tt.jitter)
+				}
+			}
+		})
+	}
+}
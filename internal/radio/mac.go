@@ -0,0 +1,274 @@
+package radio
+
+import (
+	"log"
+	"time"
+)
+
+// MAC configures a CSMA/CA medium access layer in the style of 802.11 DCF
+// broadcast. A drone waits DIFS plus a random backoff before sending, defers
+// while it can hear another transmission and, being half-duplex, can't
+// receive while it is transmitting. A frame is lost at a receiver if any
+// other frame the receiver can hear overlaps it, which is how hidden
+// terminals collide.
+type MAC struct {
+	// Bitrate is in bits per second
+	Bitrate float64
+	// HeaderBytes is the PHY and MAC overhead added to every frame
+	HeaderBytes int
+	SlotTime    time.Duration
+	DIFS        time.Duration
+	CWMin       int
+	CWMax       int
+	// QueueLimit caps each drone's transmit queue, frames beyond it are dropped
+	QueueLimit int
+}
+
+// Airtime is how long a frame with a payload of size bytes occupies the medium
+func (m *MAC) Airtime(size int) time.Duration {
+	bits := float64(8 * (m.HeaderBytes + size))
+
+	return time.Duration(bits / m.Bitrate * float64(time.Second))
+}
+
+type frame struct {
+	msg     []byte
+	nextHop string
+	retries int
+}
+
+type macState struct {
+	queue []frame
+	// busy is set while an access attempt is scheduled or a frame is on the air
+	busy bool
+	cw   int
+}
+
+type transmission struct {
+	source     string
+	frame      frame
+	end        time.Duration
+	receptions []*reception
+	// powers at every other drone, only kept with SINR reception
+	powers map[string]float64
+}
+
+type reception struct {
+	target    string
+	corrupted bool
+	// power and the worst interference seen so far, in dBm and mW
+	power        float64
+	interference float64
+}
+
+func (t *transmission) reception(target string) *reception {
+	for _, rec := range t.receptions {
+		if rec.target == target {
+			return rec
+		}
+	}
+	return nil
+}
+
+func (r *Radio) enqueue(source string, nextHop string, msg []byte) {
+	st := r.macStates[source]
+
+	if len(st.queue) >= r.MAC.QueueLimit {
+		log.Printf("drone %s transmit queue full, dropping frame", source)
+		r.Stats.Lost++
+		return
+	}
+
+	st.queue = append(st.queue, frame{msg: msg, nextHop: nextHop})
+
+	if !st.busy {
+		st.cw = r.MAC.CWMin
+		r.scheduleAccess(source, r.sched.Elapsed())
+	}
+}
+
+// scheduleAccess waits DIFS and a random backoff from after, then tries to
+// take the medium
+func (r *Radio) scheduleAccess(source string, after time.Duration) {
+	st := r.macStates[source]
+	st.busy = true
+
+	backoff := time.Duration(r.sched.Rand.Intn(st.cw+1)) * r.MAC.SlotTime
+
+	r.sched.At(after+r.MAC.DIFS+backoff, func() {
+		r.access(source)
+	})
+}
+
+func (r *Radio) access(source string) {
+	st := r.macStates[source]
+
+	if until, busy := r.carrierSense(source); busy {
+		// medium busy, defer until it is free and back off with a larger window
+		st.cw = min(2*st.cw+1, r.MAC.CWMax)
+		r.scheduleAccess(source, until)
+		return
+	}
+
+	f := st.queue[0]
+	st.queue = st.queue[1:]
+
+	r.startTransmission(source, f)
+}
+
+// carrierSense reports whether source can hear a transmission in progress,
+// and when the last one it can hear ends
+func (r *Radio) carrierSense(source string) (time.Duration, bool) {
+	var until time.Duration
+	busy := false
+
+	if r.SINR != nil {
+		if !r.energyDetect(source) {
+			return 0, false
+		}
+		for _, tx := range r.air {
+			until = max(until, tx.end)
+		}
+		return until, true
+	}
+
+	for _, tx := range r.air {
+		if tx.source == source || tx.reception(source) != nil {
+			busy = true
+			until = max(until, tx.end)
+		}
+	}
+
+	return until, busy
+}
+
+func (r *Radio) transmitting(id string) bool {
+	for _, tx := range r.air {
+		if tx.source == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Radio) startTransmission(source string, f frame) {
+	r.Stats.Transmissions++
+
+	tx := &transmission{
+		source: source,
+		frame:  f,
+		end:    r.sched.Elapsed() + r.MAC.Airtime(len(f.msg)),
+	}
+
+	if r.SINR != nil {
+		tx.powers = r.receivedPowers(source)
+	}
+
+	for _, id := range r.order {
+		if id == source {
+			continue
+		}
+
+		rec := &reception{
+			target: id,
+			// half-duplex, a drone that is sending can't hear anything
+			corrupted: r.transmitting(id),
+		}
+
+		if r.SINR != nil {
+			if tx.powers[id] < r.Sensitivity {
+				continue
+			}
+			rec.power = tx.powers[id]
+		} else if !r.canReceive(source, id) {
+			continue
+		}
+
+		tx.receptions = append(tx.receptions, rec)
+	}
+
+	for _, other := range r.air {
+		// half-duplex, source stops hearing whatever it was receiving
+		if rec := other.reception(source); rec != nil && !rec.corrupted {
+			rec.corrupted = true
+			log.Printf("drone %s started transmitting while receiving from %s", source, other.source)
+		}
+
+		if r.SINR != nil {
+			// overlaps are settled by the SINR when the frames end
+			continue
+		}
+
+		// both frames are lost wherever they overlap
+		for _, rec := range tx.receptions {
+			otherRec := other.reception(rec.target)
+			if otherRec == nil {
+				continue
+			}
+
+			if !rec.corrupted || !otherRec.corrupted {
+				log.Printf("collision at %s between %s and %s", rec.target, source, other.source)
+				r.Stats.Collisions++
+			}
+			rec.corrupted = true
+			otherRec.corrupted = true
+		}
+	}
+
+	r.air = append(r.air, tx)
+
+	if r.SINR != nil {
+		r.updateInterference()
+	}
+
+	r.sched.At(tx.end, func() {
+		r.endTransmission(tx)
+	})
+}
+
+func (r *Radio) endTransmission(tx *transmission) {
+	for i, other := range r.air {
+		if other == tx {
+			r.air = append(r.air[:i], r.air[i+1:]...)
+			break
+		}
+	}
+
+	delivered := false
+
+	for _, rec := range tx.receptions {
+		if rec.corrupted {
+			continue
+		}
+		// unicast frames still take up the air everywhere, but only the
+		// next hop picks them up
+		if tx.frame.nextHop != "" && tx.frame.nextHop != rec.target {
+			continue
+		}
+		if r.SINR != nil && !r.decoded(tx, rec) {
+			continue
+		}
+		delivered = r.deliver(tx.source, rec.target, tx.frame.msg) || delivered
+	}
+
+	st := r.macStates[tx.source]
+	st.cw = r.MAC.CWMin
+
+	if tx.frame.nextHop != "" && !delivered {
+		if tx.frame.retries < r.RetryLimit {
+			// no ack, retry at the head of the queue with a larger window
+			f := tx.frame
+			f.retries++
+			st.queue = append([]frame{f}, st.queue...)
+			st.cw = min((r.MAC.CWMin+1)<<f.retries-1, r.MAC.CWMax)
+		} else {
+			r.linkFailed(tx.source, tx.frame.nextHop, tx.frame.msg)
+		}
+	}
+
+	if len(st.queue) > 0 {
+		r.scheduleAccess(tx.source, r.sched.Elapsed())
+	} else {
+		st.busy = false
+	}
+}
@@ -0,0 +1,161 @@
+package radio
+
+import (
+	"encoding/json"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/azaurus1/swarm/internal/drone"
+	"github.com/azaurus1/swarm/internal/routing"
+	"github.com/azaurus1/swarm/internal/sim"
+	"github.com/azaurus1/swarm/internal/types"
+)
+
+// listener is a routing protocol that sends nothing and records the drones
+// it hears frames from
+type listener struct {
+	heard []string
+}
+
+func (l *listener) Name() string                                   { return "TEST" }
+func (l *listener) Start(routing.Node, *sim.Scheduler, *sim.Queue) {}
+func (l *listener) HandleMessage(msg types.DroneMessage)           { l.heard = append(l.heard, msg.Source) }
+func (l *listener) Tick()                                          {}
+func (l *listener) TickInterval() time.Duration                    { return time.Second }
+func (l *listener) PendingTimeout() time.Duration                  { return time.Second }
+func (l *listener) HeardFrom(string)                               {}
+func (l *listener) LinkFailed(string)                              {}
+func (l *listener) NextHop(string) (string, bool)                  { return "", false }
+func (l *listener) RequestRoute(string)                            {}
+func (l *listener) Repairing(string) bool                          { return false }
+func (l *listener) Unreachable(string, string)                     {}
+func (l *listener) SetRouteEvents(routing.RouteEvents)             {}
+
+// testMAC is the scenario defaults, a frame takes around a millisecond
+// which is longer than the largest backoff
+func testMAC() *MAC {
+	return &MAC{
+		Bitrate:     1e6,
+		HeaderBytes: 52,
+		SlotTime:    20 * time.Microsecond,
+		DIFS:        50 * time.Microsecond,
+		CWMin:       31,
+		CWMax:       1023,
+		QueueLimit:  256,
+	}
+}
+
+// serve starts drones along the x axis at the given positions, all with the
+// same transmission range, and hooks r up to them
+func serve(r *Radio, positions map[string]float64, transmissionRange float64) (*sim.Scheduler, *sim.Queue, map[string]*listener) {
+	sched := sim.NewScheduler(1)
+	queue := sim.NewQueue()
+	listeners := make(map[string]*listener)
+
+	r.Drones = make(map[string]*drone.Drone)
+	for _, id := range slices.Sorted(maps.Keys(positions)) {
+		x := positions[id]
+		listeners[id] = &listener{}
+		r.Drones[id] = &drone.Drone{Id: id, X: x, TransmissionRange: transmissionRange, Routing: listeners[id]}
+		if r.Model != nil {
+			r.Drones[id].TxPower = CalibratedTxPower(r.Model, r.Sensitivity, transmissionRange)
+		}
+		r.Drones[id].Start(sched, queue)
+	}
+	r.Serve(sched, queue)
+
+	return sched, queue, listeners
+}
+
+// broadcast has source send a frame at the given time
+func broadcast(sched *sim.Scheduler, queue *sim.Queue, at time.Duration, source string) {
+	frame, _ := json.Marshal(types.DroneMessage{Source: source, Type: "TEST"})
+	sched.At(at, func() {
+		queue.Push(frame)
+	})
+}
+
+func TestAirtime(t *testing.T) {
+	tests := []struct {
+		size    int
+		airtime time.Duration
+	}{
+		{0, 416 * time.Microsecond},
+		{100, 1216 * time.Microsecond},
+		{1000, 8416 * time.Microsecond},
+	}
+
+	for _, tt := range tests {
+		if airtime := testMAC().Airtime(tt.size); airtime != tt.airtime {
+			t.Errorf("Airtime(%d) = %s, want %s", tt.size, airtime, tt.airtime)
+		}
+	}
+}
+
+func TestCollisions(t *testing.T) {
+	tests := []struct {
+		name      string
+		positions map[string]float64
+		senders   []string
+		// at is when each sender transmits
+		at         []time.Duration
+		heard      map[string][]string
+		collisions bool
+	}{
+		{
+			name:      "alone on the air",
+			positions: map[string]float64{"a": 0, "b": 10, "c": 20},
+			senders:   []string{"a"},
+			at:        []time.Duration{0},
+			heard:     map[string][]string{"b": {"a"}},
+		},
+		{
+			// a and c can't hear each other, so both send and their
+			// frames collide at b
+			name:       "hidden terminals",
+			positions:  map[string]float64{"a": 0, "b": 10, "c": 20},
+			senders:    []string{"a", "c"},
+			at:         []time.Duration{0, 0},
+			heard:      map[string][]string{},
+			collisions: true,
+		},
+		{
+			// c hears a and defers until its frame is over
+			name:      "carrier sense",
+			positions: map[string]float64{"a": 0, "b": 5, "c": 10},
+			senders:   []string{"a", "c"},
+			at:        []time.Duration{0, 200 * time.Microsecond},
+			heard:     map[string][]string{"a": {"c"}, "b": {"a", "c"}, "c": {"a"}},
+		},
+		{
+			name:      "one after the other",
+			positions: map[string]float64{"a": 0, "b": 10, "c": 20},
+			senders:   []string{"a", "c"},
+			at:        []time.Duration{0, 10 * time.Millisecond},
+			heard:     map[string][]string{"b": {"a", "c"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Radio{MAC: testMAC()}
+			sched, queue, listeners := serve(r, tt.positions, 12)
+
+			for i, source := range tt.senders {
+				broadcast(sched, queue, tt.at[i], source)
+			}
+			sched.Run(100 * time.Millisecond)
+
+			for id, l := range listeners {
+				if !slices.Equal(l.heard, tt.heard[id]) {
+					t.Errorf("%s heard %v, want %v", id, l.heard, tt.heard[id])
+				}
+			}
+			if collided := r.Stats.Collisions > 0; collided != tt.collisions {
+				t.Errorf("%d collisions, want collisions %v", r.Stats.Collisions, tt.collisions)
+			}
+		})
+	}
+}
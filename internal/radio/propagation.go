@@ -0,0 +1,160 @@
+package radio
+
+import (
+	"math"
+	"math/rand"
+)
+
+const speedOfLight = 299792458.0
+
+// minDistance keeps the logarithms in the path loss models finite when two
+// drones are on top of each other
+const minDistance = 1e-3
+
+// A PropagationModel decides how much of a transmitter's power arrives at a
+// receiver. Distances are in the same units as the drones' positions and are
+// treated as metres, powers and losses are in dB.
+type PropagationModel interface {
+	// PathLoss returns the mean loss over distance
+	PathLoss(distance float64) float64
+	// Fading returns the random variation, in dB, on top of the mean
+	// received power for a single transmission
+	Fading(rng *rand.Rand) float64
+}
+
+// CalibratedTxPower returns the transmit power at which the mean received
+// power at transmissionRange is exactly sensitivity, so a drone's
+// TransmissionRange keeps its meaning whatever model is in use.
+func CalibratedTxPower(model PropagationModel, sensitivity float64, transmissionRange float64) float64 {
+	return sensitivity + model.PathLoss(transmissionRange)
+}
+
+// FreeSpace is the Friis free space model, loss grows with the square of the
+// distance and there is no randomness.
+type FreeSpace struct {
+	FrequencyHz float64
+}
+
+func NewFreeSpace(frequencyHz float64) *FreeSpace {
+	return &FreeSpace{FrequencyHz: frequencyHz}
+}
+
+func (m *FreeSpace) PathLoss(distance float64) float64 {
+	return freeSpaceLoss(distance, m.FrequencyHz)
+}
+
+func (m *FreeSpace) Fading(rng *rand.Rand) float64 {
+	return 0
+}
+
+// LogDistance generalises free space with a path loss exponent measured from
+// a reference distance, and adds log-normal shadowing with a standard
+// deviation of ShadowingSigma dB.
+type LogDistance struct {
+	ReferenceDistance float64
+	ReferenceLoss     float64
+	Exponent          float64
+	ShadowingSigma    float64
+}
+
+// NewLogDistance uses the free space loss at referenceDistance as the
+// reference loss.
+func NewLogDistance(frequencyHz, referenceDistance, exponent, shadowingSigma float64) *LogDistance {
+	return &LogDistance{
+		ReferenceDistance: referenceDistance,
+		ReferenceLoss:     freeSpaceLoss(referenceDistance, frequencyHz),
+		Exponent:          exponent,
+		ShadowingSigma:    shadowingSigma,
+	}
+}
+
+func (m *LogDistance) PathLoss(distance float64) float64 {
+	distance = math.Max(distance, minDistance)
+
+	return m.ReferenceLoss + 10*m.Exponent*math.Log10(distance/m.ReferenceDistance)
+}
+
+func (m *LogDistance) Fading(rng *rand.Rand) float64 {
+	if m.ShadowingSigma == 0 {
+		return 0
+	}
+
+	return rng.NormFloat64() * m.ShadowingSigma
+}
+
+// TwoRayGround combines the direct path with the ground reflection. Below
+// the crossover distance the reflection doesn't matter and it is free space,
+// beyond it loss grows with the fourth power of the distance.
+type TwoRayGround struct {
+	FrequencyHz float64
+	TxHeight    float64
+	RxHeight    float64
+}
+
+func NewTwoRayGround(frequencyHz, antennaHeight float64) *TwoRayGround {
+	return &TwoRayGround{
+		FrequencyHz: frequencyHz,
+		TxHeight:    antennaHeight,
+		RxHeight:    antennaHeight,
+	}
+}
+
+func (m *TwoRayGround) crossover() float64 {
+	wavelength := speedOfLight / m.FrequencyHz
+
+	return 4 * math.Pi * m.TxHeight * m.RxHeight / wavelength
+}
+
+func (m *TwoRayGround) PathLoss(distance float64) float64 {
+	if distance < m.crossover() {
+		return freeSpaceLoss(distance, m.FrequencyHz)
+	}
+
+	return 40*math.Log10(distance) - 20*math.Log10(m.TxHeight*m.RxHeight)
+}
+
+func (m *TwoRayGround) Fading(rng *rand.Rand) float64 {
+	return 0
+}
+
+// RicianFading adds small scale multipath fading on top of a large scale
+// model. K is the ratio of line of sight to scattered power, a K of zero
+// has no line of sight component and is Rayleigh fading.
+type RicianFading struct {
+	Base PropagationModel
+	K    float64
+}
+
+func NewRicianFading(base PropagationModel, k float64) *RicianFading {
+	return &RicianFading{Base: base, K: k}
+}
+
+func NewRayleighFading(base PropagationModel) *RicianFading {
+	return &RicianFading{Base: base, K: 0}
+}
+
+func (m *RicianFading) PathLoss(distance float64) float64 {
+	return m.Base.PathLoss(distance)
+}
+
+func (m *RicianFading) Fading(rng *rand.Rand) float64 {
+	// channel gain h = los + scattered, normalised so E[|h|^2] = 1
+	los := math.Sqrt(m.K / (m.K + 1))
+	scatter := math.Sqrt(1 / (2 * (m.K + 1)))
+
+	re := los + scatter*rng.NormFloat64()
+	im := scatter * rng.NormFloat64()
+
+	gain := re*re + im*im
+	if gain < 1e-12 {
+		gain = 1e-12
+	}
+
+	return m.Base.Fading(rng) + 10*math.Log10(gain)
+}
+
+func freeSpaceLoss(distance, frequencyHz float64) float64 {
+	distance = math.Max(distance, minDistance)
+
+	return 20*math.Log10(distance) + 20*math.Log10(frequencyHz) + 20*math.Log10(4*math.Pi/speedOfLight)
+}
@@ -0,0 +1,106 @@
+package radio
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestPathLoss(t *testing.T) {
+	freeSpace := NewFreeSpace(2.4e9)
+	logDistance := NewLogDistance(2.4e9, 1, 3, 0)
+	twoRay := NewTwoRayGround(2.4e9, 1.5)
+
+	tests := []struct {
+		name     string
+		model    PropagationModel
+		distance float64
+		loss     float64
+	}{
+		{"free space 1m", freeSpace, 1, 40.052},
+		{"free space 10m", freeSpace, 10, 60.052},
+		{"free space 100m", freeSpace, 100, 80.052},
+		{"log distance at reference", logDistance, 1, 40.052},
+		{"log distance 10m", logDistance, 10, 70.052},
+		{"log distance 100m", logDistance, 100, 100.052},
+		// the crossover is at 226m with 1.5m antennas at 2.4GHz
+		{"two ray below crossover", twoRay, 100, 80.052},
+		{"two ray 300m", twoRay, 300, 92.041},
+		{"two ray 1000m", twoRay, 1000, 112.956},
+		{"rayleigh keeps the base loss", NewRayleighFading(freeSpace), 10, 60.052},
+		{"rician keeps the base loss", NewRicianFading(logDistance, 4), 10, 70.052},
+		{"on top of each other", freeSpace, 0, freeSpaceLoss(minDistance, 2.4e9)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if loss := tt.model.PathLoss(tt.distance); math.Abs(loss-tt.loss) > 0.001 {
+				t.Errorf("PathLoss(%g) = %.3f, want %.3f", tt.distance, loss, tt.loss)
+			}
+		})
+	}
+}
+
+func TestCalibratedTxPower(t *testing.T) {
+	models := map[string]PropagationModel{
+		"free space":   NewFreeSpace(2.4e9),
+		"log distance": NewLogDistance(2.4e9, 1, 2.7, 4),
+		"two ray":      NewTwoRayGround(2.4e9, 1.5),
+	}
+
+	for name, model := range models {
+		t.Run(name, func(t *testing.T) {
+			tx := CalibratedTxPower(model, -90, 250)
+			if rx := tx - model.PathLoss(250); math.Abs(rx-(-90)) > 1e-9 {
+				t.Errorf("mean received power at range %g dBm, want -90 dBm", rx)
+			}
+		})
+	}
+}
+
+func TestFading(t *testing.T) {
+	const samples = 20000
+
+	tests := []struct {
+		name  string
+		model PropagationModel
+		// mean and standard deviation of the fading in dB, -1 for either
+		// means it isn't checked
+		mean, sigma float64
+	}{
+		{"free space", NewFreeSpace(2.4e9), 0, 0},
+		{"two ray", NewTwoRayGround(2.4e9, 1.5), 0, 0},
+		{"log distance without shadowing", NewLogDistance(2.4e9, 1, 3, 0), 0, 0},
+		{"log distance with shadowing", NewLogDistance(2.4e9, 1, 3, 6), 0, 6},
+		// Rayleigh fading in dB has a mean of -2.5 and a deviation of 5.6
+		{"rayleigh", NewRayleighFading(NewFreeSpace(2.4e9)), -2.51, 5.57},
+		{"rician", NewRicianFading(NewFreeSpace(2.4e9), 4), -1, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rng := rand.New(rand.NewSource(1))
+
+			var sum, sumSq, power float64
+			for range samples {
+				f := tt.model.Fading(rng)
+				sum += f
+				sumSq += f * f
+				power += math.Pow(10, f/10)
+			}
+			mean := sum / samples
+			sigma := math.Sqrt(sumSq/samples - mean*mean)
+
+			if tt.mean != -1 && math.Abs(mean-tt.mean) > 0.1 {
+				t.Errorf("mean fading %.2f dB, want %.2f dB", mean, tt.mean)
+			}
+			if tt.sigma != -1 && math.Abs(sigma-tt.sigma) > 0.1 {
+				t.Errorf("fading deviation %.2f dB, want %.2f dB", sigma, tt.sigma)
+			}
+			// small scale fading is normalised so the mean power is kept
+			if _, rician := tt.model.(*RicianFading); rician && math.Abs(power/samples-1) > 0.05 {
+				t.Errorf("mean power gain %.3f, want 1", power/samples)
+			}
+		})
+	}
+}
@@ -2,11 +2,14 @@ package radio
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"math"
-	"sync"
+	"sort"
+	"time"
 
 	"github.com/azaurus1/swarm/internal/drone"
+	"github.com/azaurus1/swarm/internal/sim"
 	"github.com/azaurus1/swarm/internal/types"
 )
 
@@ -14,51 +17,217 @@ import (
 
 type Radio struct {
 	Drones map[string]*drone.Drone
-}
+	// Model decides reception from received power, a nil model keeps the
+	// hard disk of radius TransmissionRange
+	Model PropagationModel
+	// Sensitivity is the weakest received power, in dBm, that can be decoded
+	Sensitivity float64
+	// Loss drops frames that did reach the receiver, nil is lossless
+	Loss LossModel
+	// ProcessingDelay is added to the propagation delay of every frame, and
+	// a uniformly random jitter of up to Jitter on top of that
+	ProcessingDelay time.Duration
+	Jitter          time.Duration
+	// MAC makes the drones share the medium, nil gives the air unlimited
+	// capacity and every frame arrives as soon as it is sent
+	MAC *MAC
+	// SINR decides reception by signal to interference plus noise ratio,
+	// it needs both Model and MAC
+	SINR *SINR
+	// RetryLimit is how many times a unicast frame is resent before the
+	// sender is told the link to the next hop has failed
+	RetryLimit int
 
-func (r *Radio) Serve(wg *sync.WaitGroup, radioChan chan []byte) {
-	defer wg.Done()
+	Stats Stats
 
-	// in - radioChan
-	// out - drones[i].DataChan
-	wg.Add(1)
-	go func() {
-		for msg := range radioChan {
+	sched *sim.Scheduler
+	order []string
 
-			req := types.DroneMessage{}
+	macStates map[string]*macState
+	air       []*transmission
+}
 
-			// unmarshall
-			json.Unmarshal(msg, &req)
+// Stats counts frames, a frame heard by several drones is one transmission
+// and several deliveries
+type Stats struct {
+	Transmissions int
+	Delivered     int
+	Lost          int
+	Collisions    int
+}
 
-			for _, d := range r.Drones {
-				if req.Source == d.Id {
-					// ignore same id, obviously they are within their own range
-					continue
-				}
+func (s Stats) String() string {
+	return fmt.Sprintf("transmissions=%d delivered=%d lost=%d collisions=%d", s.Transmissions, s.Delivered, s.Lost, s.Collisions)
+}
 
-				if _, exists := r.Drones[req.Source]; !exists {
-					log.Printf("Source drone %s does not exist in r.Drones", req.Source)
-					continue
-				}
+// Serve hooks the radio into the scheduler: after every event whatever the
+// drones transmitted into radioQueue is picked up and a delivery event is
+// scheduled for every drone in range.
+func (r *Radio) Serve(sched *sim.Scheduler, radioQueue *sim.Queue) {
+	r.sched = sched
 
-				inRange := r.calculateTransmission(req.Source, d.Id)
-				if inRange {
-					// log.Printf("drone %s is within range of drone %s", d.Id, req.Source)
-					// marshall to json
-					calcMsg, err := json.Marshal(req)
-					if err != nil {
-						log.Println("error marshalling calculated message: ", err)
-					}
+	// map iteration order is random, deliveries have to happen in the same
+	// order every run
+	r.order = make([]string, 0, len(r.Drones))
+	for id := range r.Drones {
+		r.order = append(r.order, id)
+	}
+	sort.Strings(r.order)
 
-					// forward the message
-					d.DataChan <- calcMsg
-				}
+	r.macStates = make(map[string]*macState)
+	for _, id := range r.order {
+		r.macStates[id] = &macState{}
+	}
 
+	// in - radioQueue
+	// out - drones[i].Receive
+	sched.AfterEvent(func() {
+		for {
+			msg, ok := radioQueue.Pop()
+			if !ok {
+				return
 			}
+			r.transmit(msg)
+		}
+	})
+}
+
+func (r *Radio) transmit(msg []byte) {
+	req := types.DroneMessage{}
+
+	// unmarshall
+	json.Unmarshal(msg, &req)
+
+	if _, exists := r.Drones[req.Source]; !exists {
+		log.Printf("Source drone %s does not exist in r.Drones", req.Source)
+		return
+	}
+
+	// marshall to json
+	calcMsg, err := json.Marshal(req)
+	if err != nil {
+		log.Println("error marshalling calculated message: ", err)
+	}
+
+	if r.MAC != nil {
+		r.enqueue(req.Source, req.NextHop, calcMsg)
+		return
+	}
+
+	if req.NextHop != "" {
+		r.unicast(req.Source, req.NextHop, calcMsg)
+		return
+	}
+
+	r.Stats.Transmissions++
 
+	for _, id := range r.order {
+		if req.Source == id {
+			// ignore same id, obviously they are within their own range
+			continue
 		}
-	}()
 
+		inRange := r.canReceive(req.Source, id)
+		if inRange {
+			// log.Printf("drone %s is within range of drone %s", d.Id, req.Source)
+			r.deliver(req.Source, id, calcMsg)
+		}
+	}
+}
+
+// unicast sends a frame to a single next hop, retrying like a link layer
+// with acknowledgements would
+func (r *Radio) unicast(sourceDroneID string, nextHop string, msg []byte) {
+	if _, exists := r.Drones[nextHop]; exists {
+		for attempt := 0; attempt <= r.RetryLimit; attempt++ {
+			r.Stats.Transmissions++
+
+			if r.canReceive(sourceDroneID, nextHop) && r.deliver(sourceDroneID, nextHop, msg) {
+				return
+			}
+		}
+	}
+
+	r.linkFailed(sourceDroneID, nextHop, msg)
+}
+
+// deliver hands a frame that reached target to the drone, unless it is lost
+// on the way
+func (r *Radio) deliver(sourceDroneID string, targetDroneID string, msg []byte) bool {
+	if r.lost(sourceDroneID, targetDroneID) {
+		log.Printf("frame from %s to %s lost", sourceDroneID, targetDroneID)
+		r.Stats.Lost++
+		return false
+	}
+
+	r.Stats.Delivered++
+
+	// forward the message
+	d := r.Drones[targetDroneID]
+	r.sched.After(r.delay(sourceDroneID, targetDroneID), func() {
+		d.Receive(msg)
+	})
+
+	return true
+}
+
+// linkFailed tells the sender that its next hop never got the frame
+func (r *Radio) linkFailed(sourceDroneID string, nextHop string, msg []byte) {
+	log.Printf("unicast from %s to %s failed after %d retries", sourceDroneID, nextHop, r.RetryLimit)
+
+	d := r.Drones[sourceDroneID]
+	r.sched.After(0, func() {
+		d.LinkFailed(nextHop, msg)
+	})
+}
+
+// canReceive decides whether a single transmission from source reaches
+// target, with a propagation model this is random and can differ between
+// two transmissions on the same link
+func (r *Radio) canReceive(sourceDroneID string, targetDroneID string) bool {
+	if r.Model == nil {
+		return r.calculateTransmission(sourceDroneID, targetDroneID)
+	}
+
+	return r.receivedPower(sourceDroneID, targetDroneID) >= r.Sensitivity
+}
+
+// receivedPower samples the power, in dBm, of a transmission from source
+// arriving at target
+func (r *Radio) receivedPower(sourceDroneID string, targetDroneID string) float64 {
+	source := r.Drones[sourceDroneID]
+	target := r.Drones[targetDroneID]
+
+	distance := math.Hypot(target.X-source.X, target.Y-source.Y)
+
+	return source.TxPower - r.Model.PathLoss(distance) + r.Model.Fading(r.sched.Rand)
+}
+
+// lost decides whether a frame that reached target is corrupted on the way
+func (r *Radio) lost(sourceDroneID string, targetDroneID string) bool {
+	if r.Loss == nil {
+		return false
+	}
+
+	p := r.Loss.LossProbability(r.calculateLinkQuality(sourceDroneID, targetDroneID))
+
+	return r.sched.Rand.Float64() < p
+}
+
+// delay is how long after transmission a frame arrives at target
+func (r *Radio) delay(sourceDroneID string, targetDroneID string) time.Duration {
+	source := r.Drones[sourceDroneID]
+	target := r.Drones[targetDroneID]
+
+	distance := math.Hypot(target.X-source.X, target.Y-source.Y)
+	propagation := time.Duration(distance / speedOfLight * float64(time.Second))
+
+	delay := propagation + r.ProcessingDelay
+	if r.Jitter > 0 {
+		delay += time.Duration(r.sched.Rand.Int63n(int64(r.Jitter)))
+	}
+
+	return delay
 }
 
 func (r *Radio) calculateTransmission(sourceDroneID string, targetDroneID string) bool {
@@ -0,0 +1,94 @@
+package radio
+
+import (
+	"log"
+	"math"
+)
+
+// SINR replaces the MAC's "any overlap is a collision" rule with interference
+// accumulation. Every transmission contributes its received power at every
+// drone, a frame is decoded if its power over the noise floor plus the worst
+// interference seen while it was on the air clears Threshold, so a strong
+// frame captures the receiver over weaker ones. It needs a propagation model
+// for the powers and a MAC for there to be concurrent transmissions.
+type SINR struct {
+	// Threshold is the SINR, in dB, needed to decode a frame
+	Threshold float64
+	// NoiseFloor is the thermal noise at the receiver in dBm
+	NoiseFloor float64
+	// CarrierSense is the total received power, in dBm, at which a drone
+	// considers the medium busy
+	CarrierSense float64
+}
+
+func dBmToMilliwatts(dBm float64) float64 {
+	return math.Pow(10, dBm/10)
+}
+
+func milliwattsToDBm(mw float64) float64 {
+	return 10 * math.Log10(mw)
+}
+
+// receivedPowers samples the power of a transmission from source at every
+// other drone, interference doesn't stop at the sensitivity
+func (r *Radio) receivedPowers(source string) map[string]float64 {
+	powers := make(map[string]float64, len(r.order))
+	for _, id := range r.order {
+		if id == source {
+			continue
+		}
+		powers[id] = r.receivedPower(source, id)
+	}
+
+	return powers
+}
+
+// interferenceAt sums the power at target of everything on the air except tx
+func (r *Radio) interferenceAt(target string, tx *transmission) float64 {
+	total := 0.0
+	for _, other := range r.air {
+		if other == tx || other.source == target {
+			continue
+		}
+		total += dBmToMilliwatts(other.powers[target])
+	}
+
+	return total
+}
+
+// updateInterference records the interference every ongoing reception is
+// currently seeing, a reception only has to survive its worst moment
+func (r *Radio) updateInterference() {
+	for _, tx := range r.air {
+		for _, rec := range tx.receptions {
+			rec.interference = max(rec.interference, r.interferenceAt(rec.target, tx))
+		}
+	}
+}
+
+// decoded checks a finished reception against the SINR threshold
+func (r *Radio) decoded(tx *transmission, rec *reception) bool {
+	noise := dBmToMilliwatts(r.SINR.NoiseFloor)
+	sinr := rec.power - milliwattsToDBm(noise+rec.interference)
+
+	if sinr < r.SINR.Threshold {
+		log.Printf("frame from %s to %s lost to interference (SINR %.1fdB)", tx.source, rec.target, sinr)
+		r.Stats.Collisions++
+		return false
+	}
+
+	return true
+}
+
+// energyDetect is carrier sense by total received power
+func (r *Radio) energyDetect(source string) bool {
+	total := 0.0
+	for _, tx := range r.air {
+		if tx.source == source {
+			return true
+		}
+		total += dBmToMilliwatts(tx.powers[source])
+	}
+
+	return total > 0 && milliwattsToDBm(total) >= r.SINR.CarrierSense
+}
@@ -0,0 +1,84 @@
+package radio
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDecoded(t *testing.T) {
+	tests := []struct {
+		name string
+		// received power and interference, both in dBm, -1000 for none
+		power, interference float64
+		decoded             bool
+	}{
+		{"noise only", -80, -1000, true},
+		{"just above threshold", -80, -90.5, true},
+		{"weak interference", -80, -100, true},
+		{"interference at threshold", -80, -89.5, false},
+		{"as strong as the frame", -80, -80, false},
+		{"stronger than the frame", -80, -70, false},
+		{"near the noise floor", -92, -1000, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Radio{SINR: &SINR{Threshold: 10, NoiseFloor: -100}}
+			rec := &reception{target: "b", power: tt.power, interference: dBmToMilliwatts(tt.interference)}
+
+			if decoded := r.decoded(&transmission{source: "a"}, rec); decoded != tt.decoded {
+				t.Errorf("decoded %v, want %v", decoded, tt.decoded)
+			}
+			if dropped := r.Stats.Collisions > 0; dropped == tt.decoded {
+				t.Errorf("%d collisions counted", r.Stats.Collisions)
+			}
+		})
+	}
+}
+
+func TestCapture(t *testing.T) {
+	tests := []struct {
+		name      string
+		positions map[string]float64
+		heard     []string
+	}{
+		{
+			name:      "no interference",
+			positions: map[string]float64{"a": 0, "b": 20, "c": 200},
+			heard:     []string{"a"},
+		},
+		{
+			// c is out of b's range but still adds to the noise
+			name:      "distant interferer",
+			positions: map[string]float64{"a": 0, "b": 5, "c": 45},
+			heard:     []string{"a"},
+		},
+		{
+			// a and c can't sense each other and arrive at b as strong
+			name:      "interferer as close",
+			positions: map[string]float64{"a": 0, "b": 20, "c": 40},
+			heard:     nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Radio{
+				Model:       NewFreeSpace(2.4e9),
+				Sensitivity: -90,
+				MAC:         testMAC(),
+				SINR:        &SINR{Threshold: 10, NoiseFloor: -100, CarrierSense: -90},
+			}
+			sched, queue, listeners := serve(r, tt.positions, 30)
+
+			broadcast(sched, queue, 0, "a")
+			broadcast(sched, queue, 0, "c")
+			sched.Run(100 * time.Millisecond)
+
+			if heard := listeners["b"].heard; !slices.Equal(heard, tt.heard) {
+				t.Errorf("b heard %v, want %v", heard, tt.heard)
+			}
+		})
+	}
+}
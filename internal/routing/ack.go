@@ -0,0 +1,101 @@
+package routing
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/azaurus1/swarm/internal/sim"
+	"github.com/azaurus1/swarm/internal/types"
+)
+
+// sendGratuitousRREP gives the destination of an RREQ we answered for it the
+// route back to the originator, as if the originator had asked it
+// (RFC3561 6.6.3)
+func (a *AODVListener) sendGratuitousRREP(droneId string, rreq types.AODVMessage, destEntry RoutingTableEntry, radioQueue *sim.Queue) {
+	origEntry, exists := a.RoutingTable.Entries[rreq.OriginatorId]
+	if !exists || !origEntry.Valid {
+		return
+	}
+
+	a.addPrecursor(rreq.OriginatorId, destEntry.NextHop)
+
+	log.Printf("%s: sending gratuitous RREP to %s for %s", droneId, rreq.DestinationId, rreq.OriginatorId)
+
+	repDMsg := types.DroneMessage{
+		Source:  droneId,
+		NextHop: destEntry.NextHop,
+		Type:    "AODV",
+		AODVPayload: types.AODVMessage{
+			Source:                 droneId,
+			Type:                   2,
+			HopCount:               a.advertise(rreq.OriginatorId, origEntry.HopCount) + 1,
+			Metric:                 origEntry.Metric,
+			LinkExpiration:         a.expiresIn(origEntry.LinkExpiry),
+			FirstHop:               pathLastHop(origEntry),
+			DestinationId:          rreq.OriginatorId,
+			DestinationSequenceNum: rreq.OriginatorSequenceNum,
+			OriginatorId:           rreq.DestinationId,
+			OriginatorSequenceNum:  destEntry.SequenceNumber,
+			LifeTime:               origEntry.Expiration.Sub(a.Clock.Now()),
+		},
+	}
+
+	data, _ := json.Marshal(repDMsg)
+
+	radioQueue.Push(data)
+}
+
+// expectAck waits NextHopWait for the RREP-ACK to an RREP sent to neighbour,
+// without one the link is taken to only work towards us (RFC3561 6.8)
+func (a *AODVListener) expectAck(droneId string, neighbour string) {
+	if _, waiting := a.pendingAcks[neighbour]; waiting {
+		return
+	}
+
+	a.pendingAcks[neighbour] = a.Clock.After(a.Config.NextHopWait, func() {
+		delete(a.pendingAcks, neighbour)
+
+		log.Printf("%s: no RREP-ACK from %s, blacklisting it for %s", droneId, neighbour, a.Config.BlacklistTimeout)
+		a.blacklist[neighbour] = a.Clock.Now().Add(a.Config.BlacklistTimeout)
+	})
+}
+
+func (a *AODVListener) sendRREPAck(droneId string, neighbour string, radioQueue *sim.Queue) {
+	ackDMsg := types.DroneMessage{
+		Source:  droneId,
+		NextHop: neighbour,
+		Type:    "AODV",
+		AODVPayload: types.AODVMessage{
+			Source: droneId,
+			Type:   4,
+		},
+	}
+
+	data, _ := json.Marshal(ackDMsg)
+
+	radioQueue.Push(data)
+}
+
+func (a *AODVListener) handleRREPAck(droneId string, aMsg types.AODVMessage) {
+	if timer, waiting := a.pendingAcks[aMsg.Source]; waiting {
+		timer.Cancel()
+		delete(a.pendingAcks, aMsg.Source)
+	}
+
+	// the link evidently works both ways again
+	delete(a.blacklist, aMsg.Source)
+}
+
+func (a *AODVListener) blacklisted(neighbour string) bool {
+	until, exists := a.blacklist[neighbour]
+	if !exists {
+		return false
+	}
+
+	if !a.Clock.Now().Before(until) {
+		delete(a.blacklist, neighbour)
+		return false
+	}
+
+	return true
+}
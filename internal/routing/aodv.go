@@ -7,6 +7,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/azaurus1/swarm/internal/sim"
 	"github.com/azaurus1/swarm/internal/types"
 )
 
@@ -14,6 +15,33 @@ type AODVListener struct {
 	RoutingTable  RoutingTable
 	ReceivedRREQs map[string]time.Time
 	ReceivedRREPs map[string]time.Time
+	Config        AODVConfig
+	Clock         sim.Timer
+	Neighbours    *NeighbourTable
+	// our own sequence number and the ID of the last RREQ we originated
+	SequenceNumber int
+	RREQID         int
+	Events         RouteEvents
+
+	// the drone we run on and its radio, set by Start
+	node       Node
+	radioQueue *sim.Queue
+
+	discoveries map[string]*discovery
+	repairs     map[string]*repair
+	// RREP-ACKs we are waiting for and the neighbours whose RREQs we ignore
+	// until the given time, by neighbour
+	pendingAcks map[string]*sim.Event
+	blacklist   map[string]time.Time
+	// with ETX metrics or link expiration prediction, the best path each RREQ
+	// and RREP was handled with, by the keys of ReceivedRREQs and ReceivedRREPs
+	paths map[string]RoutingTableEntry
+	// with multipath routing, the reverse paths each RREP was forwarded on,
+	// by the keys of ReceivedRREPs
+	rrepHops map[string][]string
+	// when the RREQs and RERRs of the last second were sent, for the rate limits
+	sentRREQs []time.Time
+	sentRERRs []time.Time
 }
 
 type RoutingTable struct {
@@ -26,10 +54,28 @@ type RoutingTableEntry struct {
 	SequenceNumber int
 	NextHop        string
 	HopCount       int
-	Expiration     time.Time
+	// Metric is the ETX of the route, only with ETX metrics
+	Metric float64
+	// LinkExpiry is when the route's weakest link is predicted to break, only
+	// with link expiration prediction and zero if it isn't predicted to
+	LinkExpiry time.Time
+	Expiration time.Time
+	Valid      bool
+	// neighbours that forward through us to ID, they get told when it breaks
+	Precursors []string
+	// Paths are the link-disjoint paths to ID with multipath routing,
+	// NextHop and HopCount are those of the shortest. AdvertisedHopCount is
+	// the hop count we advertised ID with, zero until we have.
+	Paths              []Path
+	AdvertisedHopCount int
+
+	// the path the last packet went along with load balancing
+	turn int
 }
 
-func NewAODVListener() *AODVListener {
+func NewAODVListener(config AODVConfig, clock sim.Timer) *AODVListener {
+	config = config.WithDefaults()
+
 	return &AODVListener{
 		RoutingTable: RoutingTable{
 			Entries: make(map[string]RoutingTableEntry),
@@ -37,104 +83,154 @@ func NewAODVListener() *AODVListener {
 		},
 		ReceivedRREQs: make(map[string]time.Time),
 		ReceivedRREPs: make(map[string]time.Time),
+		Config:        config,
+		Neighbours:    NewNeighbourTable(config.HelloInterval, config.AllowedHelloLoss, clock),
+		Clock:         clock,
+		discoveries:   make(map[string]*discovery),
+		repairs:       make(map[string]*repair),
+		pendingAcks:   make(map[string]*sim.Event),
+		blacklist:     make(map[string]time.Time),
+		paths:         make(map[string]RoutingTableEntry),
+		rrepHops:      make(map[string][]string),
 	}
 }
 
-func (a *AODVListener) HandleAODVMessage(droneId string, pathDiscoveryTime time.Duration, aMsg types.AODVMessage, radioChan chan []byte) {
+func (a *AODVListener) HandleAODVMessage(droneId string, aMsg types.AODVMessage, radioQueue *sim.Queue) {
 	if aMsg.Type == 1 {
 		log.Printf("Processing RREQ from %s", aMsg.OriginatorId)
 		rreqKey := fmt.Sprintf("%s-%s", aMsg.OriginatorId, aMsg.RREQID)
 
 		hopCount := aMsg.HopCount + 1
+		metric := aMsg.Metric + a.linkMetric(aMsg.Source)
+		expiration := a.pathExpiration(aMsg.LinkExpiration, aMsg.Source)
 
 		if droneId == aMsg.OriginatorId {
 			log.Println("Ignoring because I am the originator")
 			return
 		}
 
-		if entry, exists := a.RoutingTable.Entries[aMsg.OriginatorId]; exists {
-			if entry.SequenceNumber <= aMsg.OriginatorSequenceNum && aMsg.HopCount < a.RoutingTable.Entries[aMsg.OriginatorId].HopCount {
-				// valid, update
-				log.Printf("%s: Valid, Updating", droneId)
-				a.RoutingTable.Entries[aMsg.OriginatorId] = RoutingTableEntry{
-					ID:             aMsg.OriginatorId,
-					SequenceNumber: aMsg.OriginatorSequenceNum,
-					NextHop:        aMsg.Source,
-					HopCount:       hopCount,
-					Expiration:     time.Now().Add(30 * time.Second),
-				}
-			}
-		} else {
-			// doesnt exist, create
-			log.Printf("%s: Doesnt exist, creating", droneId)
-			a.RoutingTable.Entries[aMsg.OriginatorId] = RoutingTableEntry{
-				ID:             aMsg.OriginatorId,
-				SequenceNumber: aMsg.OriginatorSequenceNum,
-				NextHop:        aMsg.Source,
-				HopCount:       hopCount,
-				Expiration:     time.Now().Add(30 * time.Second),
-			}
-
+		// RFC3561 6.8, RREQs over a link that has proven unidirectional are ignored
+		if a.blacklisted(aMsg.Source) {
+			log.Printf("%s: ignoring RREQ from blacklisted %s", droneId, aMsg.Source)
+			return
 		}
 
+		// reverse route back to the originator (RFC3561 6.5)
+		added := a.installRoute(droneId, aMsg.OriginatorId, aMsg.OriginatorSequenceNum, aMsg.Source, lastHop(droneId, aMsg), hopCount, metric, expiration, a.Config.ActiveRouteTimeout)
+
 		if timestamp, exists := a.ReceivedRREQs[rreqKey]; exists {
-			if time.Since(timestamp) < pathDiscoveryTime {
+			// with multipath routing the destination answers every copy
+			// that gave it another path back, the others only add paths
+			anotherPath := a.Config.Multipath && added && droneId == aMsg.DestinationId
+			if a.Clock.Now().Sub(timestamp) < a.Config.PathDiscoveryTime && !a.betterCopy(rreqKey, hopCount, metric, expiration) && !anotherPath {
 				// log.Println("Silently discarding this RREQ")
 				return
 			}
 		}
 
-		a.ReceivedRREQs[rreqKey] = time.Now()
+		a.ReceivedRREQs[rreqKey] = a.Clock.Now()
+		a.recordPath(rreqKey, hopCount, metric, expiration)
 
 		// Generate an RREP (RFC3561 6.6)
+		destEntry, destExists := a.RoutingTable.Entries[aMsg.DestinationId]
+
 		if droneId == aMsg.DestinationId {
 			// sending RREP
 			log.Println("I am the destination for this message")
 
+			// RFC3561 6.6.1, catch up with the sequence number the
+			// originator last knew us by so our route wins over the broken one
+			if !aMsg.UnknownSequenceNum && seqNewer(aMsg.DestinationSequenceNum, a.SequenceNumber) {
+				a.SequenceNumber = aMsg.DestinationSequenceNum
+			}
+
 			repMsg := types.AODVMessage{
 				Source:                 droneId,
 				Type:                   2,
 				HopCount:               1,
 				DestinationId:          aMsg.DestinationId,
-				DestinationSequenceNum: aMsg.OriginatorSequenceNum + 1,
+				DestinationSequenceNum: a.SequenceNumber,
 				OriginatorId:           aMsg.OriginatorId,
 				OriginatorSequenceNum:  aMsg.OriginatorSequenceNum,
+				LifeTime:               a.Config.MyRouteTimeout,
+				AckRequired:            a.Config.RREPAck,
 			}
 
+			// the RREP goes back along the reverse route
 			repDMsg := types.DroneMessage{
 				Source:      repMsg.Source,
+				NextHop:     aMsg.Source,
 				Type:        "AODV",
 				AODVPayload: repMsg,
 			}
 
 			data, _ := json.Marshal(repDMsg)
 
-			radioChan <- data
+			radioQueue.Push(data)
+			if a.Config.RREPAck {
+				a.expectAck(droneId, aMsg.Source)
+			}
 
-		} else if _, exists := a.RoutingTable.Entries[aMsg.DestinationId]; exists {
+		} else if !aMsg.DestinationOnly && destExists && destEntry.Valid && (aMsg.UnknownSequenceNum || !seqNewer(aMsg.DestinationSequenceNum, destEntry.SequenceNumber)) {
+			// RFC3561 6.6.2, only answer if our route is at least as fresh as
+			// the one the originator is asking for
 			log.Println("Route exists in the routing table")
+			// the neighbour towards the originator now forwards through us to
+			// the destination and vice versa
+			a.addPrecursor(aMsg.DestinationId, aMsg.Source)
+			a.addPrecursor(aMsg.OriginatorId, destEntry.NextHop)
+
 			// we have a route to the destination, we can send the RREP
 			repMsg := types.AODVMessage{
 				Source:                 droneId,
 				Type:                   2,
-				HopCount:               hopCount,
+				HopCount:               a.advertise(aMsg.DestinationId, destEntry.HopCount) + 1,
+				Metric:                 destEntry.Metric,
+				LinkExpiration:         a.expiresIn(destEntry.LinkExpiry),
+				FirstHop:               pathLastHop(destEntry),
 				DestinationId:          aMsg.DestinationId,
-				DestinationSequenceNum: aMsg.DestinationSequenceNum,
+				DestinationSequenceNum: destEntry.SequenceNumber,
 				OriginatorId:           aMsg.OriginatorId,
 				OriginatorSequenceNum:  aMsg.OriginatorSequenceNum,
+				LifeTime:               destEntry.Expiration.Sub(a.Clock.Now()),
+				AckRequired:            a.Config.RREPAck,
 			}
 
 			repDMsg := types.DroneMessage{
 				Source:      repMsg.Source,
+				NextHop:     aMsg.Source,
 				Type:        "AODV",
 				AODVPayload: repMsg,
 			}
 
 			data, _ := json.Marshal(repDMsg)
 
-			radioChan <- data
+			radioQueue.Push(data)
+			if a.Config.RREPAck {
+				a.expectAck(droneId, aMsg.Source)
+			}
+
+			// RFC3561 6.6.3, the destination learns the route back too
+			if aMsg.Gratuitous {
+				a.sendGratuitousRREP(droneId, aMsg, destEntry, radioQueue)
+			}
 		} else {
+			// RFC3561 6.5, the RREQ has gone as far as its TTL allows
+			if aMsg.TTL <= 1 {
+				log.Println("TTL expired, not repeating RREQ")
+				return
+			}
+
 			log.Println("Repeating RREQ")
+
+			// RFC3561 6.5, ask for at least the freshest route we know of
+			destSeqNum := aMsg.DestinationSequenceNum
+			unknownSeqNum := aMsg.UnknownSequenceNum
+			if destExists && (unknownSeqNum || seqNewer(destEntry.SequenceNumber, destSeqNum)) {
+				destSeqNum = destEntry.SequenceNumber
+				unknownSeqNum = false
+			}
+
 			reqMsg := types.AODVMessage{
 				Source:                 droneId,
 				Type:                   1,
@@ -142,8 +238,15 @@ func (a *AODVListener) HandleAODVMessage(droneId string, pathDiscoveryTime time.
 				OriginatorId:           aMsg.OriginatorId,
 				OriginatorSequenceNum:  aMsg.OriginatorSequenceNum,
 				DestinationId:          aMsg.DestinationId,
-				DestinationSequenceNum: aMsg.DestinationSequenceNum,
-				HopCount:               hopCount,
+				DestinationSequenceNum: destSeqNum,
+				UnknownSequenceNum:     unknownSeqNum,
+				Gratuitous:             aMsg.Gratuitous,
+				DestinationOnly:        aMsg.DestinationOnly,
+				HopCount:               a.advertise(aMsg.OriginatorId, hopCount),
+				Metric:                 metric,
+				LinkExpiration:         expiration,
+				FirstHop:               a.firstHop(droneId, aMsg),
+				TTL:                    aMsg.TTL - 1,
 			}
 
 			reqDMsg := types.DroneMessage{
@@ -154,90 +257,104 @@ func (a *AODVListener) HandleAODVMessage(droneId string, pathDiscoveryTime time.
 
 			data, _ := json.Marshal(reqDMsg)
 
-			radioChan <- data
+			radioQueue.Push(data)
 		}
 
 	} else if aMsg.Type == 2 {
+		if aMsg.OriginatorId == aMsg.DestinationId {
+			a.handleHello(droneId, aMsg)
+			return
+		}
+
 		log.Printf("Processing RREP from %s", aMsg.OriginatorId)
-		rrepKey := fmt.Sprintf("%s-%s", aMsg.OriginatorId, aMsg.RREQID)
+
+		if aMsg.AckRequired {
+			a.sendRREPAck(droneId, aMsg.Source, radioQueue)
+		}
+		// RREPs don't carry the RREQ ID, the originator sequence number they
+		// echo is new for every RREQ so it tells discoveries apart instead
+		rrepKey := fmt.Sprintf("%s-%d-%s-%d", aMsg.OriginatorId, aMsg.OriginatorSequenceNum, aMsg.DestinationId, aMsg.DestinationSequenceNum)
 
 		if droneId == aMsg.DestinationId {
 			log.Println("Discarding RREP")
 			return
 		}
 
-		// Instead of looking up aMsg.Source, look up the route for the destination:
-		if entry, exists := a.RoutingTable.Entries[aMsg.DestinationId]; exists {
-			if entry.SequenceNumber <= aMsg.DestinationSequenceNum && aMsg.HopCount < a.RoutingTable.Entries[aMsg.DestinationId].HopCount {
-				// Valid update: update the route for the destination
-				log.Println("Valid, Updating")
-				a.RoutingTable.Entries[aMsg.DestinationId] = RoutingTableEntry{
-					ID:             aMsg.DestinationId,
-					SequenceNumber: aMsg.DestinationSequenceNum,
-					NextHop:        aMsg.Source, // the neighbor from which we received the RREP
-					HopCount:       aMsg.HopCount,
-					Expiration:     time.Now().Add(30 * time.Second),
-				}
-			}
-		} else {
-			// Doesn't exist, so create a route entry for the destination
-			log.Println("Doesnt exist, creating")
-			log.Println(aMsg)
-			a.RoutingTable.Entries[aMsg.DestinationId] = RoutingTableEntry{
-				ID:             aMsg.DestinationId,
-				SequenceNumber: aMsg.DestinationSequenceNum,
-				NextHop:        aMsg.Source,
-				HopCount:       aMsg.HopCount,
-				Expiration:     time.Now().Add(30 * time.Second),
-			}
-		}
+		// forward route to the destination, through the neighbour we heard the RREP from
+		metric := aMsg.Metric + a.linkMetric(aMsg.Source)
+		expiration := a.pathExpiration(aMsg.LinkExpiration, aMsg.Source)
+		added := a.installRoute(droneId, aMsg.DestinationId, aMsg.DestinationSequenceNum, aMsg.Source, lastHop(droneId, aMsg), aMsg.HopCount, metric, expiration, aMsg.LifeTime)
 
 		if timestamp, exists := a.ReceivedRREPs[rrepKey]; exists {
-			if time.Since(timestamp) < pathDiscoveryTime {
+			// with multipath routing a copy that gave us another path is
+			// passed on along another reverse path
+			anotherPath := a.Config.Multipath && added
+			if a.Clock.Now().Sub(timestamp) < a.Config.PathDiscoveryTime && !a.betterCopy(rrepKey, aMsg.HopCount, metric, expiration) && !anotherPath {
 				// log.Println("Silently discarding this RREP")
 				return
 			}
 		}
 
-		a.ReceivedRREPs[rrepKey] = time.Now()
+		a.ReceivedRREPs[rrepKey] = a.Clock.Now()
+		a.recordPath(rrepKey, aMsg.HopCount, metric, expiration)
 
 		// Increment hop count for forwarding purposes
-		hopCount := aMsg.HopCount + 1
+		hopCount := a.advertise(aMsg.DestinationId, aMsg.HopCount) + 1
 
 		if droneId == aMsg.OriginatorId {
+			// the route to the destination was installed above
 			log.Println("I am the originator of this RREP")
-			// For the originator, install/update the route for the destination.
-			a.RoutingTable.Entries[aMsg.DestinationId] = RoutingTableEntry{
-				ID:             aMsg.DestinationId,
-				SequenceNumber: aMsg.DestinationSequenceNum,
-				NextHop:        aMsg.Source,
-				HopCount:       aMsg.HopCount,
-				Expiration:     time.Now().Add(30 * time.Second),
-			}
 
 			return
 		} else {
 			// Repeat: forward the RREP with an incremented hop count
 			log.Printf("Drone %s repeating rrep", droneId)
+
+			// RFC3561 6.7, unicast towards the originator and remember who
+			// will be using the routes in both directions
+			nextHop := a.reverseHop(rrepKey, aMsg.OriginatorId)
+			if nextHop != "" {
+				a.addPrecursor(aMsg.DestinationId, nextHop)
+				a.addPrecursor(aMsg.OriginatorId, aMsg.Source)
+			} else if a.Config.Multipath && len(a.rrepHops[rrepKey]) > 0 {
+				// every reverse path already carries a copy
+				return
+			}
+
 			repMsg := types.AODVMessage{
 				Source:                 droneId,
 				Type:                   2,
 				HopCount:               hopCount,
+				Metric:                 metric,
+				LinkExpiration:         expiration,
+				FirstHop:               a.firstHop(droneId, aMsg),
 				DestinationId:          aMsg.DestinationId,
 				DestinationSequenceNum: aMsg.DestinationSequenceNum,
 				OriginatorId:           aMsg.OriginatorId,
 				OriginatorSequenceNum:  aMsg.OriginatorSequenceNum,
+				LifeTime:               aMsg.LifeTime,
+				AckRequired:            a.Config.RREPAck && nextHop != "",
 			}
 
 			repDMsg := types.DroneMessage{
 				Source:      repMsg.Source,
+				NextHop:     nextHop,
 				Type:        "AODV",
 				AODVPayload: repMsg,
 			}
 
 			data, _ := json.Marshal(repDMsg)
-			radioChan <- data
+			radioQueue.Push(data)
+
+			if repMsg.AckRequired {
+				a.expectAck(droneId, nextHop)
+			}
 		}
+	} else if aMsg.Type == 3 {
+		log.Printf("Processing RERR from %s", aMsg.Source)
+		a.handleRERR(droneId, aMsg, radioQueue)
+	} else if aMsg.Type == 4 {
+		a.handleRREPAck(droneId, aMsg)
 	}
 }
 
@@ -249,9 +366,9 @@ func (r RoutingTableEntry) ToString() string {
 }
 
 // check for routing table entries that are past expiration, delete them if they are
-func (a *AODVListener) CheckExpiredNeighbours() error {
+func (a *AODVListener) CheckExpiredRoutes() error {
 	for _, entry := range a.RoutingTable.Entries {
-		if entry.Expiration.Before(time.Now()) {
+		if entry.Expiration.Before(a.Clock.Now()) {
 			a.RoutingTable.Mutex.Lock()
 			log.Println("expired entry found, deleting...")
 			delete(a.RoutingTable.Entries, entry.ID)
@@ -262,6 +379,44 @@ func (a *AODVListener) CheckExpiredNeighbours() error {
 	return nil
 }
 
+// expireReceived forgets the RREQs and RREPs handled more than
+// PathDiscoveryTime ago along with the paths they were handled with, copies
+// arriving later aren't discarded as duplicates anymore (RFC3561 6.5)
+func (a *AODVListener) expireReceived() {
+	now := a.Clock.Now()
+
+	for key, timestamp := range a.ReceivedRREQs {
+		if now.Sub(timestamp) >= a.Config.PathDiscoveryTime {
+			delete(a.ReceivedRREQs, key)
+			delete(a.paths, key)
+		}
+	}
+	for key, timestamp := range a.ReceivedRREPs {
+		if now.Sub(timestamp) >= a.Config.PathDiscoveryTime {
+			delete(a.ReceivedRREPs, key)
+			delete(a.paths, key)
+			delete(a.rrepHops, key)
+		}
+	}
+}
+
+// NextHop returns the neighbour to forward a packet for destination to
+func (a *AODVListener) NextHop(destination string) (string, bool) {
+	a.RoutingTable.Mutex.Lock()
+	defer a.RoutingTable.Mutex.Unlock()
+
+	entry, exists := a.RoutingTable.Entries[destination]
+	if !exists || !entry.Valid || entry.Expiration.Before(a.Clock.Now()) {
+		return "", false
+	}
+
+	if a.Config.LoadBalance && len(entry.Paths) > 1 {
+		return a.balance(entry), true
+	}
+
+	return entry.NextHop, true
+}
+
 func (a *AODVListener) CheckForRoute(destination string) bool {
 	a.RoutingTable.Mutex.Lock()
 	defer a.RoutingTable.Mutex.Unlock()
@@ -270,3 +425,71 @@ func (a *AODVListener) CheckForRoute(destination string) bool {
 	log.Printf("Route exists: %v", exists)
 	return exists
 }
+
+// AODVListener is a Protocol, the methods below bind the drone specific
+// arguments of the AODV handlers to the drone it was started on
+var _ Protocol = (*AODVListener)(nil)
+
+func (a *AODVListener) Name() string {
+	return "AODV"
+}
+
+// Start schedules the HELLOs, lost neighbours break every route through them
+func (a *AODVListener) Start(node Node, sched *sim.Scheduler, radioQueue *sim.Queue) {
+	a.node = node
+	a.radioQueue = radioQueue
+
+	a.Neighbours.OnLinkBreak = func(neighbour string) {
+		log.Printf("drone %s > lost neighbour %s", node.ID(), neighbour)
+		a.HandleLinkBreak(node.ID(), neighbour, radioQueue)
+	}
+
+	// the first HELLO is offset by a random fraction of the interval so the
+	// drones don't all transmit in the same instant
+	helloOffset := time.Duration(sched.Rand.Int63n(int64(a.Config.HelloInterval)))
+	sched.Every(helloOffset, a.Config.HelloInterval, func() {
+		a.SendHello(node.ID(), node.Position(), radioQueue)
+	})
+}
+
+func (a *AODVListener) HandleMessage(msg types.DroneMessage) {
+	a.HandleAODVMessage(a.node.ID(), msg.AODVPayload, a.radioQueue)
+}
+
+func (a *AODVListener) Tick() {
+	a.Neighbours.Expire()
+	if a.Config.Multipath {
+		a.expirePaths()
+	}
+	a.CheckExpiredRoutes()
+	a.expireReceived()
+}
+
+func (a *AODVListener) TickInterval() time.Duration {
+	return a.Config.ExpiryCheckInterval
+}
+
+// PendingTimeout is PathDiscoveryTime, a route not found by then won't be
+func (a *AODVListener) PendingTimeout() time.Duration {
+	return a.Config.PathDiscoveryTime
+}
+
+func (a *AODVListener) HeardFrom(neighbour string) {
+	a.Neighbours.HeardFrom(neighbour)
+}
+
+func (a *AODVListener) LinkFailed(neighbour string) {
+	a.Neighbours.Remove(neighbour)
+}
+
+func (a *AODVListener) RequestRoute(destination string) {
+	a.SendRREQ(a.node.ID(), destination, a.radioQueue)
+}
+
+func (a *AODVListener) Unreachable(destination string, previousHop string) {
+	a.ReportUnreachable(a.node.ID(), destination, previousHop, a.radioQueue)
+}
+
+func (a *AODVListener) SetRouteEvents(events RouteEvents) {
+	a.Events = events
+}
@@ -0,0 +1,177 @@
+package routing
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/azaurus1/swarm/internal/sim"
+	"github.com/azaurus1/swarm/internal/types"
+)
+
+// BATMAN is a B.A.T.M.A.N. style protocol. Every drone floods an originator
+// message (OGM) each interval, nobody learns the topology, each drone only
+// counts through which neighbour the OGMs of every originator arrive and
+// routes to it through the one that brought the most of the latest
+// WindowSize.
+type BATMAN struct {
+	Config BATMANConfig
+	Clock  sim.Timer
+	Events RouteEvents
+
+	Originators map[string]*Originator
+	// our own OGM sequence number
+	SequenceNumber int
+	// Echoes holds the last of our own OGMs each neighbour rebroadcast back
+	// to us, proof the link to it works both ways
+	Echoes map[string]int
+
+	// the drone we run on and its radio, set by Start
+	node       Node
+	radioQueue *sim.Queue
+}
+
+// Originator is what we know of a drone from its OGMs
+type Originator struct {
+	ID string
+	// SequenceNumber is the newest of its OGMs we've seen
+	SequenceNumber int
+	LastSeen       time.Time
+	// Window holds, by neighbour, the sequence numbers in the window that
+	// arrived through it
+	Window  map[string]map[int]bool
+	NextHop string
+}
+
+func NewBATMAN(config BATMANConfig, clock sim.Timer) *BATMAN {
+	return &BATMAN{
+		Config:      config.WithDefaults(),
+		Clock:       clock,
+		Originators: make(map[string]*Originator),
+		Echoes:      make(map[string]int),
+	}
+}
+
+var _ Protocol = (*BATMAN)(nil)
+
+func (b *BATMAN) Name() string {
+	return "BATMAN"
+}
+
+// Start schedules our OGMs, offset by a random fraction of the interval so
+// the drones don't all transmit in the same instant
+func (b *BATMAN) Start(node Node, sched *sim.Scheduler, radioQueue *sim.Queue) {
+	b.node = node
+	b.radioQueue = radioQueue
+
+	offset := time.Duration(sched.Rand.Int63n(int64(b.Config.OriginatorInterval)))
+	sched.Every(offset, b.Config.OriginatorInterval, b.sendOGM)
+}
+
+// HandleMessage processes an OGM a neighbour broadcast
+func (b *BATMAN) HandleMessage(msg types.DroneMessage) {
+	if msg.OGMPayload == nil {
+		return
+	}
+
+	b.handleOGM(msg.Source, *msg.OGMPayload)
+}
+
+// Tick forgets the originators that went quiet and rechecks the next hops,
+// a neighbour may have stopped echoing our OGMs
+func (b *BATMAN) Tick() {
+	for _, id := range sortedKeys(b.Originators) {
+		o := b.Originators[id]
+
+		if b.Clock.Now().Sub(o.LastSeen) > b.Config.PurgeTimeout {
+			if o.NextHop != "" {
+				log.Printf("%s: lost route to %s", b.node.ID(), id)
+			}
+			delete(b.Originators, id)
+			continue
+		}
+
+		b.selectNextHop(o)
+	}
+}
+
+func (b *BATMAN) TickInterval() time.Duration {
+	return b.Config.ExpiryCheckInterval
+}
+
+// PendingTimeout is PurgeTimeout, an originator not heard of by then is
+// taken to be gone
+func (b *BATMAN) PendingTimeout() time.Duration {
+	return b.Config.PurgeTimeout
+}
+
+// HeardFrom does nothing, links are judged by the OGMs alone
+func (b *BATMAN) HeardFrom(neighbour string) {}
+
+// LinkFailed forgets everything that came through neighbour
+func (b *BATMAN) LinkFailed(neighbour string) {
+	delete(b.Echoes, neighbour)
+
+	for _, id := range sortedKeys(b.Originators) {
+		delete(b.Originators[id].Window, neighbour)
+		b.selectNextHop(b.Originators[id])
+	}
+}
+
+// NextHop returns the best neighbour towards destination
+func (b *BATMAN) NextHop(destination string) (string, bool) {
+	o, exists := b.Originators[destination]
+	if !exists || o.NextHop == "" {
+		return "", false
+	}
+
+	return o.NextHop, true
+}
+
+// RequestRoute has nothing to discover, OnRoute is raised once destination's
+// OGMs start arriving
+func (b *BATMAN) RequestRoute(destination string) {
+	if _, exists := b.NextHop(destination); exists {
+		b.Events.Route(destination)
+		return
+	}
+
+	log.Printf("%s: no OGMs from %s yet", b.node.ID(), destination)
+}
+
+// Repairing is always false, routes follow the OGMs
+func (b *BATMAN) Repairing(destination string) bool {
+	return false
+}
+
+// Unreachable only logs, the next OGMs put the routes right
+func (b *BATMAN) Unreachable(destination string, previousHop string) {
+	log.Printf("%s: no route to %s, dropping packet from %s", b.node.ID(), destination, previousHop)
+}
+
+func (b *BATMAN) SetRouteEvents(events RouteEvents) {
+	b.Events = events
+}
+
+func (b *BATMAN) sendOGM() {
+	b.SequenceNumber = seqNext(b.SequenceNumber)
+
+	b.send(types.OGM{
+		OriginatorId:   b.node.ID(),
+		SequenceNumber: b.SequenceNumber,
+		TTL:            b.Config.TTL,
+		PreviousSender: b.node.ID(),
+	})
+}
+
+func (b *BATMAN) send(ogm types.OGM) {
+	dMsg := types.DroneMessage{
+		Source:     b.node.ID(),
+		Type:       "BATMAN",
+		OGMPayload: &ogm,
+	}
+
+	data, _ := json.Marshal(dMsg)
+
+	b.radioQueue.Push(data)
+}
@@ -0,0 +1,148 @@
+package routing
+
+import (
+	"log"
+
+	"github.com/azaurus1/swarm/internal/types"
+)
+
+// handleOGM counts an OGM sender passed us towards the route to its
+// originator and floods it on. A neighbour's own OGMs are always
+// rebroadcast, marked as a direct link so it learns we hear it, anyone
+// else's only when they came through our best neighbour towards the
+// originator. Our own OGMs coming back tell us which links work both ways.
+func (b *BATMAN) handleOGM(sender string, ogm types.OGM) {
+	self := b.node.ID()
+	if sender == self {
+		return
+	}
+
+	if ogm.OriginatorId == self {
+		if ogm.DirectLink && ogm.PreviousSender == self {
+			b.echoed(sender, ogm.SequenceNumber)
+		}
+		return
+	}
+	// the sender had it from us or can't hear whoever it had it from
+	if ogm.PreviousSender == self || ogm.Unidirectional {
+		return
+	}
+
+	o, exists := b.Originators[ogm.OriginatorId]
+	if !exists {
+		o = &Originator{ID: ogm.OriginatorId, SequenceNumber: ogm.SequenceNumber, Window: make(map[string]map[int]bool)}
+		b.Originators[ogm.OriginatorId] = o
+	}
+	if !b.inWindow(o, ogm.SequenceNumber) && !seqNewer(ogm.SequenceNumber, o.SequenceNumber) {
+		return
+	}
+
+	duplicate := false
+	for _, seen := range o.Window {
+		if seen[ogm.SequenceNumber] {
+			duplicate = true
+		}
+	}
+	if seqNewer(ogm.SequenceNumber, o.SequenceNumber) {
+		o.SequenceNumber = ogm.SequenceNumber
+		b.slideWindow(o)
+	}
+	o.LastSeen = b.Clock.Now()
+
+	bidirectional := b.bidirectional(sender)
+	if bidirectional {
+		if o.Window[sender] == nil {
+			o.Window[sender] = make(map[int]bool)
+		}
+		o.Window[sender][ogm.SequenceNumber] = true
+		b.selectNextHop(o)
+	}
+
+	if ogm.TTL <= 1 {
+		return
+	}
+
+	direct := ogm.OriginatorId == sender
+	if !direct && (duplicate || !bidirectional || o.NextHop != sender) {
+		return
+	}
+
+	ogm.TTL--
+	ogm.PreviousSender = sender
+	ogm.DirectLink = direct
+	ogm.Unidirectional = direct && !bidirectional
+	b.send(ogm)
+}
+
+// echoed notes neighbour rebroadcast one of our own OGMs
+func (b *BATMAN) echoed(neighbour string, seqNum int) {
+	if last, exists := b.Echoes[neighbour]; exists && !seqNewer(seqNum, last) {
+		return
+	}
+
+	if !b.bidirectional(neighbour) {
+		log.Printf("drone %s > bidirectional link to %s", b.node.ID(), neighbour)
+	}
+	b.Echoes[neighbour] = seqNum
+}
+
+// bidirectional is true if neighbour echoed one of our last BidirectTimeout
+// OGMs
+func (b *BATMAN) bidirectional(neighbour string) bool {
+	last, exists := b.Echoes[neighbour]
+
+	return exists && int32(uint32(b.SequenceNumber)-uint32(last)) < int32(b.Config.BidirectTimeout)
+}
+
+// inWindow is true if seqNum is one of the last WindowSize of o's OGMs
+func (b *BATMAN) inWindow(o *Originator, seqNum int) bool {
+	age := int32(uint32(o.SequenceNumber) - uint32(seqNum))
+
+	return age >= 0 && age < int32(b.Config.WindowSize)
+}
+
+// slideWindow drops the sequence numbers that fell out of o's window
+func (b *BATMAN) slideWindow(o *Originator) {
+	for _, neighbour := range sortedKeys(o.Window) {
+		for seqNum := range o.Window[neighbour] {
+			if !b.inWindow(o, seqNum) {
+				delete(o.Window[neighbour], seqNum)
+			}
+		}
+		if len(o.Window[neighbour]) == 0 {
+			delete(o.Window, neighbour)
+		}
+	}
+}
+
+// selectNextHop routes to o through the bidirectional neighbour that brought
+// the most of its OGMs in the window, the current one keeps it on a tie
+func (b *BATMAN) selectNextHop(o *Originator) {
+	self := b.node.ID()
+	best, bestCount := "", 0
+
+	for _, neighbour := range sortedKeys(o.Window) {
+		if !b.bidirectional(neighbour) {
+			continue
+		}
+
+		count := len(o.Window[neighbour])
+		if count > bestCount || (count == bestCount && neighbour == o.NextHop) {
+			best, bestCount = neighbour, count
+		}
+	}
+
+	previous := o.NextHop
+	o.NextHop = best
+
+	switch {
+	case best == previous:
+	case best == "":
+		log.Printf("%s: lost route to %s", self, o.ID)
+	case previous == "":
+		log.Printf("%s: creating route to %s via %s (%d of the last %d OGMs)", self, o.ID, best, bestCount, b.Config.WindowSize)
+		b.Events.Route(o.ID)
+	default:
+		log.Printf("%s: updating route to %s via %s (%d of the last %d OGMs)", self, o.ID, best, bestCount, b.Config.WindowSize)
+	}
+}
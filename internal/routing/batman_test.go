@@ -0,0 +1,65 @@
+package routing
+
+import (
+	"testing"
+
+	"github.com/azaurus1/swarm/internal/sim"
+)
+
+func TestInWindow(t *testing.T) {
+	tests := []struct {
+		name     string
+		newest   int
+		seqNum   int
+		inWindow bool
+	}{
+		{"newest", 10, 10, true},
+		{"oldest in the window", 10, 6, true},
+		{"just out of the window", 10, 5, false},
+		{"newer than the newest", 10, 11, false},
+		{"across rollover", 2, maxSeq, true},
+		{"out of the window across rollover", 2, maxSeq - 2, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBATMAN(BATMANConfig{WindowSize: 5}, sim.NewScheduler(1))
+			o := &Originator{ID: "o", SequenceNumber: tt.newest}
+
+			if got := b.inWindow(o, tt.seqNum); got != tt.inWindow {
+				t.Errorf("inWindow(%d) with newest %d = %v, want %v", tt.seqNum, tt.newest, got, tt.inWindow)
+			}
+		})
+	}
+}
+
+func TestBidirectional(t *testing.T) {
+	tests := []struct {
+		name          string
+		ours          int
+		echo          int
+		echoed        bool
+		bidirectional bool
+	}{
+		{"latest echoed", 10, 10, true, true},
+		{"recent echo", 10, 8, true, true},
+		{"echo too old", 10, 7, true, false},
+		{"never echoed", 10, 0, false, false},
+		{"echo across rollover", 1, maxSeq, true, true},
+		{"old echo across rollover", 1, maxSeq - 2, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBATMAN(BATMANConfig{BidirectTimeout: 3}, sim.NewScheduler(1))
+			b.SequenceNumber = tt.ours
+			if tt.echoed {
+				b.Echoes["n"] = tt.echo
+			}
+
+			if got := b.bidirectional("n"); got != tt.bidirectional {
+				t.Errorf("bidirectional with our OGM %d echoed as %d = %v, want %v", tt.ours, tt.echo, got, tt.bidirectional)
+			}
+		})
+	}
+}
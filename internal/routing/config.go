@@ -0,0 +1,434 @@
+package routing
+
+import "time"
+
+// AODVConfig holds the protocol parameters of RFC3561 section 10, a zero
+// field takes the RFC's default. The ones where zero means something, no
+// retries or no repair for example, are pointers and default on nil.
+type AODVConfig struct {
+	ActiveRouteTimeout time.Duration
+	AllowedHelloLoss   int
+	BlacklistTimeout   time.Duration
+	DeletePeriod       time.Duration
+	HelloInterval      time.Duration
+	LocalAddTTL        *int
+	MaxRepairTTL       *int
+	MyRouteTimeout     time.Duration
+	NetDiameter        int
+	NextHopWait        time.Duration
+	NodeTraversalTime  time.Duration
+	PathDiscoveryTime  time.Duration
+	RERRRateLimit      int
+	RREQRetries        *int
+	RREQRateLimit      int
+	TimeoutBuffer      *int
+	TTLStart           int
+	TTLIncrement       int
+	TTLThreshold       int
+
+	// ExpiryCheckInterval is how often routes and neighbours are checked for
+	// expiry, it isn't in the RFC
+	ExpiryCheckInterval time.Duration
+	// Gratuitous sets the G flag on our RREQs so an intermediate node that
+	// answers tells the destination about us as well, for traffic that goes
+	// both ways
+	Gratuitous bool
+	// DestinationOnly sets the D flag on our RREQs so only the destination
+	// answers them
+	DestinationOnly bool
+	// RREPAck sets the A flag on the RREPs we send, a neighbour that doesn't
+	// acknowledge in NextHopWait is blacklisted for BlacklistTimeout
+	RREPAck bool
+	// ETX picks routes by their expected transmission count rather than
+	// their hop count, so a few good links win over fewer fragile ones
+	ETX bool
+	// LinkExpiration predicts when links break from the positions and
+	// velocities HELLOs carry, routes expire LinkExpirationMargin before
+	// their weakest link does and the longest lasting one is preferred
+	LinkExpiration       bool
+	LinkExpirationMargin *time.Duration
+	// Multipath keeps up to MaxPaths link-disjoint paths per route as AOMDV
+	// does, a broken link fails over to another path, LoadBalance spreads
+	// DATA packets over them in turn
+	Multipath   bool
+	MaxPaths    int
+	LoadBalance bool
+}
+
+// DELETE_PERIOD is K times the longest lifetime a neighbour or route can have
+const deletePeriodK = 5
+
+// WithDefaults returns the config with every zero field set to its default,
+// the derived parameters are worked out from the others as the RFC does
+func (c AODVConfig) WithDefaults() AODVConfig {
+	if c.ActiveRouteTimeout == 0 {
+		c.ActiveRouteTimeout = 3000 * time.Millisecond
+	}
+	if c.AllowedHelloLoss == 0 {
+		c.AllowedHelloLoss = 2
+	}
+	if c.HelloInterval == 0 {
+		c.HelloInterval = 1000 * time.Millisecond
+	}
+	if c.LocalAddTTL == nil {
+		localAddTTL := 2
+		c.LocalAddTTL = &localAddTTL
+	}
+	if c.NetDiameter == 0 {
+		c.NetDiameter = 35
+	}
+	if c.NodeTraversalTime == 0 {
+		c.NodeTraversalTime = 40 * time.Millisecond
+	}
+	if c.RERRRateLimit == 0 {
+		c.RERRRateLimit = 10
+	}
+	if c.RREQRetries == nil {
+		rreqRetries := 2
+		c.RREQRetries = &rreqRetries
+	}
+	if c.RREQRateLimit == 0 {
+		c.RREQRateLimit = 10
+	}
+	if c.TimeoutBuffer == nil {
+		timeoutBuffer := 2
+		c.TimeoutBuffer = &timeoutBuffer
+	}
+	if c.TTLStart == 0 {
+		c.TTLStart = 1
+	}
+	if c.TTLIncrement == 0 {
+		c.TTLIncrement = 2
+	}
+	if c.TTLThreshold == 0 {
+		c.TTLThreshold = 7
+	}
+	if c.ExpiryCheckInterval == 0 {
+		c.ExpiryCheckInterval = 1000 * time.Millisecond
+	}
+	if c.LinkExpirationMargin == nil {
+		margin := 1000 * time.Millisecond
+		c.LinkExpirationMargin = &margin
+	}
+	if c.MaxPaths == 0 {
+		c.MaxPaths = 3
+	}
+
+	if c.BlacklistTimeout == 0 {
+		c.BlacklistTimeout = time.Duration(*c.RREQRetries) * c.NetTraversalTime()
+	}
+	if c.DeletePeriod == 0 {
+		c.DeletePeriod = deletePeriodK * max(c.ActiveRouteTimeout, c.HelloInterval)
+	}
+	if c.MaxRepairTTL == nil {
+		maxRepairTTL := max(1, c.NetDiameter*3/10)
+		c.MaxRepairTTL = &maxRepairTTL
+	}
+	if c.MyRouteTimeout == 0 {
+		c.MyRouteTimeout = 2 * c.ActiveRouteTimeout
+	}
+	if c.PathDiscoveryTime == 0 {
+		c.PathDiscoveryTime = 2 * c.NetTraversalTime()
+	}
+	if c.NextHopWait == 0 {
+		c.NextHopWait = c.NodeTraversalTime + 10*time.Millisecond
+	}
+
+	return c
+}
+
+// NetTraversalTime is the longest a round trip across the network can take
+func (c AODVConfig) NetTraversalTime() time.Duration {
+	return 2 * c.NodeTraversalTime * time.Duration(c.NetDiameter)
+}
+
+// RingTraversalTime is how long to wait for a reply to an RREQ sent with ttl
+func (c AODVConfig) RingTraversalTime(ttl int) time.Duration {
+	return 2 * c.NodeTraversalTime * time.Duration(ttl+*c.TimeoutBuffer)
+}
+
+// OLSR willingness to forward for others (RFC3626 18.8), a neighbour with
+// WillNever is never picked as MPR and one with WillAlways always is
+const (
+	WillNever   = 0
+	WillLow     = 1
+	WillDefault = 3
+	WillHigh    = 6
+	WillAlways  = 7
+)
+
+// OLSRConfig holds the OLSR parameters of RFC3626 section 18, a zero field
+// takes the RFC's default
+type OLSRConfig struct {
+	HelloInterval  time.Duration
+	TCInterval     time.Duration
+	NeighbHoldTime time.Duration
+	TopHoldTime    time.Duration
+	DupHoldTime    time.Duration
+	// Willingness is nil for WillDefault, it can't default on zero as zero
+	// is WillNever
+	Willingness *int
+
+	// ExpiryCheckInterval is how often the link, topology and duplicate sets
+	// are checked for expiry, it isn't in the RFC
+	ExpiryCheckInterval time.Duration
+}
+
+// WithDefaults returns the config with every zero field set to its default,
+// the hold times are three of their intervals as in the RFC
+func (c OLSRConfig) WithDefaults() OLSRConfig {
+	if c.HelloInterval == 0 {
+		c.HelloInterval = 2 * time.Second
+	}
+	if c.TCInterval == 0 {
+		c.TCInterval = 5 * time.Second
+	}
+	if c.NeighbHoldTime == 0 {
+		c.NeighbHoldTime = 3 * c.HelloInterval
+	}
+	if c.TopHoldTime == 0 {
+		c.TopHoldTime = 3 * c.TCInterval
+	}
+	if c.DupHoldTime == 0 {
+		c.DupHoldTime = 30 * time.Second
+	}
+	if c.Willingness == nil {
+		willingness := WillDefault
+		c.Willingness = &willingness
+	}
+	if c.ExpiryCheckInterval == 0 {
+		c.ExpiryCheckInterval = 1000 * time.Millisecond
+	}
+
+	return c
+}
+
+// DSRConfig holds the DSR parameters of RFC4728 section 9, a zero field takes
+// the RFC's default
+type DSRConfig struct {
+	DiscoveryHopLimit     int
+	NonpropRequestTimeout time.Duration
+	RequestPeriod         time.Duration
+	MaxRequestPeriod      time.Duration
+	MaxRequestRexmt       int
+	RouteCacheTimeout     time.Duration
+	MaxSalvageCount       int
+	// SendBufferTimeout is how long a packet waits for a route
+	SendBufferTimeout time.Duration
+
+	// ExpiryCheckInterval is how often the route cache is checked for stale
+	// routes, it isn't in the RFC
+	ExpiryCheckInterval time.Duration
+}
+
+// WithDefaults returns the config with every zero field set to its default
+func (c DSRConfig) WithDefaults() DSRConfig {
+	if c.DiscoveryHopLimit == 0 {
+		c.DiscoveryHopLimit = 255
+	}
+	if c.NonpropRequestTimeout == 0 {
+		c.NonpropRequestTimeout = 30 * time.Millisecond
+	}
+	if c.RequestPeriod == 0 {
+		c.RequestPeriod = 500 * time.Millisecond
+	}
+	if c.MaxRequestPeriod == 0 {
+		c.MaxRequestPeriod = 10 * time.Second
+	}
+	if c.MaxRequestRexmt == 0 {
+		c.MaxRequestRexmt = 16
+	}
+	if c.RouteCacheTimeout == 0 {
+		c.RouteCacheTimeout = 300 * time.Second
+	}
+	if c.MaxSalvageCount == 0 {
+		c.MaxSalvageCount = 15
+	}
+	if c.SendBufferTimeout == 0 {
+		c.SendBufferTimeout = 30 * time.Second
+	}
+	if c.ExpiryCheckInterval == 0 {
+		c.ExpiryCheckInterval = 1000 * time.Millisecond
+	}
+
+	return c
+}
+
+// GPSRConfig holds the GPSR parameters, a zero field takes the default of
+// the GPSR paper where it has one
+type GPSRConfig struct {
+	BeaconInterval time.Duration
+	// AllowedBeaconLoss is how many beacon intervals a neighbour may stay
+	// quiet before it is dropped
+	AllowedBeaconLoss int
+	// MaxHops bounds how far a message travels, a perimeter that never
+	// reaches its destination ends here
+	MaxHops int
+
+	// the location service, a query floods QueryTTL hops and is retried
+	// QueryRetries times QueryTimeout apart, learnt locations are kept for
+	// LocationTimeout
+	LocationTimeout time.Duration
+	QueryTTL        int
+	QueryTimeout    time.Duration
+	QueryRetries    int
+
+	// ExpiryCheckInterval is how often neighbours and locations are checked
+	// for expiry
+	ExpiryCheckInterval time.Duration
+}
+
+// WithDefaults returns the config with every zero field set to its default
+func (c GPSRConfig) WithDefaults() GPSRConfig {
+	if c.BeaconInterval == 0 {
+		c.BeaconInterval = 1000 * time.Millisecond
+	}
+	if c.AllowedBeaconLoss == 0 {
+		c.AllowedBeaconLoss = 4
+	}
+	if c.MaxHops == 0 {
+		c.MaxHops = 64
+	}
+	if c.LocationTimeout == 0 {
+		c.LocationTimeout = 10 * time.Second
+	}
+	if c.QueryTTL == 0 {
+		c.QueryTTL = 32
+	}
+	if c.QueryTimeout == 0 {
+		c.QueryTimeout = 1000 * time.Millisecond
+	}
+	if c.QueryRetries == 0 {
+		c.QueryRetries = 2
+	}
+	if c.ExpiryCheckInterval == 0 {
+		c.ExpiryCheckInterval = 1000 * time.Millisecond
+	}
+
+	return c
+}
+
+// BATMANConfig holds the B.A.T.M.A.N. parameters, a zero field takes its
+// default
+type BATMANConfig struct {
+	OriginatorInterval time.Duration
+	TTL                int
+	// WindowSize is how many of an originator's latest sequence numbers
+	// count towards picking the next hop to it
+	WindowSize int
+	// BidirectTimeout is how many of our own OGMs may go by without a
+	// neighbour echoing one before the link to it counts as one way only
+	BidirectTimeout int
+	// PurgeTimeout drops an originator nothing has been heard of for so long
+	PurgeTimeout time.Duration
+
+	// ExpiryCheckInterval is how often originators are checked for expiry
+	ExpiryCheckInterval time.Duration
+}
+
+// WithDefaults returns the config with every zero field set to its default
+func (c BATMANConfig) WithDefaults() BATMANConfig {
+	if c.OriginatorInterval == 0 {
+		c.OriginatorInterval = 1000 * time.Millisecond
+	}
+	if c.TTL == 0 {
+		c.TTL = 50
+	}
+	if c.WindowSize == 0 {
+		c.WindowSize = 64
+	}
+	if c.BidirectTimeout == 0 {
+		c.BidirectTimeout = 3
+	}
+	if c.PurgeTimeout == 0 {
+		c.PurgeTimeout = 10 * c.OriginatorInterval
+	}
+	if c.ExpiryCheckInterval == 0 {
+		c.ExpiryCheckInterval = 1000 * time.Millisecond
+	}
+
+	return c
+}
+
+// Delay tolerant routing modes understood by DTNConfig.Mode
+const (
+	// DTNEpidemic hands every packet to every drone met that lacks it
+	DTNEpidemic = "epidemic"
+	// DTNSprayAndWait hands out half the copies left at each contact, the
+	// last copy only goes to the recipient
+	DTNSprayAndWait = "spray_and_wait"
+	// DTNProphet hands a packet to drones more likely to meet its recipient
+	DTNProphet = "prophet"
+)
+
+// DTNConfig holds the delay tolerant routing parameters, a zero field takes
+// its default
+type DTNConfig struct {
+	Mode             string
+	HelloInterval    time.Duration
+	AllowedHelloLoss int
+	// SummaryInterval is how often the summary vector is broadcast again,
+	// drones that stay in contact keep swapping packets and predictabilities
+	SummaryInterval time.Duration
+	// BufferSize is how many packets a drone carries, the oldest go first
+	BufferSize int
+	// MessageLifetime is how long after its creation a packet is carried before
+	// it is dropped, however many carriers it went through
+	MessageLifetime time.Duration
+	// Copies is how many copies of a packet spray and wait hands out
+	Copies int
+
+	// PRoPHET, the predictability an encounter adds, how much of it carries
+	// over to the drones a neighbour meets and how fast it ages per
+	// AgingUnit (Lindgren et al. 2003)
+	PInit     float64
+	Beta      float64
+	Gamma     float64
+	AgingUnit time.Duration
+
+	// ExpiryCheckInterval is how often neighbours and packets are checked
+	// for expiry
+	ExpiryCheckInterval time.Duration
+}
+
+// WithDefaults returns the config with every zero field set to its default
+func (c DTNConfig) WithDefaults() DTNConfig {
+	if c.Mode == "" {
+		c.Mode = DTNEpidemic
+	}
+	if c.HelloInterval == 0 {
+		c.HelloInterval = 1000 * time.Millisecond
+	}
+	if c.AllowedHelloLoss == 0 {
+		c.AllowedHelloLoss = 2
+	}
+	if c.SummaryInterval == 0 {
+		c.SummaryInterval = 5 * c.HelloInterval
+	}
+	if c.BufferSize == 0 {
+		c.BufferSize = 128
+	}
+	if c.MessageLifetime == 0 {
+		c.MessageLifetime = 300 * time.Second
+	}
+	if c.Copies == 0 {
+		c.Copies = 8
+	}
+	if c.PInit == 0 {
+		c.PInit = 0.75
+	}
+	if c.Beta == 0 {
+		c.Beta = 0.25
+	}
+	if c.Gamma == 0 {
+		c.Gamma = 0.98
+	}
+	if c.AgingUnit == 0 {
+		c.AgingUnit = 1000 * time.Millisecond
+	}
+	if c.ExpiryCheckInterval == 0 {
+		c.ExpiryCheckInterval = 1000 * time.Millisecond
+	}
+
+	return c
+}
@@ -0,0 +1,115 @@
+package routing
+
+import (
+	"log"
+	"time"
+
+	"github.com/azaurus1/swarm/internal/sim"
+)
+
+// a route discovery in progress
+type discovery struct {
+	ttl int
+	// RREQs sent at the network diameter after the ring search ran out
+	retries int
+	timer   *sim.Event
+}
+
+// SendRREQ starts a route discovery for destination with an expanding ring
+// search (RFC3561 6.4), nothing is sent if one is already running
+func (a *AODVListener) SendRREQ(droneId string, destination string, radioQueue *sim.Queue) {
+	if _, exists := a.discoveries[destination]; exists {
+		return
+	}
+
+	d := &discovery{ttl: a.Config.TTLStart}
+
+	// start the ring where the destination was last seen
+	if entry, exists := a.RoutingTable.Entries[destination]; exists {
+		d.ttl = min(entry.HopCount+a.Config.TTLIncrement, a.Config.NetDiameter)
+	}
+
+	a.discoveries[destination] = d
+	a.attempt(droneId, destination, d, radioQueue)
+}
+
+// attempt sends the RREQ for the current ring and waits for the reply
+func (a *AODVListener) attempt(droneId string, destination string, d *discovery, radioQueue *sim.Queue) {
+	if wait := rateLimited(a.Clock.Now(), &a.sentRREQs, a.Config.RREQRateLimit); wait > 0 {
+		d.timer = a.Clock.After(wait, func() {
+			a.attempt(droneId, destination, d, radioQueue)
+		})
+		return
+	}
+
+	a.sentRREQs = append(a.sentRREQs, a.Clock.Now())
+	a.sendRREQ(droneId, destination, d.ttl, radioQueue)
+
+	d.timer = a.Clock.After(a.discoveryTimeout(d), func() {
+		a.retry(droneId, destination, d, radioQueue)
+	})
+}
+
+// retry widens the ring when no RREP came back in time, once the whole
+// network has been searched it backs off exponentially before giving up
+func (a *AODVListener) retry(droneId string, destination string, d *discovery, radioQueue *sim.Queue) {
+	switch {
+	case d.ttl < a.Config.NetDiameter:
+		d.ttl += a.Config.TTLIncrement
+		if d.ttl > a.Config.TTLThreshold {
+			d.ttl = a.Config.NetDiameter
+		}
+	case d.retries < *a.Config.RREQRetries:
+		d.retries++
+	default:
+		log.Printf("%s: no route to %s after %d RREQ retries", droneId, destination, *a.Config.RREQRetries)
+		delete(a.discoveries, destination)
+
+		a.Events.NoRoute(destination)
+		return
+	}
+
+	a.attempt(droneId, destination, d, radioQueue)
+}
+
+// discoveryDone stops the discovery for destination once a route is found
+func (a *AODVListener) discoveryDone(destination string) {
+	d, exists := a.discoveries[destination]
+	if !exists {
+		return
+	}
+
+	if d.timer != nil {
+		d.timer.Cancel()
+	}
+	delete(a.discoveries, destination)
+}
+
+// a ring gets as long as a round trip across it, the full network search
+// backs off exponentially with every retry
+func (a *AODVListener) discoveryTimeout(d *discovery) time.Duration {
+	if d.ttl < a.Config.NetDiameter {
+		return a.Config.RingTraversalTime(d.ttl)
+	}
+
+	return a.Config.NetTraversalTime() << d.retries
+}
+
+// rateLimited returns how long to wait before sending another message
+// without exceeding limit a second, sent holds the send times of the last
+// second (RFC3561 6.3 and 6.11)
+func rateLimited(now time.Time, sent *[]time.Time, limit int) time.Duration {
+	recent := (*sent)[:0]
+	for _, t := range *sent {
+		if now.Sub(t) < time.Second {
+			recent = append(recent, t)
+		}
+	}
+	*sent = recent
+
+	if len(recent) < limit {
+		return 0
+	}
+
+	return recent[0].Add(time.Second).Sub(now)
+}
@@ -0,0 +1,196 @@
+package routing
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/azaurus1/swarm/internal/sim"
+	"github.com/azaurus1/swarm/internal/types"
+)
+
+// sentRREQ is an RREQ as it went out
+type sentRREQ struct {
+	at          time.Duration
+	destination string
+	ttl         int
+}
+
+// recordRREQs collects the RREQs sent into queue and when they were sent
+func recordRREQs(sched *sim.Scheduler, queue *sim.Queue) *[]sentRREQ {
+	var sent []sentRREQ
+
+	sched.AfterEvent(func() {
+		for {
+			frame, ok := queue.Pop()
+			if !ok {
+				return
+			}
+			var msg types.DroneMessage
+			json.Unmarshal(frame, &msg)
+			if msg.AODVPayload.Type == 1 {
+				sent = append(sent, sentRREQ{sched.Elapsed(), msg.AODVPayload.DestinationId, msg.AODVPayload.TTL})
+			}
+		}
+	})
+
+	return &sent
+}
+
+func TestExpandingRing(t *testing.T) {
+	ms := time.Millisecond
+	none, one := 0, 1
+
+	// with the defaults a ring of TTL t takes 80ms*(t+2) and the network
+	// 2800ms, doubled with every retry
+	tests := []struct {
+		name    string
+		retries *int
+		// hop count of an earlier route to the destination, 0 if none
+		lastHopCount int
+		rreqs        []sentRREQ
+		noRoute      time.Duration
+	}{
+		{
+			name: "rfc defaults",
+			rreqs: []sentRREQ{
+				{0, "d", 1},
+				{240 * ms, "d", 3},
+				{640 * ms, "d", 5},
+				{1200 * ms, "d", 7},
+				// past TTLThreshold the whole network is searched
+				{1920 * ms, "d", 35},
+				{4720 * ms, "d", 35},
+				{10320 * ms, "d", 35},
+			},
+			noRoute: 21520 * ms,
+		},
+		{
+			name:    "one retry",
+			retries: &one,
+			rreqs: []sentRREQ{
+				{0, "d", 1},
+				{240 * ms, "d", 3},
+				{640 * ms, "d", 5},
+				{1200 * ms, "d", 7},
+				{1920 * ms, "d", 35},
+				{4720 * ms, "d", 35},
+			},
+			noRoute: 10320 * ms,
+		},
+		{
+			name:         "starts at the last hop count",
+			retries:      &none,
+			lastHopCount: 4,
+			rreqs: []sentRREQ{
+				{0, "d", 6},
+				{640 * ms, "d", 35},
+			},
+			noRoute: 3440 * ms,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sched := sim.NewScheduler(1)
+			queue := sim.NewQueue()
+			sent := recordRREQs(sched, queue)
+
+			a := NewAODVListener(AODVConfig{RREQRetries: tt.retries}, sched)
+			if tt.lastHopCount > 0 {
+				a.RoutingTable.Entries["d"] = RoutingTableEntry{ID: "d", HopCount: tt.lastHopCount}
+			}
+
+			var noRoute []time.Duration
+			a.SetRouteEvents(RouteEvents{OnNoRoute: func(destination string) {
+				noRoute = append(noRoute, sched.Elapsed())
+			}})
+
+			sched.At(0, func() { a.SendRREQ("a", "d", queue) })
+			sched.Run(time.Minute)
+
+			if !slices.Equal(*sent, tt.rreqs) {
+				t.Errorf("sent RREQs %v, want %v", *sent, tt.rreqs)
+			}
+			if want := []time.Duration{tt.noRoute}; !slices.Equal(noRoute, want) {
+				t.Errorf("no route at %v, want %v", noRoute, want)
+			}
+			if _, running := a.discoveries["d"]; running {
+				t.Errorf("discovery still running after it gave up")
+			}
+		})
+	}
+}
+
+func TestDiscoveryDone(t *testing.T) {
+	sched := sim.NewScheduler(1)
+	queue := sim.NewQueue()
+	sent := recordRREQs(sched, queue)
+
+	a := NewAODVListener(AODVConfig{}, sched)
+	a.SetRouteEvents(RouteEvents{OnNoRoute: func(destination string) {
+		t.Errorf("no route to %s after the route was found", destination)
+	}})
+
+	sched.At(0, func() { a.SendRREQ("a", "d", queue) })
+	// a second request while the first is running sends nothing
+	sched.At(100*time.Millisecond, func() { a.SendRREQ("a", "d", queue) })
+	// the RREP comes back after the second ring went out
+	sched.At(300*time.Millisecond, func() { a.discoveryDone("d") })
+	sched.Run(time.Minute)
+
+	want := []sentRREQ{{0, "d", 1}, {240 * time.Millisecond, "d", 3}}
+	if !slices.Equal(*sent, want) {
+		t.Errorf("sent RREQs %v, want %v", *sent, want)
+	}
+}
+
+func TestRREQRateLimit(t *testing.T) {
+	ms := time.Millisecond
+
+	tests := []struct {
+		name  string
+		limit int
+		until time.Duration
+		rreqs []sentRREQ
+	}{
+		{
+			name:  "under the limit",
+			limit: 10,
+			until: 500 * ms,
+			rreqs: []sentRREQ{{0, "b", 1}, {0, "c", 1}, {0, "d", 1}, {10 * ms, "e", 1}, {240 * ms, "b", 3}, {240 * ms, "c", 3}, {240 * ms, "d", 3}, {250 * ms, "e", 3}},
+		},
+		{
+			// the rest wait until the first two have been out a second,
+			// then the two that waited longest go and the retries of the
+			// first rings wait another second
+			name:  "limited",
+			limit: 2,
+			until: 1500 * ms,
+			rreqs: []sentRREQ{{0, "b", 1}, {0, "c", 1}, {1000 * ms, "d", 1}, {1000 * ms, "e", 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sched := sim.NewScheduler(1)
+			queue := sim.NewQueue()
+			sent := recordRREQs(sched, queue)
+
+			a := NewAODVListener(AODVConfig{RREQRateLimit: tt.limit}, sched)
+
+			sched.At(0, func() {
+				a.SendRREQ("a", "b", queue)
+				a.SendRREQ("a", "c", queue)
+				a.SendRREQ("a", "d", queue)
+			})
+			sched.At(10*ms, func() { a.SendRREQ("a", "e", queue) })
+			sched.Run(tt.until)
+
+			if !slices.Equal(*sent, tt.rreqs) {
+				t.Errorf("sent RREQs %v, want %v", *sent, tt.rreqs)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package routing
+
+import (
+	"encoding/json"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/azaurus1/swarm/internal/sim"
+	"github.com/azaurus1/swarm/internal/types"
+)
+
+// DSR is the Dynamic Source Routing protocol of RFC4728. Route requests
+// collect the path they travel, replies bring it back to the originator and
+// every DATA packet carries the full route it takes. Drones keep the paths
+// they learn in a route cache and salvage packets along another cached path
+// when a link breaks.
+type DSR struct {
+	Config DSRConfig
+	Clock  sim.Timer
+	Events RouteEvents
+
+	Cache []CachedPath
+	// the identification of the last route request we originated
+	RequestID int
+
+	// the drone we run on and its radio, set by Start
+	node       Node
+	radioQueue *sim.Queue
+
+	// route discoveries in progress, by target
+	requests map[string]*dsrRequest
+	// the route requests we've seen, by originator and identification
+	seenRequests map[string]time.Time
+}
+
+func NewDSR(config DSRConfig, clock sim.Timer) *DSR {
+	return &DSR{
+		Config:       config.WithDefaults(),
+		Clock:        clock,
+		requests:     make(map[string]*dsrRequest),
+		seenRequests: make(map[string]time.Time),
+	}
+}
+
+var (
+	_ Protocol     = (*DSR)(nil)
+	_ PacketRouter = (*DSR)(nil)
+)
+
+func (d *DSR) Name() string {
+	return "DSR"
+}
+
+// Start has nothing to schedule, DSR is purely on demand
+func (d *DSR) Start(node Node, sched *sim.Scheduler, radioQueue *sim.Queue) {
+	d.node = node
+	d.radioQueue = radioQueue
+}
+
+// HandleMessage processes a route request, reply or error
+func (d *DSR) HandleMessage(msg types.DroneMessage) {
+	dMsg := msg.DSRPayload
+	if dMsg == nil {
+		return
+	}
+
+	switch dMsg.Type {
+	case 1:
+		d.handleRREQ(*dMsg)
+	case 2:
+		d.handleRREP(*dMsg)
+	case 3:
+		d.handleRERR(*dMsg)
+	}
+}
+
+// Tick drops the stale cached paths and remembered route requests
+func (d *DSR) Tick() {
+	d.expireCache()
+
+	for key, seen := range d.seenRequests {
+		if d.Clock.Now().Sub(seen) > d.Config.MaxRequestPeriod {
+			delete(d.seenRequests, key)
+		}
+	}
+}
+
+func (d *DSR) TickInterval() time.Duration {
+	return d.Config.ExpiryCheckInterval
+}
+
+// PendingTimeout is SendBufferTimeout (RFC4728 4.2)
+func (d *DSR) PendingTimeout() time.Duration {
+	return d.Config.SendBufferTimeout
+}
+
+// HeardFrom does nothing, DSR doesn't track its neighbours
+func (d *DSR) HeardFrom(neighbour string) {}
+
+// LinkFailed drops every cached path over the link to neighbour
+func (d *DSR) LinkFailed(neighbour string) {
+	d.breakLink(d.node.ID(), neighbour)
+}
+
+// NextHop returns the first hop of the shortest cached route to destination,
+// messages without a source route of their own are forwarded by it
+func (d *DSR) NextHop(destination string) (string, bool) {
+	route, exists := d.cachedRoute(destination)
+	if !exists {
+		return "", false
+	}
+
+	return route[1], true
+}
+
+// Repairing is always false, broken routes are salvaged packet by packet
+func (d *DSR) Repairing(destination string) bool {
+	return false
+}
+
+// Unreachable only logs, the previous hop has no cache entry we could fix
+func (d *DSR) Unreachable(destination string, previousHop string) {
+	log.Printf("%s: no route to %s, dropping packet from %s", d.node.ID(), destination, previousHop)
+}
+
+func (d *DSR) SetRouteEvents(events RouteEvents) {
+	d.Events = events
+}
+
+// RoutePacket writes the cached route into a packet we originate, a packet
+// we forward goes to the drone after us on its route
+func (d *DSR) RoutePacket(packet *types.DataMessage) (string, bool) {
+	if len(packet.SourceRoute) == 0 {
+		route, exists := d.cachedRoute(packet.RecipientID)
+		if !exists {
+			return "", false
+		}
+
+		packet.SourceRoute = route
+		return route[1], true
+	}
+
+	return d.nextOnRoute(packet.SourceRoute)
+}
+
+// nextOnRoute returns the drone after us on route
+func (d *DSR) nextOnRoute(route []string) (string, bool) {
+	i := slices.Index(route, d.node.ID())
+	if i < 0 || i+1 >= len(route) {
+		return "", false
+	}
+
+	return route[i+1], true
+}
+
+// sendAlong unicasts msg to the next drone on its source route
+func (d *DSR) sendAlong(msg types.DSRMessage) {
+	nextHop, exists := d.nextOnRoute(msg.SourceRoute)
+	if !exists {
+		return
+	}
+
+	d.send(msg, nextHop)
+}
+
+// send transmits msg, to nextHop or to every neighbour if nextHop is empty
+func (d *DSR) send(msg types.DSRMessage, nextHop string) {
+	dMsg := types.DroneMessage{
+		Source:     d.node.ID(),
+		NextHop:    nextHop,
+		Type:       "DSR",
+		DSRPayload: &msg,
+	}
+
+	data, _ := json.Marshal(dMsg)
+
+	d.radioQueue.Push(data)
+}
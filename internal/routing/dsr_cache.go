@@ -0,0 +1,103 @@
+package routing
+
+import (
+	"slices"
+	"time"
+)
+
+// the route cache holds this many paths, the oldest is dropped for a new one
+const routeCacheSize = 64
+
+// CachedPath is a path from us through the network, it gives a route to every
+// drone on it (RFC4728 4.1)
+type CachedPath struct {
+	Hops    []string
+	Expires time.Time
+}
+
+// learnPath caches path, which starts with us, or refreshes it if it is
+// already known
+func (d *DSR) learnPath(path []string) {
+	if len(path) < 2 || slices.Contains(path[1:], d.node.ID()) {
+		return
+	}
+
+	expires := d.Clock.Now().Add(d.Config.RouteCacheTimeout)
+
+	for i := range d.Cache {
+		if slices.Equal(d.Cache[i].Hops, path) {
+			d.Cache[i].Expires = expires
+			return
+		}
+	}
+
+	if len(d.Cache) >= routeCacheSize {
+		d.Cache = d.Cache[1:]
+	}
+	d.Cache = append(d.Cache, CachedPath{Hops: slices.Clone(path), Expires: expires})
+
+	// a discovery is over as soon as any path to its target is known
+	for _, target := range sortedKeys(d.requests) {
+		if slices.Contains(path, target) {
+			d.requestDone(target)
+			d.Events.Route(target)
+		}
+	}
+}
+
+// cachedRoute returns the shortest cached route from us to destination
+func (d *DSR) cachedRoute(destination string) ([]string, bool) {
+	var best []string
+
+	for _, path := range d.Cache {
+		i := slices.Index(path.Hops, destination)
+		if i > 0 && (best == nil || i+1 < len(best)) {
+			best = path.Hops[:i+1]
+		}
+	}
+
+	return slices.Clone(best), best != nil
+}
+
+// breakLink cuts every cached path short where it uses the link from one
+// drone to the next (RFC4728 8.3.4)
+func (d *DSR) breakLink(from string, to string) {
+	kept := d.Cache[:0]
+
+	for _, path := range d.Cache {
+		for i := 0; i+1 < len(path.Hops); i++ {
+			if path.Hops[i] == from && path.Hops[i+1] == to {
+				path.Hops = path.Hops[:i+1]
+				break
+			}
+		}
+
+		if len(path.Hops) >= 2 {
+			kept = append(kept, path)
+		}
+	}
+
+	d.Cache = kept
+}
+
+// expireCache drops the paths that haven't been learned again for
+// RouteCacheTimeout
+func (d *DSR) expireCache() {
+	kept := d.Cache[:0]
+
+	for _, path := range d.Cache {
+		if !path.Expires.Before(d.Clock.Now()) {
+			kept = append(kept, path)
+		}
+	}
+
+	d.Cache = kept
+}
+
+// reversed returns path back to front, links are assumed to work both ways
+func reversed(path []string) []string {
+	r := slices.Clone(path)
+	slices.Reverse(r)
+
+	return r
+}
@@ -0,0 +1,176 @@
+package routing
+
+import (
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/azaurus1/swarm/internal/sim"
+	"github.com/azaurus1/swarm/internal/types"
+)
+
+// a DSR route discovery in progress
+type dsrRequest struct {
+	// propagating requests sent so far
+	retries int
+	timer   *sim.Event
+}
+
+// RequestRoute starts a route discovery for destination unless a route to it
+// is cached or one is already running. A non-propagating request asks the
+// neighbours first, then requests flood the network with exponential backoff
+// between them (RFC4728 8.2.1 and 8.3).
+func (d *DSR) RequestRoute(destination string) {
+	if _, exists := d.cachedRoute(destination); exists {
+		d.Events.Route(destination)
+		return
+	}
+	if _, exists := d.requests[destination]; exists {
+		return
+	}
+
+	r := &dsrRequest{}
+	d.requests[destination] = r
+
+	d.sendRequest(destination, 1)
+	r.timer = d.Clock.After(d.Config.NonpropRequestTimeout, func() {
+		d.retryRequest(destination, r)
+	})
+}
+
+// retryRequest floods another request for destination, after
+// MaxRequestRexmt of them the discovery gives up
+func (d *DSR) retryRequest(destination string, r *dsrRequest) {
+	if r.retries >= d.Config.MaxRequestRexmt {
+		log.Printf("%s: no route to %s after %d route requests", d.node.ID(), destination, r.retries)
+		delete(d.requests, destination)
+		d.Events.NoRoute(destination)
+		return
+	}
+
+	period := min(d.Config.RequestPeriod<<r.retries, d.Config.MaxRequestPeriod)
+	r.retries++
+
+	d.sendRequest(destination, d.Config.DiscoveryHopLimit)
+	r.timer = d.Clock.After(period, func() {
+		d.retryRequest(destination, r)
+	})
+}
+
+// requestDone stops the discovery for target once a route to it is cached
+func (d *DSR) requestDone(target string) {
+	r, exists := d.requests[target]
+	if !exists {
+		return
+	}
+
+	if r.timer != nil {
+		r.timer.Cancel()
+	}
+	delete(d.requests, target)
+}
+
+func (d *DSR) sendRequest(target string, ttl int) {
+	self := d.node.ID()
+	d.RequestID = seqNext(d.RequestID)
+	d.seenRequests[fmt.Sprintf("%s-%d", self, d.RequestID)] = d.Clock.Now()
+
+	log.Printf("%s: sending route request %d for %s with TTL %d", self, d.RequestID, target, ttl)
+
+	d.send(types.DSRMessage{
+		Type:           1,
+		Identification: d.RequestID,
+		OriginatorId:   self,
+		Target:         target,
+		Route:          []string{self},
+		TTL:            ttl,
+	}, "")
+}
+
+// handleRREQ answers a request for us or one we have a cached route for,
+// otherwise we add ourselves to its route and pass it on (RFC4728 8.2.2)
+func (d *DSR) handleRREQ(msg types.DSRMessage) {
+	self := d.node.ID()
+	if slices.Contains(msg.Route, self) {
+		return
+	}
+
+	// everyone the request passed is reachable back along its route
+	travelled := append(slices.Clone(msg.Route), self)
+	d.learnPath(reversed(travelled))
+
+	// the target answers every copy, each came along a different route
+	if msg.Target == self {
+		log.Printf("%s: answering route request %d from %s", self, msg.Identification, msg.OriginatorId)
+		d.reply(msg, travelled, travelled)
+		return
+	}
+
+	key := fmt.Sprintf("%s-%d", msg.OriginatorId, msg.Identification)
+	if _, seen := d.seenRequests[key]; seen {
+		return
+	}
+	d.seenRequests[key] = d.Clock.Now()
+
+	// answer from the cache if the route we know doesn't loop back through
+	// the request's (RFC4728 8.2.3)
+	if cached, exists := d.cachedRoute(msg.Target); exists {
+		route := append(slices.Clone(msg.Route), cached...)
+		if !hasDuplicates(route) {
+			log.Printf("%s: answering route request %d from %s from the route cache", self, msg.Identification, msg.OriginatorId)
+			d.reply(msg, travelled, route)
+			return
+		}
+	}
+
+	if msg.TTL <= 1 {
+		return
+	}
+
+	msg.Route = travelled
+	msg.TTL--
+	d.send(msg, "")
+}
+
+// reply sends route back to the request's originator along the way the
+// request came
+func (d *DSR) reply(request types.DSRMessage, travelled []string, route []string) {
+	d.sendAlong(types.DSRMessage{
+		Type:           2,
+		SourceRoute:    reversed(travelled),
+		Identification: request.Identification,
+		OriginatorId:   request.OriginatorId,
+		Target:         request.Target,
+		Route:          route,
+	})
+}
+
+// handleRREP caches the route in both directions from us, the originator
+// ends its discovery and everyone else passes the reply on
+func (d *DSR) handleRREP(msg types.DSRMessage) {
+	self := d.node.ID()
+
+	if i := slices.Index(msg.Route, self); i >= 0 {
+		d.learnPath(msg.Route[i:])
+		d.learnPath(reversed(msg.Route[:i+1]))
+	}
+
+	if msg.OriginatorId == self {
+		log.Printf("%s: route to %s: %v", self, msg.Target, msg.Route)
+		return
+	}
+
+	d.sendAlong(msg)
+}
+
+func hasDuplicates(route []string) bool {
+	seen := make(map[string]bool, len(route))
+	for _, id := range route {
+		if seen[id] {
+			return true
+		}
+		seen[id] = true
+	}
+
+	return false
+}
@@ -0,0 +1,61 @@
+package routing
+
+import (
+	"log"
+	"slices"
+
+	"github.com/azaurus1/swarm/internal/types"
+)
+
+// SalvagePacket handles a packet whose next hop couldn't be reached. The
+// drone that routed it is told the link is broken and, unless the packet has
+// been salvaged MaxSalvageCount times already, it goes on along another
+// cached route (RFC4728 8.4.1).
+func (d *DSR) SalvagePacket(packet *types.DataMessage) (string, bool) {
+	self := d.node.ID()
+
+	i := slices.Index(packet.SourceRoute, self)
+	if i < 0 || i+1 >= len(packet.SourceRoute) {
+		return "", false
+	}
+
+	if i > 0 {
+		d.sendAlong(types.DSRMessage{
+			Type:            3,
+			SourceRoute:     reversed(packet.SourceRoute[:i+1]),
+			ErrorSource:     self,
+			UnreachableNode: packet.SourceRoute[i+1],
+		})
+
+		if packet.Salvage >= d.Config.MaxSalvageCount {
+			log.Printf("%s: packet for %s salvaged %d times already, dropping", self, packet.RecipientID, packet.Salvage)
+			return "", false
+		}
+	}
+
+	route, exists := d.cachedRoute(packet.RecipientID)
+	if !exists {
+		return "", false
+	}
+
+	// our own packets just take another route
+	if i > 0 {
+		packet.Salvage++
+	}
+	packet.SourceRoute = route
+
+	return route[1], true
+}
+
+// handleRERR drops the broken link from the cache and passes the error on
+// to whoever routed the packet over it (RFC4728 8.3.4)
+func (d *DSR) handleRERR(msg types.DSRMessage) {
+	d.breakLink(msg.ErrorSource, msg.UnreachableNode)
+
+	if len(msg.SourceRoute) == 0 || msg.SourceRoute[len(msg.SourceRoute)-1] == d.node.ID() {
+		log.Printf("%s: route error, link from %s to %s is broken", d.node.ID(), msg.ErrorSource, msg.UnreachableNode)
+		return
+	}
+
+	d.sendAlong(msg)
+}
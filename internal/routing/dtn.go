@@ -0,0 +1,275 @@
+package routing
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/azaurus1/swarm/internal/sim"
+	"github.com/azaurus1/swarm/internal/types"
+)
+
+// DTN is delay tolerant routing for swarms that split apart. Drones store
+// the DATA packets they are given and carry them, whenever two meet they
+// swap summary vectors of what they carry and each hands the other the
+// packets it lacks, by epidemic, spray and wait or PRoPHET rules.
+type DTN struct {
+	Config     DTNConfig
+	Clock      sim.Timer
+	Events     RouteEvents
+	Neighbours *NeighbourTable
+	// Buffer holds the packets we carry, by checksum
+	Buffer map[string]*Bundle
+	// Arrived are the packets we know reached their recipient, by checksum
+	Arrived map[string]time.Time
+	// Predictabilities, PRoPHET only, is how likely we are to meet each drone
+	Predictabilities map[string]float64
+
+	// the drone we run on and its radio, set by Start
+	node       Node
+	radioQueue *sim.Queue
+
+	// by neighbour, the packets it has as of its last summary vector and,
+	// for PRoPHET, its predictabilities
+	summaries        map[string]map[string]bool
+	predictabilities map[string]map[string]float64
+	// when the predictabilities were last aged
+	aged time.Time
+}
+
+// Bundle is a packet we carry
+type Bundle struct {
+	Packet types.DataMessage
+	Stored time.Time
+
+	// spray and wait only, the copies handed to each neighbour that its
+	// summary vector hasn't confirmed yet
+	pending map[string]int
+}
+
+func NewDTN(config DTNConfig, clock sim.Timer) *DTN {
+	config = config.WithDefaults()
+
+	return &DTN{
+		Config:           config,
+		Clock:            clock,
+		Neighbours:       NewNeighbourTable(config.HelloInterval, config.AllowedHelloLoss, clock),
+		Buffer:           make(map[string]*Bundle),
+		Arrived:          make(map[string]time.Time),
+		Predictabilities: make(map[string]float64),
+		summaries:        make(map[string]map[string]bool),
+		predictabilities: make(map[string]map[string]float64),
+	}
+}
+
+var (
+	_ Protocol  = (*DTN)(nil)
+	_ Custodian = (*DTN)(nil)
+)
+
+func (d *DTN) Name() string {
+	return "DTN"
+}
+
+// Start schedules the HELLOs and summary vectors, offset by a random
+// fraction of their interval so the drones don't all transmit in the same
+// instant
+func (d *DTN) Start(node Node, sched *sim.Scheduler, radioQueue *sim.Queue) {
+	d.node = node
+	d.radioQueue = radioQueue
+	d.aged = sched.Now()
+
+	d.Neighbours.OnLinkBreak = func(neighbour string) {
+		log.Printf("drone %s > lost neighbour %s", node.ID(), neighbour)
+		delete(d.summaries, neighbour)
+		delete(d.predictabilities, neighbour)
+		d.confirm(neighbour, nil)
+	}
+
+	offset := time.Duration(sched.Rand.Int63n(int64(d.Config.HelloInterval)))
+	sched.Every(offset, d.Config.HelloInterval, func() {
+		d.send(types.DTNMessage{Type: 1}, "")
+	})
+
+	offset = time.Duration(sched.Rand.Int63n(int64(d.Config.SummaryInterval)))
+	sched.Every(offset, d.Config.SummaryInterval, func() {
+		if len(d.Neighbours.Entries) > 0 {
+			d.sendSummary("")
+		}
+	})
+}
+
+// HandleMessage processes a HELLO or a summary vector, HELLOs only keep the
+// neighbour alive
+func (d *DTN) HandleMessage(msg types.DroneMessage) {
+	dMsg := msg.DTNPayload
+	if dMsg == nil {
+		return
+	}
+
+	switch dMsg.Type {
+	case 1:
+		d.Neighbours.HeardHello(msg.Source, nil)
+	case 2:
+		d.handleSummary(msg.Source, *dMsg)
+	}
+}
+
+// Tick drops the neighbours we no longer hear, the packets older than their
+// lifetime and ages the predictabilities
+func (d *DTN) Tick() {
+	d.Neighbours.Expire()
+
+	now := d.Clock.Now()
+	for _, id := range sortedKeys(d.Buffer) {
+		if now.Sub(*d.Buffer[id].Packet.Created) > d.Config.MessageLifetime {
+			log.Printf("%s: packet for %s expired, dropping it", d.node.ID(), d.Buffer[id].Packet.RecipientID)
+			delete(d.Buffer, id)
+		}
+	}
+	for id, delivered := range d.Arrived {
+		if now.Sub(delivered) > d.Config.MessageLifetime {
+			delete(d.Arrived, id)
+		}
+	}
+
+	if d.Config.Mode == DTNProphet {
+		d.age()
+	}
+}
+
+func (d *DTN) TickInterval() time.Duration {
+	return d.Config.ExpiryCheckInterval
+}
+
+// PendingTimeout is MessageLifetime, packets held for a drone we haven't met
+// yet are carried as long
+func (d *DTN) PendingTimeout() time.Duration {
+	return d.Config.MessageLifetime
+}
+
+// HeardFrom keeps neighbour alive, a drone we didn't have as a neighbour is
+// a contact and gets our summary vector
+func (d *DTN) HeardFrom(neighbour string) {
+	_, known := d.Neighbours.Entries[neighbour]
+	d.Neighbours.HeardFrom(neighbour)
+
+	if !known {
+		d.contact(neighbour)
+	}
+}
+
+func (d *DTN) LinkFailed(neighbour string) {
+	d.Neighbours.Remove(neighbour)
+}
+
+// NextHop only knows the way to our neighbours, DATA packets are carried
+// rather than routed
+func (d *DTN) NextHop(destination string) (string, bool) {
+	if _, neighbour := d.Neighbours.Entries[destination]; neighbour {
+		return destination, true
+	}
+
+	return "", false
+}
+
+// RequestRoute raises OnRoute if destination is a neighbour, otherwise it
+// will be once we meet it
+func (d *DTN) RequestRoute(destination string) {
+	if _, neighbour := d.Neighbours.Entries[destination]; neighbour {
+		d.Events.Route(destination)
+		return
+	}
+
+	log.Printf("%s: %s isn't in contact, waiting to meet it", d.node.ID(), destination)
+}
+
+// Repairing is always false, there are no routes to repair
+func (d *DTN) Repairing(destination string) bool {
+	return false
+}
+
+// Unreachable only logs, DATA packets never need it
+func (d *DTN) Unreachable(destination string, previousHop string) {
+	log.Printf("%s: %s isn't in contact, dropping packet from %s", d.node.ID(), destination, previousHop)
+}
+
+func (d *DTN) SetRouteEvents(events RouteEvents) {
+	d.Events = events
+}
+
+// contact starts the exchange with a drone we just met, it gets our summary
+// vector and sends us its own when it hears from us
+func (d *DTN) contact(neighbour string) {
+	log.Printf("drone %s > contact with %s", d.node.ID(), neighbour)
+
+	if d.Config.Mode == DTNProphet {
+		d.encounter(neighbour)
+	}
+	d.sendSummary(neighbour)
+
+	// packets held for it, commands for example, can go out now
+	d.Events.Route(neighbour)
+}
+
+// sendSummary sends our summary vector to neighbour, or to every neighbour
+// if it is empty
+func (d *DTN) sendSummary(neighbour string) {
+	summary := types.DTNMessage{
+		Type:      2,
+		Summary:   sortedKeys(d.Buffer),
+		Delivered: sortedKeys(d.Arrived),
+	}
+	if d.Config.Mode == DTNProphet {
+		summary.Predictabilities = d.Predictabilities
+	}
+
+	d.send(summary, neighbour)
+}
+
+// handleSummary learns what neighbour carries, drops what it says was
+// delivered and hands it the packets it lacks. The first summary of a
+// contact also carries PRoPHET's transitivity over.
+func (d *DTN) handleSummary(neighbour string, msg types.DTNMessage) {
+	has := make(map[string]bool)
+	for _, id := range msg.Summary {
+		has[id] = true
+	}
+	for _, id := range msg.Delivered {
+		has[id] = true
+		if _, delivered := d.Arrived[id]; !delivered {
+			d.Arrived[id] = d.Clock.Now()
+		}
+		delete(d.Buffer, id)
+	}
+	d.confirm(neighbour, has)
+	_, inContact := d.summaries[neighbour]
+	d.summaries[neighbour] = has
+
+	// transitivity applies once per contact like the encounter itself, the
+	// summaries repeated while it lasts only bring the neighbour's up to date
+	if d.Config.Mode == DTNProphet {
+		d.predictabilities[neighbour] = msg.Predictabilities
+		if !inContact {
+			d.transit(neighbour, msg.Predictabilities)
+		}
+	}
+
+	for _, id := range sortedKeys(d.Buffer) {
+		d.offer(neighbour, d.Buffer[id])
+	}
+}
+
+// send transmits msg, to nextHop or to every neighbour if nextHop is empty
+func (d *DTN) send(msg types.DTNMessage, nextHop string) {
+	dMsg := types.DroneMessage{
+		Source:     d.node.ID(),
+		NextHop:    nextHop,
+		Type:       "DTN",
+		DTNPayload: &msg,
+	}
+
+	data, _ := json.Marshal(dMsg)
+
+	d.radioQueue.Push(data)
+}
@@ -0,0 +1,123 @@
+package routing
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/azaurus1/swarm/internal/types"
+)
+
+// Store takes custody of packet and offers it to the neighbours we've had
+// summary vectors from, bar the one it came from. A packet we originate
+// starts with Copies copies to spray and is stamped with its creation time,
+// the oldest packet makes room when the buffer is full.
+func (d *DTN) Store(packet types.DataMessage, from string) {
+	self := d.node.ID()
+
+	if _, delivered := d.Arrived[packet.Checksum]; delivered {
+		return
+	}
+	if packet.SenderID == self && packet.Copies == 0 {
+		packet.Copies = d.Config.Copies
+	}
+	if packet.Created == nil {
+		created := d.Clock.Now()
+		packet.Created = &created
+	}
+
+	if len(d.Buffer) >= d.Config.BufferSize {
+		oldest := ""
+		for _, id := range sortedKeys(d.Buffer) {
+			if oldest == "" || d.Buffer[id].Stored.Before(d.Buffer[oldest].Stored) {
+				oldest = id
+			}
+		}
+		log.Printf("%s: buffer full, dropping packet for %s", self, d.Buffer[oldest].Packet.RecipientID)
+		delete(d.Buffer, oldest)
+	}
+
+	if has, exists := d.summaries[from]; exists {
+		has[packet.Checksum] = true
+	}
+
+	b := &Bundle{Packet: packet, Stored: d.Clock.Now(), pending: make(map[string]int)}
+	d.Buffer[packet.Checksum] = b
+	log.Printf("%s: carrying packet for %s (%d carried)", self, packet.RecipientID, len(d.Buffer))
+
+	for _, neighbour := range sortedKeys(d.summaries) {
+		if _, exists := d.Buffer[packet.Checksum]; !exists {
+			break
+		}
+		d.offer(neighbour, b)
+	}
+}
+
+// confirm settles the copies handed to neighbour, has is what its latest
+// summary vector says it carries. Copies it has are gone from ours, the
+// others failed to get there and are ours to spray again.
+func (d *DTN) confirm(neighbour string, has map[string]bool) {
+	for _, id := range sortedKeys(d.Buffer) {
+		b := d.Buffer[id]
+		if copies, pending := b.pending[neighbour]; pending {
+			if has[id] {
+				b.Packet.Copies -= copies
+			}
+			delete(b.pending, neighbour)
+		}
+	}
+}
+
+// Delivered notes a packet reached us, it goes in our summary vectors so
+// nobody hands it over again and the carriers we meet drop it
+func (d *DTN) Delivered(packet types.DataMessage) {
+	d.Arrived[packet.Checksum] = d.Clock.Now()
+	delete(d.Buffer, packet.Checksum)
+}
+
+// offer hands b to neighbour if it lacks it and the mode says so, the
+// recipient always gets it. We keep carrying it until the neighbour's
+// summary vector confirms the handover, a copy lost to a failed link isn't
+// lost for good.
+func (d *DTN) offer(neighbour string, b *Bundle) {
+	id := b.Packet.Checksum
+	if d.summaries[neighbour][id] {
+		return
+	}
+
+	packet := b.Packet
+
+	switch {
+	case neighbour == packet.RecipientID:
+		// dropped once its summary vector lists the packet as delivered
+	case d.Config.Mode == DTNSprayAndWait:
+		// binary spray, the last copy waits for the recipient. Copies
+		// handed over only count once the neighbour confirms them.
+		copies := b.Packet.Copies
+		for _, pending := range b.pending {
+			copies -= pending
+		}
+		if copies <= 1 {
+			return
+		}
+		packet.Copies = copies / 2
+		b.pending[neighbour] = packet.Copies
+	case d.Config.Mode == DTNProphet:
+		if d.predictabilities[neighbour][packet.RecipientID] <= d.Predictabilities[packet.RecipientID] {
+			return
+		}
+	}
+
+	log.Printf("%s: handing packet for %s to %s", d.node.ID(), packet.RecipientID, neighbour)
+	d.summaries[neighbour][id] = true
+
+	dMsg := types.DroneMessage{
+		Source:      d.node.ID(),
+		NextHop:     neighbour,
+		Type:        "DATA",
+		DataPayload: packet,
+	}
+
+	data, _ := json.Marshal(dMsg)
+
+	d.radioQueue.Push(data)
+}
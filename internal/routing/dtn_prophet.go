@@ -0,0 +1,43 @@
+package routing
+
+import "math"
+
+// PRoPHET delivery predictabilities (Lindgren, Doria and Schelén, 2003).
+// Meeting a drone raises our predictability for it, it carries over in part
+// to the drones it is likely to meet and fades while we don't meet it.
+
+// encounter raises our predictability for neighbour, we just met it
+func (d *DTN) encounter(neighbour string) {
+	p := d.Predictabilities[neighbour]
+	d.Predictabilities[neighbour] = p + (1-p)*d.Config.PInit
+}
+
+// transit raises our predictability for every drone neighbour is likely to
+// meet, we may hand it packets for them
+func (d *DTN) transit(neighbour string, theirs map[string]float64) {
+	self := d.node.ID()
+	viaNeighbour := d.Predictabilities[neighbour]
+
+	for _, id := range sortedKeys(theirs) {
+		if id == self || id == neighbour {
+			continue
+		}
+
+		p := d.Predictabilities[id]
+		d.Predictabilities[id] = p + (1-p)*viaNeighbour*theirs[id]*d.Config.Beta
+	}
+}
+
+// age fades every predictability by Gamma for each AgingUnit gone by
+func (d *DTN) age() {
+	units := d.Clock.Now().Sub(d.aged) / d.Config.AgingUnit
+	if units <= 0 {
+		return
+	}
+	d.aged = d.aged.Add(units * d.Config.AgingUnit)
+
+	factor := math.Pow(d.Config.Gamma, float64(units))
+	for id, p := range d.Predictabilities {
+		d.Predictabilities[id] = p * factor
+	}
+}
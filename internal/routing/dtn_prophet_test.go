@@ -0,0 +1,145 @@
+package routing
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/azaurus1/swarm/internal/sim"
+	"github.com/azaurus1/swarm/internal/types"
+)
+
+func newTestProphet(sched *sim.Scheduler, predictabilities map[string]float64) *DTN {
+	d := NewDTN(DTNConfig{Mode: DTNProphet}, sched)
+	d.node = testNode{id: "a"}
+	d.aged = sched.Now()
+	for id, p := range predictabilities {
+		d.Predictabilities[id] = p
+	}
+	return d
+}
+
+// samePredictabilities compares predictabilities up to rounding
+func samePredictabilities(t *testing.T, got map[string]float64, want map[string]float64) {
+	t.Helper()
+
+	for _, id := range sortedKeys(want) {
+		if math.Abs(got[id]-want[id]) > 1e-9 {
+			t.Errorf("P(a, %s) = %v, want %v", id, got[id], want[id])
+		}
+	}
+	for _, id := range sortedKeys(got) {
+		if _, expected := want[id]; !expected && got[id] != 0 {
+			t.Errorf("P(a, %s) = %v, want none", id, got[id])
+		}
+	}
+}
+
+func TestEncounter(t *testing.T) {
+	tests := []struct {
+		name   string
+		before float64
+		after  float64
+	}{
+		{"first meeting", 0, 0.75},
+		{"met before", 0.5, 0.875},
+		{"certain already", 1, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestProphet(sim.NewScheduler(1), map[string]float64{"b": tt.before})
+
+			d.encounter("b")
+
+			samePredictabilities(t, d.Predictabilities, map[string]float64{"b": tt.after})
+		})
+	}
+}
+
+func TestTransit(t *testing.T) {
+	tests := []struct {
+		name   string
+		ours   map[string]float64
+		theirs map[string]float64
+		after  map[string]float64
+	}{
+		{
+			name:   "new destination",
+			ours:   map[string]float64{"b": 0.5},
+			theirs: map[string]float64{"c": 0.8},
+			after:  map[string]float64{"b": 0.5, "c": 0.1},
+		},
+		{
+			name:   "known destination",
+			ours:   map[string]float64{"b": 0.5, "c": 0.5},
+			theirs: map[string]float64{"c": 0.8},
+			after:  map[string]float64{"b": 0.5, "c": 0.55},
+		},
+		{
+			name:   "not to ourselves or the neighbour",
+			ours:   map[string]float64{"b": 0.5},
+			theirs: map[string]float64{"a": 0.9, "b": 1},
+			after:  map[string]float64{"b": 0.5},
+		},
+		{
+			name:   "neighbour we never met",
+			ours:   map[string]float64{},
+			theirs: map[string]float64{"c": 0.8},
+			after:  map[string]float64{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestProphet(sim.NewScheduler(1), tt.ours)
+
+			d.transit("b", tt.theirs)
+
+			samePredictabilities(t, d.Predictabilities, tt.after)
+		})
+	}
+}
+
+func TestAge(t *testing.T) {
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		after   float64
+		aged    time.Duration
+	}{
+		{"under a unit", 500 * time.Millisecond, 1, 0},
+		{"one unit", time.Second, 0.98, time.Second},
+		{"partial units carry over", 2500 * time.Millisecond, 0.98 * 0.98, 2 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sched := sim.NewScheduler(1)
+			d := newTestProphet(sched, map[string]float64{"b": 1})
+
+			sched.Run(tt.elapsed)
+			d.age()
+
+			samePredictabilities(t, d.Predictabilities, map[string]float64{"b": tt.after})
+			if aged := d.aged.Sub(sim.Epoch); aged != tt.aged {
+				t.Errorf("aged up to %s, want %s", aged, tt.aged)
+			}
+		})
+	}
+}
+
+func TestTransitOncePerContact(t *testing.T) {
+	d := newTestProphet(sim.NewScheduler(1), map[string]float64{"b": 0.5})
+	summary := types.DTNMessage{Type: 2, Predictabilities: map[string]float64{"c": 0.8}}
+
+	d.handleSummary("b", summary)
+	d.handleSummary("b", summary)
+	samePredictabilities(t, d.Predictabilities, map[string]float64{"b": 0.5, "c": 0.1})
+
+	// the contact ends as a lost neighbour does, the next one carries it
+	// over again
+	delete(d.summaries, "b")
+	d.handleSummary("b", summary)
+	samePredictabilities(t, d.Predictabilities, map[string]float64{"b": 0.5, "c": 0.19})
+}
@@ -0,0 +1,100 @@
+package routing
+
+import (
+	"math"
+	"time"
+
+	"github.com/azaurus1/swarm/internal/types"
+)
+
+// Link expiration time prediction (Su, Lee and Gerla, 2001). Two drones at
+// p1 and p2 moving at v1 and v2 stay in each other's range r for
+//
+//	LET = (-(ab+cd) + sqrt((a²+c²)r² - (ad-bc)²)) / (a²+c²)
+//
+// with a = v1x-v2x, b = p1x-p2x, c = v1y-v2y and d = p1y-p2y. Durations of
+// zero stand for links and paths that aren't predicted to break.
+
+// predictLinkExpiration is how long drones at p1 and p2 moving at v1 and v2
+// stay within r of each other, false if they move alike and never part
+func predictLinkExpiration(p1 types.Position, v1 types.Velocity, p2 types.Position, v2 types.Velocity, r float64) (time.Duration, bool) {
+	a := v1.X - v2.X
+	b := p1.X - p2.X
+	c := v1.Y - v2.Y
+	d := p1.Y - p2.Y
+
+	speed := a*a + c*c
+	if speed == 0 {
+		return 0, false
+	}
+
+	// out of range already, or only ever grazing it
+	discriminant := speed*r*r - (a*d-b*c)*(a*d-b*c)
+	if discriminant < 0 {
+		return 0, true
+	}
+
+	seconds := max(0, (-(a*b+c*d)+math.Sqrt(discriminant))/speed)
+
+	return time.Duration(seconds * float64(time.Second)), true
+}
+
+// linkExpiration is how long the link to neighbour is predicted to last,
+// from where its last HELLO put it and how it was moving. It is zero
+// without link expiration prediction, for a neighbour whose motion we don't
+// know and for one that moves alike.
+func (a *AODVListener) linkExpiration(neighbour string) time.Duration {
+	entry, exists := a.Neighbours.Entries[neighbour]
+	if !a.Config.LinkExpiration || !exists || entry.Position == nil || entry.Velocity == nil {
+		return 0
+	}
+
+	elapsed := a.Clock.Now().Sub(entry.LastHello).Seconds()
+	position := types.Position{
+		X: entry.Position.X + entry.Velocity.X*elapsed,
+		Y: entry.Position.Y + entry.Velocity.Y*elapsed,
+	}
+
+	expiration, parts := predictLinkExpiration(a.node.Position(), a.node.Velocity(), position, *entry.Velocity, a.node.Range())
+	if !parts {
+		return 0
+	}
+
+	// a link at the edge of range breaks now but isn't one that never does
+	return max(expiration, time.Millisecond)
+}
+
+// pathExpiration is how long the path advertised as lasting advertised is
+// predicted to last once it includes the link to neighbour, the shorter of
+// the two
+func (a *AODVListener) pathExpiration(advertised time.Duration, neighbour string) time.Duration {
+	link := a.linkExpiration(neighbour)
+
+	switch {
+	case link == 0:
+		return advertised
+	case advertised == 0:
+		return link
+	default:
+		return min(advertised, link)
+	}
+}
+
+// expiryIn is when a link or path predicted to last expiration breaks, zero
+// if it isn't predicted to
+func (a *AODVListener) expiryIn(expiration time.Duration) time.Time {
+	if expiration == 0 {
+		return time.Time{}
+	}
+
+	return a.Clock.Now().Add(expiration)
+}
+
+// expiresIn is how long until linkExpiry, zero if it is zero
+func (a *AODVListener) expiresIn(linkExpiry time.Time) time.Duration {
+	if linkExpiry.IsZero() {
+		return 0
+	}
+
+	return max(linkExpiry.Sub(a.Clock.Now()), time.Millisecond)
+}
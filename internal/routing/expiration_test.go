@@ -0,0 +1,39 @@
+package routing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/azaurus1/swarm/internal/types"
+)
+
+func TestPredictLinkExpiration(t *testing.T) {
+	tests := []struct {
+		name       string
+		p1         types.Position
+		v1         types.Velocity
+		p2         types.Position
+		v2         types.Velocity
+		r          float64
+		expiration time.Duration
+		parts      bool
+	}{
+		{"moving apart", types.Position{}, types.Velocity{X: 1}, types.Position{}, types.Velocity{}, 10, 10 * time.Second, true},
+		{"both moving apart", types.Position{}, types.Velocity{X: 1}, types.Position{}, types.Velocity{X: -1}, 10, 5 * time.Second, true},
+		{"passing through", types.Position{X: -10}, types.Velocity{X: 1}, types.Position{}, types.Velocity{}, 5, 15 * time.Second, true},
+		{"diagonal", types.Position{}, types.Velocity{X: 3, Y: 4}, types.Position{}, types.Velocity{}, 10, 2 * time.Second, true},
+		{"moving alike", types.Position{X: 1}, types.Velocity{X: 1, Y: 1}, types.Position{}, types.Velocity{X: 1, Y: 1}, 10, 0, false},
+		{"standing still", types.Position{X: 1}, types.Velocity{}, types.Position{}, types.Velocity{}, 10, 0, false},
+		{"passing wide", types.Position{X: -10, Y: 10}, types.Velocity{X: 1}, types.Position{}, types.Velocity{}, 5, 0, true},
+		{"already out of range", types.Position{X: 20}, types.Velocity{X: 1}, types.Position{}, types.Velocity{}, 5, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expiration, parts := predictLinkExpiration(tt.p1, tt.v1, tt.p2, tt.v2, tt.r)
+			if expiration != tt.expiration || parts != tt.parts {
+				t.Errorf("predictLinkExpiration = %s, %v, want %s, %v", expiration, parts, tt.expiration, tt.parts)
+			}
+		})
+	}
+}
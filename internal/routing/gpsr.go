@@ -0,0 +1,217 @@
+package routing
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/azaurus1/swarm/internal/sim"
+	"github.com/azaurus1/swarm/internal/types"
+)
+
+// GPSR is Greedy Perimeter Stateless Routing (Karp and Kung, 2000). Drones
+// beacon their position to their neighbours and forward each packet to the
+// neighbour closest to its destination's position, around the face of a
+// planar subgraph where no neighbour is closer. A small location service
+// floods queries for the positions senders don't know yet.
+type GPSR struct {
+	Config     GPSRConfig
+	Clock      sim.Timer
+	Events     RouteEvents
+	Neighbours *NeighbourTable
+	// Locations are the positions we learnt of drones beyond our neighbours
+	Locations map[string]Location
+	// the ID of the last location query we originated
+	QueryID int
+
+	// the drone we run on and its radio, set by Start
+	node       Node
+	radioQueue *sim.Queue
+
+	// location queries in progress, by target
+	queries map[string]*locationQuery
+	// the location queries we've seen, by originator and ID
+	seenQueries map[string]time.Time
+}
+
+// Location is where a drone was when we last heard of it
+type Location struct {
+	Position types.Position
+	Learned  time.Time
+}
+
+func NewGPSR(config GPSRConfig, clock sim.Timer) *GPSR {
+	config = config.WithDefaults()
+
+	return &GPSR{
+		Config:      config,
+		Clock:       clock,
+		Neighbours:  NewNeighbourTable(config.BeaconInterval, config.AllowedBeaconLoss, clock),
+		Locations:   make(map[string]Location),
+		queries:     make(map[string]*locationQuery),
+		seenQueries: make(map[string]time.Time),
+	}
+}
+
+var (
+	_ Protocol     = (*GPSR)(nil)
+	_ PacketRouter = (*GPSR)(nil)
+)
+
+func (g *GPSR) Name() string {
+	return "GPSR"
+}
+
+// Start schedules the beacons, each is jittered by up to half the interval
+// either way so neighbours don't stay in step (GPSR 2.4)
+func (g *GPSR) Start(node Node, sched *sim.Scheduler, radioQueue *sim.Queue) {
+	g.node = node
+	g.radioQueue = radioQueue
+
+	var beacon func()
+	beacon = func() {
+		g.sendBeacon()
+		jitter := time.Duration(sched.Rand.Int63n(int64(g.Config.BeaconInterval)))
+		sched.After(g.Config.BeaconInterval/2+jitter, beacon)
+	}
+
+	sched.After(time.Duration(sched.Rand.Int63n(int64(g.Config.BeaconInterval))), beacon)
+}
+
+// HandleMessage processes a beacon or a location query or reply
+func (g *GPSR) HandleMessage(msg types.DroneMessage) {
+	gMsg := msg.GPSRPayload
+	if gMsg == nil {
+		return
+	}
+
+	switch gMsg.Type {
+	case 1:
+		g.Neighbours.HeardHello(msg.Source, &gMsg.Position)
+	case 2:
+		g.handleQuery(*gMsg)
+	case 3:
+		g.handleReply(*gMsg)
+	}
+}
+
+// Tick drops the neighbours that stopped beaconing and the stale locations
+func (g *GPSR) Tick() {
+	g.Neighbours.Expire()
+
+	now := g.Clock.Now()
+	for id, location := range g.Locations {
+		if now.Sub(location.Learned) > g.Config.LocationTimeout {
+			delete(g.Locations, id)
+		}
+	}
+	for key, seen := range g.seenQueries {
+		if now.Sub(seen) > g.Config.LocationTimeout {
+			delete(g.seenQueries, key)
+		}
+	}
+}
+
+func (g *GPSR) TickInterval() time.Duration {
+	return g.Config.ExpiryCheckInterval
+}
+
+// PendingTimeout is as long as a location query and its retries take
+func (g *GPSR) PendingTimeout() time.Duration {
+	return time.Duration(g.Config.QueryRetries+1) * g.Config.QueryTimeout
+}
+
+func (g *GPSR) HeardFrom(neighbour string) {
+	g.Neighbours.HeardFrom(neighbour)
+}
+
+func (g *GPSR) LinkFailed(neighbour string) {
+	g.Neighbours.Remove(neighbour)
+}
+
+// NextHop greedily picks the neighbour closest to destination, messages
+// without a GPSR header of their own are forwarded by it
+func (g *GPSR) NextHop(destination string) (string, bool) {
+	if _, neighbour := g.Neighbours.Entries[destination]; neighbour {
+		return destination, true
+	}
+
+	position, known := g.position(destination)
+	if !known {
+		return "", false
+	}
+
+	return g.greedy(position)
+}
+
+// Repairing is always false, GPSR keeps no routes
+func (g *GPSR) Repairing(destination string) bool {
+	return false
+}
+
+// Unreachable only logs, there are no routes to correct
+func (g *GPSR) Unreachable(destination string, previousHop string) {
+	log.Printf("%s: no way towards %s, dropping packet from %s", g.node.ID(), destination, previousHop)
+}
+
+func (g *GPSR) SetRouteEvents(events RouteEvents) {
+	g.Events = events
+}
+
+// RoutePacket forwards packet towards its destination's position, a packet
+// we originate gets the position written into it
+func (g *GPSR) RoutePacket(packet *types.DataMessage) (string, bool) {
+	if packet.Geo == nil {
+		position, known := g.position(packet.RecipientID)
+		if !known {
+			return "", false
+		}
+
+		packet.Geo = &types.GeoHeader{Destination: position, TTL: g.Config.MaxHops}
+	}
+
+	return g.forward(packet.RecipientID, packet.Geo)
+}
+
+// SalvagePacket routes a packet again after the link to its next hop broke,
+// the neighbour is gone so it goes elsewhere. It restarts in greedy mode as
+// the perimeter it was on went through the lost link.
+func (g *GPSR) SalvagePacket(packet *types.DataMessage) (string, bool) {
+	if packet.Geo == nil {
+		return "", false
+	}
+
+	packet.Geo.Perimeter = false
+
+	return g.forward(packet.RecipientID, packet.Geo)
+}
+
+// position returns where destination is, as its beacons or the location
+// service last told us
+func (g *GPSR) position(destination string) (types.Position, bool) {
+	if n, exists := g.Neighbours.Entries[destination]; exists && n.Position != nil {
+		return *n.Position, true
+	}
+
+	location, known := g.Locations[destination]
+
+	return location.Position, known
+}
+
+func (g *GPSR) sendBeacon() {
+	g.send(types.GPSRMessage{Type: 1, Position: g.node.Position()}, "")
+}
+
+// send transmits msg, to nextHop or to every neighbour if nextHop is empty
+func (g *GPSR) send(msg types.GPSRMessage, nextHop string) {
+	dMsg := types.DroneMessage{
+		Source:      g.node.ID(),
+		NextHop:     nextHop,
+		Type:        "GPSR",
+		GPSRPayload: &msg,
+	}
+
+	data, _ := json.Marshal(dMsg)
+
+	g.radioQueue.Push(data)
+}
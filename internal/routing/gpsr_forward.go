@@ -0,0 +1,208 @@
+package routing
+
+import (
+	"math"
+
+	"github.com/azaurus1/swarm/internal/types"
+)
+
+// forward picks the next hop for a message to destination and updates its
+// header. Greedy forwarding is tried first, where it fails the message goes
+// round the faces of the planar graph until it gets closer to the
+// destination than where it started (GPSR 2.2 to 2.5).
+func (g *GPSR) forward(destination string, h *types.GeoHeader) (string, bool) {
+	if h.TTL <= 0 {
+		return "", false
+	}
+
+	self := g.node.Position()
+	var next string
+	var ok bool
+
+	if _, neighbour := g.Neighbours.Entries[destination]; neighbour {
+		next, ok = destination, true
+	} else {
+		if h.Perimeter && distance(self, h.Destination) < distance(h.EnteredAt, h.Destination) {
+			h.Perimeter = false
+		}
+
+		if !h.Perimeter {
+			next, ok = g.greedy(h.Destination)
+			if !ok {
+				next, ok = g.enterPerimeter(h)
+			}
+		} else {
+			next, ok = g.perimeter(h)
+		}
+	}
+
+	if !ok {
+		return "", false
+	}
+
+	h.TTL--
+	h.Previous = g.node.ID()
+	h.PreviousPosition = self
+
+	return next, true
+}
+
+// greedy returns the neighbour closest to target, if any is closer than us
+func (g *GPSR) greedy(target types.Position) (string, bool) {
+	best, bestDistance := "", distance(g.node.Position(), target)
+
+	for _, id := range g.Neighbours.IDs() {
+		n := g.Neighbours.Entries[id]
+		if n.Position == nil {
+			continue
+		}
+
+		if d := distance(*n.Position, target); d < bestDistance {
+			best, bestDistance = id, d
+		}
+	}
+
+	return best, best != ""
+}
+
+// enterPerimeter switches to perimeter mode at a local maximum, the message
+// takes the first edge counterclockwise from the line to its destination
+func (g *GPSR) enterPerimeter(h *types.GeoHeader) (string, bool) {
+	self := g.node.Position()
+
+	next, ok := g.rightHand(g.planarNeighbours(), angle(self, h.Destination), "")
+	if !ok {
+		return "", false
+	}
+
+	h.Perimeter = true
+	h.EnteredAt = self
+	h.FaceAt = self
+	h.FirstEdgeFrom, h.FirstEdgeTo = g.node.ID(), next
+
+	return next, true
+}
+
+// perimeter takes the next edge of the current face by the right hand rule,
+// moving to the next face where an edge crosses the line from where
+// perimeter mode started to the destination. Taking the face's first edge
+// again means the destination can't be reached.
+func (g *GPSR) perimeter(h *types.GeoHeader) (string, bool) {
+	self := g.node.Position()
+	planar := g.planarNeighbours()
+
+	from := h.PreviousPosition
+	if n, exists := planar[h.Previous]; exists {
+		from = n
+	}
+
+	next, ok := g.rightHand(planar, angle(self, from), h.Previous)
+	if !ok {
+		return "", false
+	}
+
+	changedFace := false
+	for range planar {
+		crossing, crosses := intersection(self, planar[next], h.EnteredAt, h.Destination)
+		if !crosses || distance(crossing, h.Destination) >= distance(h.FaceAt, h.Destination) {
+			break
+		}
+
+		h.FaceAt = crossing
+		next, _ = g.rightHand(planar, angle(self, planar[next]), next)
+		h.FirstEdgeFrom, h.FirstEdgeTo = g.node.ID(), next
+		changedFace = true
+	}
+
+	if !changedFace && h.FirstEdgeFrom == g.node.ID() && h.FirstEdgeTo == next {
+		return "", false
+	}
+
+	return next, true
+}
+
+// rightHand returns the planar neighbour that comes first sweeping
+// counterclockwise from the direction in, exclude is only taken if there is
+// nothing else
+func (g *GPSR) rightHand(planar map[string]types.Position, in float64, exclude string) (string, bool) {
+	best, bestSweep := "", 0.0
+
+	for _, id := range sortedKeys(planar) {
+		sweep := 2 * math.Pi
+		if id != exclude {
+			sweep = math.Mod(angle(g.node.Position(), planar[id])-in+4*math.Pi, 2*math.Pi)
+			if sweep == 0 {
+				sweep = 2 * math.Pi
+			}
+		}
+
+		if best == "" || sweep < bestSweep {
+			best, bestSweep = id, sweep
+		}
+	}
+
+	return best, best != ""
+}
+
+// planarNeighbours returns the positions of the neighbours that stay in the
+// Gabriel graph, the link to one is dropped if another neighbour lies in the
+// circle with the link as its diameter (GPSR 2.3)
+func (g *GPSR) planarNeighbours() map[string]types.Position {
+	self := g.node.Position()
+
+	positions := make(map[string]types.Position)
+	for id, n := range g.Neighbours.Entries {
+		if n.Position != nil {
+			positions[id] = *n.Position
+		}
+	}
+
+	planar := make(map[string]types.Position)
+	for v, pv := range positions {
+		kept := true
+		for w, pw := range positions {
+			if w != v && squaredDistance(self, pw)+squaredDistance(pv, pw) < squaredDistance(self, pv) {
+				kept = false
+				break
+			}
+		}
+
+		if kept {
+			planar[v] = pv
+		}
+	}
+
+	return planar
+}
+
+func distance(a types.Position, b types.Position) float64 {
+	return math.Sqrt(squaredDistance(a, b))
+}
+
+func squaredDistance(a types.Position, b types.Position) float64 {
+	return (a.X-b.X)*(a.X-b.X) + (a.Y-b.Y)*(a.Y-b.Y)
+}
+
+func angle(from types.Position, to types.Position) float64 {
+	return math.Atan2(to.Y-from.Y, to.X-from.X)
+}
+
+// intersection returns where the segments a1-a2 and b1-b2 cross, touching at
+// a1 doesn't count
+func intersection(a1, a2, b1, b2 types.Position) (types.Position, bool) {
+	dax, day := a2.X-a1.X, a2.Y-a1.Y
+	dbx, dby := b2.X-b1.X, b2.Y-b1.Y
+
+	denominator := dax*dby - day*dbx
+	if denominator == 0 {
+		return types.Position{}, false
+	}
+
+	t := ((b1.X-a1.X)*dby - (b1.Y-a1.Y)*dbx) / denominator
+	u := ((b1.X-a1.X)*day - (b1.Y-a1.Y)*dax) / denominator
+	if t <= 0 || t > 1 || u < 0 || u > 1 {
+		return types.Position{}, false
+	}
+
+	return types.Position{X: a1.X + t*dax, Y: a1.Y + t*day}, true
+}
@@ -0,0 +1,125 @@
+package routing
+
+import (
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/azaurus1/swarm/internal/sim"
+	"github.com/azaurus1/swarm/internal/types"
+)
+
+func TestIntersection(t *testing.T) {
+	tests := []struct {
+		name           string
+		a1, a2, b1, b2 types.Position
+		at             types.Position
+		crosses        bool
+	}{
+		{"crossing", types.Position{X: 0, Y: 0}, types.Position{X: 2, Y: 2}, types.Position{X: 0, Y: 2}, types.Position{X: 2, Y: 0}, types.Position{X: 1, Y: 1}, true},
+		{"parallel", types.Position{X: 0, Y: 0}, types.Position{X: 2, Y: 0}, types.Position{X: 0, Y: 1}, types.Position{X: 2, Y: 1}, types.Position{}, false},
+		{"touching at a1", types.Position{X: 0, Y: 0}, types.Position{X: 2, Y: 2}, types.Position{X: -1, Y: 1}, types.Position{X: 1, Y: -1}, types.Position{}, false},
+		{"touching at a2", types.Position{X: 0, Y: 0}, types.Position{X: 2, Y: 2}, types.Position{X: 1, Y: 3}, types.Position{X: 3, Y: 1}, types.Position{X: 2, Y: 2}, true},
+		{"beyond a2", types.Position{X: 0, Y: 0}, types.Position{X: 1, Y: 1}, types.Position{X: 3, Y: 0}, types.Position{X: 0, Y: 3}, types.Position{}, false},
+		{"beyond b2", types.Position{X: 0, Y: 0}, types.Position{X: 4, Y: 4}, types.Position{X: 0, Y: 4}, types.Position{X: 1, Y: 3}, types.Position{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at, crosses := intersection(tt.a1, tt.a2, tt.b1, tt.b2)
+			if crosses != tt.crosses || at != tt.at {
+				t.Errorf("intersection = %v, %v, want %v, %v", at, crosses, tt.at, tt.crosses)
+			}
+		})
+	}
+}
+
+// newTestGPSR is a GPSR at the origin with neighbours at the given positions
+func newTestGPSR(neighbours map[string]types.Position) *GPSR {
+	g := NewGPSR(GPSRConfig{}, sim.NewScheduler(1))
+	g.node = testNode{id: "self"}
+	for id, position := range neighbours {
+		position := position
+		g.Neighbours.Entries[id] = &Neighbour{ID: id, Position: &position}
+	}
+	return g
+}
+
+func TestPlanarNeighbours(t *testing.T) {
+	tests := []struct {
+		name       string
+		neighbours map[string]types.Position
+		planar     []string
+	}{
+		{
+			name:       "nothing in between",
+			neighbours: map[string]types.Position{"e": {X: 2, Y: 0}, "n": {X: 0, Y: 2}},
+			planar:     []string{"e", "n"},
+		},
+		{
+			name:       "witness drops the longer link",
+			neighbours: map[string]types.Position{"e": {X: 2, Y: 0}, "w": {X: 1, Y: 0.1}, "n": {X: 0, Y: 2}},
+			planar:     []string{"n", "w"},
+		},
+		{
+			name:       "outside the circle",
+			neighbours: map[string]types.Position{"e": {X: 2, Y: 0}, "w": {X: 1, Y: 1.5}},
+			planar:     []string{"e", "w"},
+		},
+		{
+			name:       "position unknown",
+			neighbours: map[string]types.Position{"e": {X: 2, Y: 0}},
+			planar:     []string{"e"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newTestGPSR(tt.neighbours)
+			g.Neighbours.Entries["silent"] = &Neighbour{ID: "silent"}
+
+			planar := g.planarNeighbours()
+
+			if got := sortedKeys(planar); !slices.Equal(got, tt.planar) {
+				t.Errorf("planar neighbours %v, want %v", got, tt.planar)
+			}
+		})
+	}
+}
+
+func TestRightHand(t *testing.T) {
+	compass := map[string]types.Position{
+		"e": {X: 1, Y: 0},
+		"n": {X: 0, Y: 1},
+		"w": {X: -1, Y: 0},
+	}
+
+	tests := []struct {
+		name    string
+		planar  map[string]types.Position
+		in      float64
+		exclude string
+		next    string
+	}{
+		{"from the east", compass, 0, "", "n"},
+		{"from the north", compass, math.Pi / 2, "", "w"},
+		{"from the west", compass, math.Pi, "", "e"},
+		{"excluded skipped", compass, 0, "n", "w"},
+		{"excluded as a last resort", map[string]types.Position{"n": {X: 0, Y: 1}}, 0, "n", "n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newTestGPSR(nil)
+
+			next, ok := g.rightHand(tt.planar, tt.in, tt.exclude)
+			if !ok || next != tt.next {
+				t.Errorf("rightHand = %q, %v, want %q", next, ok, tt.next)
+			}
+		})
+	}
+
+	if next, ok := newTestGPSR(nil).rightHand(nil, 0, ""); ok {
+		t.Errorf("rightHand with no neighbours = %q, want none", next)
+	}
+}
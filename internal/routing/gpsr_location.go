@@ -0,0 +1,139 @@
+package routing
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/azaurus1/swarm/internal/sim"
+	"github.com/azaurus1/swarm/internal/types"
+)
+
+// a location query in progress
+type locationQuery struct {
+	retries int
+	timer   *sim.Event
+}
+
+// RequestRoute looks up where destination is, a query is flooded unless we
+// already know or one is running. OnRoute is raised once the position is in.
+func (g *GPSR) RequestRoute(destination string) {
+	if _, known := g.position(destination); known {
+		g.Events.Route(destination)
+		return
+	}
+	if _, exists := g.queries[destination]; exists {
+		return
+	}
+
+	q := &locationQuery{}
+	g.queries[destination] = q
+	g.query(destination, q)
+}
+
+// query floods a location query for target and retries it until a reply
+// comes or QueryRetries run out
+func (g *GPSR) query(target string, q *locationQuery) {
+	self := g.node.ID()
+	g.QueryID = seqNext(g.QueryID)
+	g.seenQueries[fmt.Sprintf("%s-%d", self, g.QueryID)] = g.Clock.Now()
+
+	log.Printf("%s: sending location query %d for %s", self, g.QueryID, target)
+
+	g.send(types.GPSRMessage{
+		Type:         2,
+		Position:     g.node.Position(),
+		QueryID:      g.QueryID,
+		OriginatorId: self,
+		Target:       target,
+		TTL:          g.Config.QueryTTL,
+	}, "")
+
+	q.timer = g.Clock.After(g.Config.QueryTimeout, func() {
+		if q.retries >= g.Config.QueryRetries {
+			log.Printf("%s: no location for %s after %d queries", self, target, q.retries+1)
+			delete(g.queries, target)
+			g.Events.NoRoute(target)
+			return
+		}
+
+		q.retries++
+		g.query(target, q)
+	})
+}
+
+// handleQuery notes where the querier is, the target replies to it and
+// everyone else passes the query on
+func (g *GPSR) handleQuery(msg types.GPSRMessage) {
+	self := g.node.ID()
+	if msg.OriginatorId == self {
+		return
+	}
+
+	key := fmt.Sprintf("%s-%d", msg.OriginatorId, msg.QueryID)
+	if _, seen := g.seenQueries[key]; seen {
+		return
+	}
+	g.seenQueries[key] = g.Clock.Now()
+	g.learnLocation(msg.OriginatorId, msg.Position)
+
+	if msg.Target == self {
+		log.Printf("%s: answering location query %d from %s", self, msg.QueryID, msg.OriginatorId)
+
+		g.forwardReply(types.GPSRMessage{
+			Type:         3,
+			Position:     g.node.Position(),
+			OriginatorId: self,
+			Target:       msg.OriginatorId,
+			Geo:          &types.GeoHeader{Destination: msg.Position, TTL: g.Config.MaxHops},
+		})
+		return
+	}
+
+	if msg.TTL <= 1 {
+		return
+	}
+
+	msg.TTL--
+	g.send(msg, "")
+}
+
+// handleReply notes where the replying target is, the querier is done and
+// everyone else routes the reply on towards it
+func (g *GPSR) handleReply(msg types.GPSRMessage) {
+	g.learnLocation(msg.OriginatorId, msg.Position)
+
+	if msg.Target != g.node.ID() {
+		g.forwardReply(msg)
+		return
+	}
+
+	log.Printf("%s: %s is at (%.1f, %.1f)", msg.Target, msg.OriginatorId, msg.Position.X, msg.Position.Y)
+
+	if q, exists := g.queries[msg.OriginatorId]; exists {
+		q.timer.Cancel()
+		delete(g.queries, msg.OriginatorId)
+	}
+	g.Events.Route(msg.OriginatorId)
+}
+
+func (g *GPSR) forwardReply(msg types.GPSRMessage) {
+	if msg.Geo == nil {
+		return
+	}
+
+	next, ok := g.forward(msg.Target, msg.Geo)
+	if !ok {
+		log.Printf("%s: no way towards %s, dropping location reply", g.node.ID(), msg.Target)
+		return
+	}
+
+	g.send(msg, next)
+}
+
+func (g *GPSR) learnLocation(id string, position types.Position) {
+	if id == g.node.ID() {
+		return
+	}
+
+	g.Locations[id] = Location{Position: position, Learned: g.Clock.Now()}
+}
@@ -0,0 +1,239 @@
+package routing
+
+import (
+	"log"
+	"slices"
+	"time"
+
+	"github.com/azaurus1/swarm/internal/types"
+)
+
+// AOMDV multipath routing (Marina and Das, 2001). A route keeps up to MaxPaths
+// link-disjoint paths to its destination, all with the same sequence number.
+// Duplicate RREQs and RREPs that come along other links add paths instead of
+// being dropped, and a path is only taken if its hop count is below the one
+// we advertised for the destination, which keeps them loop free. When the
+// link under one path breaks the others take over without a new discovery.
+
+// A Path is one of the ways to a route's destination with multipath routing
+type Path struct {
+	NextHop string
+	// LastHop is the drone the path reaches the destination from, paths with
+	// different next and last hops share no link
+	LastHop    string
+	HopCount   int
+	Expiration time.Time
+}
+
+// firstPath is the path a new route is installed with, none without
+// multipath routing
+func (a *AODVListener) firstPath(nextHop string, lastHop string, hopCount int, expiration time.Time) []Path {
+	if !a.Config.Multipath {
+		return nil
+	}
+
+	return []Path{{NextHop: nextHop, LastHop: lastHop, HopCount: hopCount, Expiration: expiration}}
+}
+
+// joinPath adds another path to the valid route entry, advertised with the
+// same sequence number, if it is loop free and disjoint from the others. A
+// path through a next hop we already use only has its lifetime extended.
+func (a *AODVListener) joinPath(droneId string, entry RoutingTableEntry, path Path) bool {
+	for i, p := range entry.Paths {
+		if p.NextHop == path.NextHop {
+			entry.Paths[i].HopCount = min(p.HopCount, path.HopCount)
+			entry.Paths[i].Expiration = path.Expiration
+			a.choosePath(&entry)
+			a.RoutingTable.Entries[entry.ID] = entry
+			return false
+		}
+	}
+
+	if len(entry.Paths) >= a.Config.MaxPaths || !a.loopFree(droneId, entry, path) {
+		return false
+	}
+	for _, p := range entry.Paths {
+		if p.LastHop == path.LastHop {
+			return false
+		}
+	}
+
+	entry.Paths = append(entry.Paths, path)
+	a.choosePath(&entry)
+	a.RoutingTable.Entries[entry.ID] = entry
+
+	log.Printf("%s: adding path to %s via %s (seq %d, %d hops, %d paths)", droneId, entry.ID, path.NextHop, entry.SequenceNumber, path.HopCount, len(entry.Paths))
+
+	return true
+}
+
+// loopFree is the AOMDV route update rule, the neighbour must be advertising
+// the destination as closer than we do, ties broken by ID. Until we have
+// advertised the route any path goes.
+func (a *AODVListener) loopFree(droneId string, entry RoutingTableEntry, path Path) bool {
+	if entry.AdvertisedHopCount == 0 {
+		return true
+	}
+
+	theirs := path.HopCount - 1
+
+	return entry.AdvertisedHopCount > theirs || (entry.AdvertisedHopCount == theirs && droneId > path.NextHop)
+}
+
+// advertise is the hop count we tell others the destination is away, our
+// own hopCount without multipath routing. With it the longest path's hop
+// count is fixed the first time the route is advertised, paths we add later
+// have to be shorter.
+func (a *AODVListener) advertise(destination string, hopCount int) int {
+	entry, exists := a.RoutingTable.Entries[destination]
+	if !a.Config.Multipath || !exists || len(entry.Paths) == 0 {
+		return hopCount
+	}
+
+	if entry.AdvertisedHopCount == 0 {
+		for _, p := range entry.Paths {
+			entry.AdvertisedHopCount = max(entry.AdvertisedHopCount, p.HopCount)
+		}
+		a.RoutingTable.Entries[destination] = entry
+	}
+
+	return entry.AdvertisedHopCount
+}
+
+// choosePath makes the shortest path the one the entry's next hop and hop
+// count describe, the route lasts as long as its last path
+func (a *AODVListener) choosePath(entry *RoutingTableEntry) {
+	if len(entry.Paths) == 0 {
+		return
+	}
+
+	best := entry.Paths[0]
+	entry.Expiration = best.Expiration
+	for _, p := range entry.Paths[1:] {
+		if p.HopCount < best.HopCount {
+			best = p
+		}
+		if p.Expiration.After(entry.Expiration) {
+			entry.Expiration = p.Expiration
+		}
+	}
+
+	entry.NextHop = best.NextHop
+	entry.HopCount = best.HopCount
+}
+
+// failover drops the entry's paths through neighbour, it is true if others
+// are left to carry the route
+func (a *AODVListener) failover(droneId string, entry *RoutingTableEntry, neighbour string) bool {
+	if len(entry.Paths) == 0 {
+		return false
+	}
+
+	entry.Paths = slices.DeleteFunc(entry.Paths, func(p Path) bool {
+		return p.NextHop == neighbour
+	})
+	if len(entry.Paths) == 0 {
+		return false
+	}
+
+	previous := entry.NextHop
+	a.choosePath(entry)
+	a.RoutingTable.Entries[entry.ID] = *entry
+
+	if previous == neighbour {
+		log.Printf("%s: path to %s via %s broken, switching to %s (%d paths left)", droneId, entry.ID, neighbour, entry.NextHop, len(entry.Paths))
+	}
+
+	return true
+}
+
+// expirePaths drops the paths past their lifetime, a route whose paths
+// have all expired expires with them
+func (a *AODVListener) expirePaths() {
+	now := a.Clock.Now()
+
+	for _, id := range sortedKeys(a.RoutingTable.Entries) {
+		entry := a.RoutingTable.Entries[id]
+		if !entry.Valid || len(entry.Paths) <= 1 {
+			continue
+		}
+
+		entry.Paths = slices.DeleteFunc(entry.Paths, func(p Path) bool {
+			return p.Expiration.Before(now)
+		})
+		if len(entry.Paths) > 0 {
+			a.choosePath(&entry)
+		}
+		a.RoutingTable.Entries[id] = entry
+	}
+}
+
+// balance spreads the packets for entry's destination over its paths in
+// turn, with load balancing
+func (a *AODVListener) balance(entry RoutingTableEntry) string {
+	now := a.Clock.Now()
+
+	for range entry.Paths {
+		entry.turn = (entry.turn + 1) % len(entry.Paths)
+		if p := entry.Paths[entry.turn]; !p.Expiration.Before(now) {
+			a.RoutingTable.Entries[entry.ID] = entry
+			return p.NextHop
+		}
+	}
+
+	return entry.NextHop
+}
+
+// lastHop is the drone the path an RREQ or RREP came along reaches its
+// advertised drone from, us if it came straight from it
+func lastHop(droneId string, aMsg types.AODVMessage) string {
+	if aMsg.FirstHop == "" {
+		return droneId
+	}
+
+	return aMsg.FirstHop
+}
+
+// firstHop is what we tell the drones we pass the RREQ or RREP on to as its
+// first hop, nothing without multipath routing
+func (a *AODVListener) firstHop(droneId string, aMsg types.AODVMessage) string {
+	if !a.Config.Multipath {
+		return ""
+	}
+
+	return lastHop(droneId, aMsg)
+}
+
+// pathLastHop is the last hop of entry's current path, nothing without
+// multipath routing
+func pathLastHop(entry RoutingTableEntry) string {
+	for _, p := range entry.Paths {
+		if p.NextHop == entry.NextHop {
+			return p.LastHop
+		}
+	}
+
+	return ""
+}
+
+// reverseHop is the next hop towards originator for a copy of the RREP
+// under key. With multipath routing every copy takes a reverse path the
+// earlier ones didn't, it is empty once they are all taken.
+func (a *AODVListener) reverseHop(key string, originator string) string {
+	entry, exists := a.RoutingTable.Entries[originator]
+	if !exists || !entry.Valid {
+		return ""
+	}
+	if !a.Config.Multipath {
+		return entry.NextHop
+	}
+
+	for _, p := range entry.Paths {
+		if !slices.Contains(a.rrepHops[key], p.NextHop) {
+			a.rrepHops[key] = append(a.rrepHops[key], p.NextHop)
+			return p.NextHop
+		}
+	}
+
+	return ""
+}
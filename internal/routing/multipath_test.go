@@ -0,0 +1,108 @@
+package routing
+
+import (
+	"testing"
+
+	"github.com/azaurus1/swarm/internal/sim"
+)
+
+func TestLoopFree(t *testing.T) {
+	tests := []struct {
+		name       string
+		droneId    string
+		advertised int
+		path       Path
+		loopFree   bool
+	}{
+		{"not advertised yet", "a", 0, Path{NextHop: "b", HopCount: 9}, true},
+		{"neighbour closer", "a", 3, Path{NextHop: "b", HopCount: 3}, true},
+		{"neighbour further", "a", 3, Path{NextHop: "b", HopCount: 5}, false},
+		{"tie won by the higher ID", "c", 3, Path{NextHop: "b", HopCount: 4}, true},
+		{"tie lost to the higher ID", "a", 3, Path{NextHop: "b", HopCount: 4}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewAODVListener(AODVConfig{Multipath: true}, sim.NewScheduler(1))
+			entry := RoutingTableEntry{ID: "d", AdvertisedHopCount: tt.advertised}
+
+			if got := a.loopFree(tt.droneId, entry, tt.path); got != tt.loopFree {
+				t.Errorf("loopFree = %v, want %v", got, tt.loopFree)
+			}
+		})
+	}
+}
+
+func TestJoinPath(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxPaths int
+		path     Path
+		joined   bool
+		paths    []Path
+	}{
+		{
+			name:   "disjoint",
+			path:   Path{NextHop: "c", LastHop: "y", HopCount: 2},
+			joined: true,
+			paths:  []Path{{NextHop: "b", LastHop: "x", HopCount: 3}, {NextHop: "c", LastHop: "y", HopCount: 2}},
+		},
+		{
+			name:   "same last hop",
+			path:   Path{NextHop: "c", LastHop: "x", HopCount: 2},
+			joined: false,
+			paths:  []Path{{NextHop: "b", LastHop: "x", HopCount: 3}},
+		},
+		{
+			name:   "same next hop",
+			path:   Path{NextHop: "b", LastHop: "y", HopCount: 2},
+			joined: false,
+			paths:  []Path{{NextHop: "b", LastHop: "x", HopCount: 2}},
+		},
+		{
+			name:     "no room",
+			maxPaths: 1,
+			path:     Path{NextHop: "c", LastHop: "y", HopCount: 2},
+			joined:   false,
+			paths:    []Path{{NextHop: "b", LastHop: "x", HopCount: 3}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewAODVListener(AODVConfig{Multipath: true, MaxPaths: tt.maxPaths}, sim.NewScheduler(1))
+			entry := RoutingTableEntry{
+				ID:       "d",
+				NextHop:  "b",
+				HopCount: 3,
+				Valid:    true,
+				Paths:    []Path{{NextHop: "b", LastHop: "x", HopCount: 3}},
+			}
+			a.RoutingTable.Entries["d"] = entry
+
+			if joined := a.joinPath("a", entry, tt.path); joined != tt.joined {
+				t.Errorf("joinPath = %v, want %v", joined, tt.joined)
+			}
+
+			got := a.RoutingTable.Entries["d"]
+			if len(got.Paths) != len(tt.paths) {
+				t.Fatalf("paths %v, want %v", got.Paths, tt.paths)
+			}
+			for i, p := range got.Paths {
+				if p.NextHop != tt.paths[i].NextHop || p.LastHop != tt.paths[i].LastHop || p.HopCount != tt.paths[i].HopCount {
+					t.Errorf("path %d is %+v, want %+v", i, p, tt.paths[i])
+				}
+			}
+
+			shortest := tt.paths[0]
+			for _, p := range tt.paths[1:] {
+				if p.HopCount < shortest.HopCount {
+					shortest = p
+				}
+			}
+			if got.NextHop != shortest.NextHop || got.HopCount != shortest.HopCount {
+				t.Errorf("route via %s (%d hops), want via %s (%d hops)", got.NextHop, got.HopCount, shortest.NextHop, shortest.HopCount)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package routing
+
+import (
+	"time"
+
+	"github.com/azaurus1/swarm/internal/sim"
+	"github.com/azaurus1/swarm/internal/types"
+)
+
+// the link quality counts the HELLOs of this many HELLO intervals, a lost
+// neighbour's are kept as long so its link quality picks up where it left off
+// if it comes back
+const linkQualityWindow = 10
+
+// the ETX of a link that barely works either way
+const maxLinkETX = 100.0
+
+// A Neighbour is a drone we can hear directly
+type Neighbour struct {
+	ID        string
+	LastHeard time.Time
+	// LastHello is when its last HELLO arrived, zero until one has
+	LastHello time.Time
+	// LinkQuality is the share of its HELLOs of the last linkQualityWindow
+	// intervals that reached us, 0 to 1
+	LinkQuality float64
+	// ReverseQuality is the share of our HELLOs that reach it, as its own
+	// HELLOs report it
+	ReverseQuality float64
+	// Position is where it was when it sent its last HELLO, nil until then
+	Position *types.Position
+	// Velocity is how it was moving then, nil unless its HELLOs tell
+	Velocity *types.Velocity
+
+	// when its first HELLO and those in the window arrived
+	firstHello time.Time
+	hellos     []time.Time
+}
+
+// NeighbourTable tracks the drones in radio range. Any frame keeps a
+// neighbour alive, HELLOs also carry its position and feed the link quality.
+// A neighbour that stays quiet for AllowedHelloLoss HELLO intervals is gone
+// (RFC3561 6.9) and OnLinkBreak is raised for it.
+type NeighbourTable struct {
+	Entries          map[string]*Neighbour
+	HelloInterval    time.Duration
+	AllowedHelloLoss int
+	Clock            sim.Clock
+	// OnLinkBreak is called for every neighbour that is lost
+	OnLinkBreak func(neighbour string)
+
+	// the HELLO records of lost neighbours, by ID
+	lost map[string]Neighbour
+}
+
+func NewNeighbourTable(helloInterval time.Duration, allowedHelloLoss int, clock sim.Clock) *NeighbourTable {
+	return &NeighbourTable{
+		Entries:          make(map[string]*Neighbour),
+		HelloInterval:    helloInterval,
+		AllowedHelloLoss: allowedHelloLoss,
+		Clock:            clock,
+		lost:             make(map[string]Neighbour),
+	}
+}
+
+// HeardFrom records that a frame was received from neighbour, any frame
+// counts as proof the link still works
+func (n *NeighbourTable) HeardFrom(neighbour string) *Neighbour {
+	entry, exists := n.Entries[neighbour]
+	if !exists {
+		entry = &Neighbour{ID: neighbour}
+		if old, known := n.lost[neighbour]; known {
+			entry.LastHello = old.LastHello
+			entry.LinkQuality = old.LinkQuality
+			entry.ReverseQuality = old.ReverseQuality
+			entry.firstHello = old.firstHello
+			entry.hellos = old.hellos
+			delete(n.lost, neighbour)
+		}
+		n.Entries[neighbour] = entry
+	}
+	entry.LastHeard = n.Clock.Now()
+
+	return entry
+}
+
+// HeardHello records a HELLO, it counts towards the link quality
+func (n *NeighbourTable) HeardHello(neighbour string, position *types.Position) {
+	entry := n.HeardFrom(neighbour)
+	now := n.Clock.Now()
+
+	if entry.firstHello.IsZero() {
+		entry.firstHello = now
+	}
+	entry.hellos = append(entry.hellos, now)
+	entry.LastHello = now
+	n.updateQuality(entry)
+
+	if position != nil {
+		entry.Position = position
+	}
+}
+
+// updateQuality works out the share of the HELLOs expected in the window
+// that arrived, a neighbour first heard less than a window ago is expected to
+// have sent one each interval since (De Couto et al., 2003)
+func (n *NeighbourTable) updateQuality(entry *Neighbour) {
+	now := n.Clock.Now()
+
+	kept := entry.hellos[:0]
+	for _, heard := range entry.hellos {
+		if now.Sub(heard) < linkQualityWindow*n.HelloInterval {
+			kept = append(kept, heard)
+		}
+	}
+	entry.hellos = kept
+
+	expected := min(linkQualityWindow, int(now.Sub(entry.firstHello)/n.HelloInterval)+1)
+	entry.LinkQuality = min(1, float64(len(kept))/float64(expected))
+}
+
+// Expire drops the neighbours that haven't been heard for AllowedHelloLoss
+// HELLO intervals and brings the link qualities of the others up to date
+func (n *NeighbourTable) Expire() {
+	timeout := time.Duration(n.AllowedHelloLoss) * n.HelloInterval
+
+	for _, id := range sortedKeys(n.Entries) {
+		if n.Clock.Now().Sub(n.Entries[id].LastHeard) > timeout {
+			n.Remove(id)
+		} else if !n.Entries[id].LastHello.IsZero() {
+			n.updateQuality(n.Entries[id])
+		}
+	}
+
+	for id, old := range n.lost {
+		if n.Clock.Now().Sub(old.LastHello) > linkQualityWindow*n.HelloInterval {
+			delete(n.lost, id)
+		}
+	}
+}
+
+// Remove drops neighbour, for example when the link layer couldn't reach it
+func (n *NeighbourTable) Remove(neighbour string) {
+	if entry, exists := n.Entries[neighbour]; exists && !entry.LastHello.IsZero() {
+		n.lost[neighbour] = *entry
+	}
+	delete(n.Entries, neighbour)
+
+	if n.OnLinkBreak != nil {
+		n.OnLinkBreak(neighbour)
+	}
+}
+
+// ETX is the expected number of transmissions to get a frame to neighbour
+// and its acknowledgement back, 1/(df*dr) from the share of HELLOs each side
+// receives (De Couto et al., 2003). A neighbour we've had no HELLO from yet
+// counts as a perfect link, as it would by hop count.
+func (n *NeighbourTable) ETX(neighbour string) float64 {
+	entry, exists := n.Entries[neighbour]
+	if !exists {
+		return maxLinkETX
+	}
+	if entry.LastHello.IsZero() {
+		return 1
+	}
+
+	delivery := entry.LinkQuality * entry.ReverseQuality
+	if delivery < 1/maxLinkETX {
+		return maxLinkETX
+	}
+
+	return 1 / delivery
+}
+
+// IDs lists the current neighbours in a fixed order
+func (n *NeighbourTable) IDs() []string {
+	return sortedKeys(n.Entries)
+}
@@ -0,0 +1,16 @@
+package routing
+
+import "github.com/azaurus1/swarm/internal/types"
+
+// testNode is a drone that stays where it is put
+type testNode struct {
+	id       string
+	position types.Position
+	velocity types.Velocity
+	r        float64
+}
+
+func (n testNode) ID() string               { return n.id }
+func (n testNode) Position() types.Position { return n.position }
+func (n testNode) Velocity() types.Velocity { return n.velocity }
+func (n testNode) Range() float64           { return n.r }
@@ -0,0 +1,439 @@
+package routing
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/azaurus1/swarm/internal/sim"
+	"github.com/azaurus1/swarm/internal/types"
+)
+
+// link and neighbour types advertised in a HELLO (RFC3626 6.1.1 and 18.5)
+const (
+	linkAsym = 1
+	linkSym  = 2
+	linkLost = 3
+
+	neighNot = 0
+	neighSym = 1
+	neighMPR = 2
+)
+
+// OLSR is the Optimized Link State Routing protocol of RFC3626 on a single
+// interface. Neighbours are sensed with HELLOs, every drone picks MPRs that
+// cover its two hop neighbourhood and only the MPRs relay the TCs the
+// routes are calculated from.
+type OLSR struct {
+	Config OLSRConfig
+	Clock  sim.Timer
+	Events RouteEvents
+
+	// Links are the drones we hear HELLOs from, by neighbour (RFC3626 4.2.1)
+	Links map[string]*LinkTuple
+	// Neighbours are the ones with a symmetric link and the willingness
+	// they advertised (RFC3626 4.3.1)
+	Neighbours map[string]int
+	// TwoHop holds, for each neighbour, its symmetric neighbours and until
+	// when we may believe it (RFC3626 4.3.2)
+	TwoHop map[string]map[string]time.Time
+	// MPRs are the neighbours we picked to relay our broadcasts
+	MPRs map[string]bool
+	// MPRSelectors are the neighbours that picked us as their MPR
+	MPRSelectors map[string]time.Time
+	// Topology is what the TCs told us, by originator (RFC3626 4.4)
+	Topology map[string]*TopologyEntry
+	Routes   map[string]OLSRRoute
+
+	// our message sequence number and advertised neighbour sequence number
+	SequenceNumber int
+	ANSN           int
+
+	// the drone we run on and its radio, set by Start
+	node       Node
+	radioQueue *sim.Queue
+
+	duplicates map[string]*duplicate
+	// the MPR selectors our last TC advertised, and when we last had any
+	advertised    []string
+	lastSelectors time.Time
+}
+
+// LinkTuple is the state of the link to a neighbour, it is symmetric until
+// SymTime, heard until AsymTime and kept, lost, until Time
+type LinkTuple struct {
+	ID       string
+	SymTime  time.Time
+	AsymTime time.Time
+	Time     time.Time
+}
+
+func (l *LinkTuple) symmetric(now time.Time) bool {
+	return !l.SymTime.Before(now)
+}
+
+func (l *LinkTuple) asymmetric(now time.Time) bool {
+	return !l.symmetric(now) && !l.AsymTime.Before(now)
+}
+
+// TopologyEntry holds the neighbours an originator's last TC advertised and
+// until when each of them is valid
+type TopologyEntry struct {
+	ANSN         int
+	Destinations map[string]time.Time
+}
+
+type OLSRRoute struct {
+	Destination string
+	NextHop     string
+	Hops        int
+}
+
+// a message we've seen, so it is processed and relayed at most once
+// (RFC3626 3.4)
+type duplicate struct {
+	expires       time.Time
+	retransmitted bool
+}
+
+func NewOLSR(config OLSRConfig, clock sim.Timer) *OLSR {
+	return &OLSR{
+		Config:       config.WithDefaults(),
+		Clock:        clock,
+		Links:        make(map[string]*LinkTuple),
+		Neighbours:   make(map[string]int),
+		TwoHop:       make(map[string]map[string]time.Time),
+		MPRs:         make(map[string]bool),
+		MPRSelectors: make(map[string]time.Time),
+		Topology:     make(map[string]*TopologyEntry),
+		Routes:       make(map[string]OLSRRoute),
+		duplicates:   make(map[string]*duplicate),
+	}
+}
+
+var _ Protocol = (*OLSR)(nil)
+
+func (o *OLSR) Name() string {
+	return "OLSR"
+}
+
+// Start schedules the HELLOs and TCs, each offset by a random fraction of its
+// interval so the drones don't all transmit in the same instant
+func (o *OLSR) Start(node Node, sched *sim.Scheduler, radioQueue *sim.Queue) {
+	o.node = node
+	o.radioQueue = radioQueue
+
+	helloOffset := time.Duration(sched.Rand.Int63n(int64(o.Config.HelloInterval)))
+	sched.Every(helloOffset, o.Config.HelloInterval, o.sendHello)
+
+	tcOffset := time.Duration(sched.Rand.Int63n(int64(o.Config.TCInterval)))
+	sched.Every(tcOffset, o.Config.TCInterval, o.sendTC)
+}
+
+// HandleMessage processes an OLSR message, everything but a HELLO goes
+// through the default forwarding algorithm (RFC3626 3.4)
+func (o *OLSR) HandleMessage(msg types.DroneMessage) {
+	oMsg := msg.OLSRPayload
+	if oMsg == nil || oMsg.OriginatorId == o.node.ID() {
+		return
+	}
+
+	if oMsg.Type == 1 {
+		o.handleHello(*oMsg)
+		return
+	}
+
+	// a message from a drone we have no symmetric link with is dropped
+	// before it is recorded, so it can still be processed once the link is
+	// (RFC3626 3.4, step 1)
+	sender := msg.Source
+	if _, symmetric := o.Neighbours[sender]; !symmetric {
+		return
+	}
+
+	key := fmt.Sprintf("%s-%d", oMsg.OriginatorId, oMsg.SequenceNumber)
+	dup, seen := o.duplicates[key]
+	if !seen {
+		dup = &duplicate{}
+		o.duplicates[key] = dup
+
+		if oMsg.Type == 2 {
+			o.handleTC(*oMsg)
+		}
+	}
+	dup.expires = o.Clock.Now().Add(o.Config.DupHoldTime)
+
+	// only our MPR selectors get their broadcasts relayed by us
+	if dup.retransmitted || oMsg.TTL <= 1 {
+		return
+	}
+	if _, selector := o.MPRSelectors[sender]; !selector {
+		return
+	}
+
+	dup.retransmitted = true
+	oMsg.TTL--
+	oMsg.HopCount++
+	o.broadcast(*oMsg)
+}
+
+func (o *OLSR) Tick() {
+	o.expire()
+	o.update()
+}
+
+func (o *OLSR) TickInterval() time.Duration {
+	return o.Config.ExpiryCheckInterval
+}
+
+// PendingTimeout is TopHoldTime, the TCs that would bring a route arrive
+// within it
+func (o *OLSR) PendingTimeout() time.Duration {
+	return o.Config.TopHoldTime
+}
+
+// HeardFrom does nothing, OLSR only senses links through HELLOs
+func (o *OLSR) HeardFrom(neighbour string) {}
+
+// LinkFailed takes the link layer's word that the link is gone (RFC3626 13),
+// the link is kept as lost so our HELLOs tell the neighbour
+func (o *OLSR) LinkFailed(neighbour string) {
+	link, exists := o.Links[neighbour]
+	if !exists {
+		return
+	}
+
+	link.SymTime = time.Time{}
+	link.AsymTime = time.Time{}
+	link.Time = o.Clock.Now().Add(o.Config.NeighbHoldTime)
+
+	o.update()
+}
+
+// NextHop returns the neighbour to forward a packet for destination to
+func (o *OLSR) NextHop(destination string) (string, bool) {
+	route, exists := o.Routes[destination]
+	if !exists {
+		return "", false
+	}
+
+	return route.NextHop, true
+}
+
+// RequestRoute has nothing to discover, routes follow the topology and
+// OnRoute is raised once destination shows up in it
+func (o *OLSR) RequestRoute(destination string) {
+	if _, exists := o.Routes[destination]; exists {
+		o.Events.Route(destination)
+		return
+	}
+
+	log.Printf("%s: no route to %s in the topology yet", o.node.ID(), destination)
+}
+
+// Repairing is always false, OLSR doesn't repair routes
+func (o *OLSR) Repairing(destination string) bool {
+	return false
+}
+
+// Unreachable only logs, the topology the previous hop routed by corrects
+// itself with the next HELLOs and TCs
+func (o *OLSR) Unreachable(destination string, previousHop string) {
+	log.Printf("%s: no route to %s, dropping packet from %s", o.node.ID(), destination, previousHop)
+}
+
+func (o *OLSR) SetRouteEvents(events RouteEvents) {
+	o.Events = events
+}
+
+// sendHello advertises every link we know of with its state and whether we
+// picked the neighbour as MPR (RFC3626 6.2)
+func (o *OLSR) sendHello() {
+	now := o.Clock.Now()
+
+	msg := types.OLSRMessage{
+		Type:           1,
+		VTime:          o.Config.NeighbHoldTime,
+		OriginatorId:   o.node.ID(),
+		TTL:            1,
+		SequenceNumber: o.nextSequenceNumber(),
+		Willingness:    *o.Config.Willingness,
+	}
+
+	for _, id := range sortedKeys(o.Links) {
+		link := o.Links[id]
+		l := types.OLSRLink{ID: id, LinkType: linkLost, NeighbourType: neighNot}
+
+		if link.symmetric(now) {
+			l.LinkType = linkSym
+		} else if link.asymmetric(now) {
+			l.LinkType = linkAsym
+		}
+
+		if o.MPRs[id] {
+			l.NeighbourType = neighMPR
+		} else if _, symmetric := o.Neighbours[id]; symmetric {
+			l.NeighbourType = neighSym
+		}
+
+		msg.Links = append(msg.Links, l)
+	}
+
+	o.broadcast(msg)
+}
+
+// handleHello senses the link to the HELLO's sender (RFC3626 7.1.1), then
+// takes its symmetric neighbours as our two hop neighbours and notes whether
+// it picked us as MPR (RFC3626 8.2.1 and 8.4.1)
+func (o *OLSR) handleHello(msg types.OLSRMessage) {
+	now := o.Clock.Now()
+	self := o.node.ID()
+	from := msg.OriginatorId
+
+	link, exists := o.Links[from]
+	if !exists {
+		link = &LinkTuple{ID: from}
+		o.Links[from] = link
+	}
+
+	link.AsymTime = now.Add(msg.VTime)
+	for _, l := range msg.Links {
+		if l.ID != self {
+			continue
+		}
+
+		if l.LinkType == linkLost {
+			link.SymTime = time.Time{}
+		} else {
+			link.SymTime = now.Add(msg.VTime)
+			link.Time = link.SymTime.Add(o.Config.NeighbHoldTime)
+		}
+	}
+	if link.AsymTime.After(link.Time) {
+		link.Time = link.AsymTime
+	}
+
+	o.refreshNeighbours()
+
+	if _, symmetric := o.Neighbours[from]; !symmetric {
+		o.update()
+		return
+	}
+	o.Neighbours[from] = msg.Willingness
+
+	twoHop, exists := o.TwoHop[from]
+	if !exists {
+		twoHop = make(map[string]time.Time)
+		o.TwoHop[from] = twoHop
+	}
+
+	for _, l := range msg.Links {
+		if l.ID == self {
+			if l.NeighbourType == neighMPR {
+				o.MPRSelectors[from] = now.Add(msg.VTime)
+			}
+			continue
+		}
+
+		switch l.NeighbourType {
+		case neighSym, neighMPR:
+			twoHop[l.ID] = now.Add(msg.VTime)
+		case neighNot:
+			delete(twoHop, l.ID)
+		}
+	}
+
+	o.update()
+}
+
+// refreshNeighbours brings the neighbour set in line with the links that
+// are symmetric, a lost neighbour takes its two hop neighbours and MPR
+// selector entry with it (RFC3626 8.5)
+func (o *OLSR) refreshNeighbours() {
+	now := o.Clock.Now()
+
+	for _, id := range sortedKeys(o.Links) {
+		if _, exists := o.Neighbours[id]; !exists && o.Links[id].symmetric(now) {
+			log.Printf("drone %s > symmetric link to %s", o.node.ID(), id)
+			o.Neighbours[id] = WillDefault
+		}
+	}
+
+	for _, id := range sortedKeys(o.Neighbours) {
+		if link, exists := o.Links[id]; exists && link.symmetric(now) {
+			continue
+		}
+
+		log.Printf("drone %s > lost neighbour %s", o.node.ID(), id)
+		delete(o.Neighbours, id)
+		delete(o.TwoHop, id)
+		delete(o.MPRSelectors, id)
+	}
+}
+
+// expire drops the links, two hop neighbours, MPR selectors, topology and
+// duplicates that have outlived their validity time
+func (o *OLSR) expire() {
+	now := o.Clock.Now()
+
+	for _, id := range sortedKeys(o.Links) {
+		if o.Links[id].Time.Before(now) {
+			delete(o.Links, id)
+		}
+	}
+	o.refreshNeighbours()
+
+	for _, id := range sortedKeys(o.TwoHop) {
+		for twoHop, expires := range o.TwoHop[id] {
+			if expires.Before(now) {
+				delete(o.TwoHop[id], twoHop)
+			}
+		}
+	}
+	for id, expires := range o.MPRSelectors {
+		if expires.Before(now) {
+			delete(o.MPRSelectors, id)
+		}
+	}
+	for originator, entry := range o.Topology {
+		for destination, expires := range entry.Destinations {
+			if expires.Before(now) {
+				delete(entry.Destinations, destination)
+			}
+		}
+		if len(entry.Destinations) == 0 {
+			delete(o.Topology, originator)
+		}
+	}
+	for key, dup := range o.duplicates {
+		if dup.expires.Before(now) {
+			delete(o.duplicates, key)
+		}
+	}
+}
+
+// update recalculates the MPRs and the routes after the neighbourhood or the
+// topology changed
+func (o *OLSR) update() {
+	o.selectMPRs()
+	o.calculateRoutes()
+}
+
+func (o *OLSR) nextSequenceNumber() int {
+	o.SequenceNumber = seqNext(o.SequenceNumber)
+
+	return o.SequenceNumber
+}
+
+func (o *OLSR) broadcast(msg types.OLSRMessage) {
+	dMsg := types.DroneMessage{
+		Source:      o.node.ID(),
+		Type:        "OLSR",
+		OLSRPayload: &msg,
+	}
+
+	data, _ := json.Marshal(dMsg)
+
+	o.radioQueue.Push(data)
+}
@@ -0,0 +1,94 @@
+package routing
+
+import (
+	"log"
+	"maps"
+	"slices"
+)
+
+// selectMPRs picks the neighbours that relay our broadcasts so every strict
+// two hop neighbour hears them (RFC3626 8.3.1). Neighbours that always
+// forward and those that are the only way to a two hop neighbour go first,
+// then the willing one covering the most uncovered two hop neighbours.
+func (o *OLSR) selectMPRs() {
+	self := o.node.ID()
+
+	candidates := make([]string, 0, len(o.Neighbours))
+	for _, id := range sortedKeys(o.Neighbours) {
+		if o.Neighbours[id] != WillNever {
+			candidates = append(candidates, id)
+		}
+	}
+
+	// the strict two hop neighbours and the candidates that reach them
+	reachedBy := make(map[string][]string)
+	for _, id := range candidates {
+		for _, twoHop := range sortedKeys(o.TwoHop[id]) {
+			if _, neighbour := o.Neighbours[twoHop]; neighbour || twoHop == self {
+				continue
+			}
+			reachedBy[twoHop] = append(reachedBy[twoHop], id)
+		}
+	}
+
+	mprs := make(map[string]bool)
+	for _, id := range candidates {
+		if o.Neighbours[id] == WillAlways {
+			mprs[id] = true
+		}
+	}
+	for _, via := range reachedBy {
+		if len(via) == 1 {
+			mprs[via[0]] = true
+		}
+	}
+
+	uncovered := make(map[string]bool)
+	for twoHop, via := range reachedBy {
+		if !slices.ContainsFunc(via, func(id string) bool { return mprs[id] }) {
+			uncovered[twoHop] = true
+		}
+	}
+
+	for len(uncovered) > 0 {
+		best, bestReach, bestDegree := "", 0, 0
+
+		for _, id := range candidates {
+			if mprs[id] {
+				continue
+			}
+
+			reach, degree := 0, 0
+			for twoHop := range o.TwoHop[id] {
+				if uncovered[twoHop] {
+					reach++
+				}
+				if _, strict := reachedBy[twoHop]; strict {
+					degree++
+				}
+			}
+			if reach == 0 {
+				continue
+			}
+
+			if best == "" || o.Neighbours[id] > o.Neighbours[best] ||
+				(o.Neighbours[id] == o.Neighbours[best] && (reach > bestReach || (reach == bestReach && degree > bestDegree))) {
+				best, bestReach, bestDegree = id, reach, degree
+			}
+		}
+
+		if best == "" {
+			break
+		}
+
+		mprs[best] = true
+		for twoHop := range o.TwoHop[best] {
+			delete(uncovered, twoHop)
+		}
+	}
+
+	if !maps.Equal(mprs, o.MPRs) {
+		log.Printf("drone %s > MPRs %v", self, sortedKeys(mprs))
+	}
+	o.MPRs = mprs
+}
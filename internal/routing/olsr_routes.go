@@ -0,0 +1,68 @@
+package routing
+
+import "log"
+
+// calculateRoutes builds the routing table from scratch, shortest paths first:
+// the neighbours, the two hop neighbours through them, then every advertised
+// link that extends a route one hop further (RFC3626 10). OnRoute is raised
+// for each destination that wasn't reachable before.
+func (o *OLSR) calculateRoutes() {
+	self := o.node.ID()
+	routes := make(map[string]OLSRRoute)
+
+	for _, id := range sortedKeys(o.Neighbours) {
+		routes[id] = OLSRRoute{Destination: id, NextHop: id, Hops: 1}
+	}
+	for _, id := range sortedKeys(o.Neighbours) {
+		for _, twoHop := range sortedKeys(o.TwoHop[id]) {
+			if _, exists := routes[twoHop]; exists || twoHop == self {
+				continue
+			}
+			routes[twoHop] = OLSRRoute{Destination: twoHop, NextHop: id, Hops: 2}
+		}
+	}
+
+	for hops := 1; ; hops++ {
+		added := false
+
+		for _, last := range sortedKeys(o.Topology) {
+			route, exists := routes[last]
+			if !exists || route.Hops != hops {
+				continue
+			}
+
+			for _, destination := range sortedKeys(o.Topology[last].Destinations) {
+				if _, exists := routes[destination]; exists || destination == self {
+					continue
+				}
+				routes[destination] = OLSRRoute{Destination: destination, NextHop: route.NextHop, Hops: hops + 1}
+				added = true
+			}
+		}
+
+		if !added && hops >= 2 {
+			break
+		}
+	}
+
+	previous := o.Routes
+	o.Routes = routes
+
+	for _, destination := range sortedKeys(previous) {
+		if _, exists := routes[destination]; !exists {
+			log.Printf("%s: lost route to %s", self, destination)
+		}
+	}
+	for _, destination := range sortedKeys(routes) {
+		route := routes[destination]
+		old, existed := previous[destination]
+
+		switch {
+		case !existed:
+			log.Printf("%s: creating route to %s via %s (%d hops)", self, destination, route.NextHop, route.Hops)
+			o.Events.Route(destination)
+		case old != route:
+			log.Printf("%s: updating route to %s via %s (%d hops)", self, destination, route.NextHop, route.Hops)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package routing
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/azaurus1/swarm/internal/types"
+)
+
+// TC messages cross the whole network
+const tcTTL = 255
+
+// sendTC floods our MPR selectors to the network (RFC3626 9.2 and 9.3). A
+// drone nobody picked as MPR stays quiet, once it loses its last selector it
+// sends empty TCs for TopHoldTime so the others drop what it advertised.
+func (o *OLSR) sendTC() {
+	now := o.Clock.Now()
+	advertised := sortedKeys(o.MPRSelectors)
+
+	if len(advertised) > 0 {
+		o.lastSelectors = now
+	} else if o.lastSelectors.IsZero() || now.Sub(o.lastSelectors) > o.Config.TopHoldTime {
+		return
+	}
+
+	if !slices.Equal(advertised, o.advertised) {
+		o.ANSN = seqNext(o.ANSN)
+		o.advertised = advertised
+	}
+
+	msg := types.OLSRMessage{
+		Type:           2,
+		VTime:          o.Config.TopHoldTime,
+		OriginatorId:   o.node.ID(),
+		TTL:            tcTTL,
+		SequenceNumber: o.nextSequenceNumber(),
+		ANSN:           o.ANSN,
+		Advertised:     advertised,
+	}
+
+	o.duplicates[fmt.Sprintf("%s-%d", msg.OriginatorId, msg.SequenceNumber)] = &duplicate{
+		expires:       now.Add(o.Config.DupHoldTime),
+		retransmitted: true,
+	}
+
+	o.broadcast(msg)
+}
+
+// handleTC records the links a TC advertises, a TC older than the last one
+// from its originator is ignored and a newer one replaces it (RFC3626 9.5)
+func (o *OLSR) handleTC(msg types.OLSRMessage) {
+	entry, exists := o.Topology[msg.OriginatorId]
+	if exists && seqNewer(entry.ANSN, msg.ANSN) {
+		return
+	}
+
+	if !exists || seqNewer(msg.ANSN, entry.ANSN) {
+		entry = &TopologyEntry{ANSN: msg.ANSN, Destinations: make(map[string]time.Time)}
+		o.Topology[msg.OriginatorId] = entry
+	}
+
+	for _, destination := range msg.Advertised {
+		entry.Destinations[destination] = o.Clock.Now().Add(msg.VTime)
+	}
+
+	o.calculateRoutes()
+}
@@ -0,0 +1,146 @@
+package routing
+
+import (
+	"maps"
+	"testing"
+	"time"
+
+	"github.com/azaurus1/swarm/internal/sim"
+)
+
+// twoHop builds an OLSR two hop set, neighbour to the drones it reaches
+func twoHop(links map[string][]string) map[string]map[string]time.Time {
+	set := make(map[string]map[string]time.Time)
+	for neighbour, reached := range links {
+		set[neighbour] = make(map[string]time.Time)
+		for _, id := range reached {
+			set[neighbour][id] = sim.Epoch.Add(time.Hour)
+		}
+	}
+	return set
+}
+
+func TestSelectMPRs(t *testing.T) {
+	tests := []struct {
+		name       string
+		neighbours map[string]int
+		twoHop     map[string][]string
+		mprs       map[string]bool
+	}{
+		{
+			name:       "sole cover",
+			neighbours: map[string]int{"b": WillDefault, "c": WillDefault},
+			twoHop:     map[string][]string{"b": {"x"}, "c": {"x", "y"}},
+			mprs:       map[string]bool{"c": true},
+		},
+		{
+			name:       "never willing",
+			neighbours: map[string]int{"b": WillNever, "c": WillDefault},
+			twoHop:     map[string][]string{"b": {"x", "y"}, "c": {"x"}},
+			mprs:       map[string]bool{"c": true},
+		},
+		{
+			name:       "always willing",
+			neighbours: map[string]int{"b": WillAlways, "c": WillDefault},
+			twoHop:     map[string][]string{"c": {"x"}},
+			mprs:       map[string]bool{"b": true, "c": true},
+		},
+		{
+			name:       "greatest reach",
+			neighbours: map[string]int{"b": WillDefault, "c": WillDefault, "d": WillDefault},
+			twoHop:     map[string][]string{"b": {"x", "y"}, "c": {"x"}, "d": {"y"}},
+			mprs:       map[string]bool{"b": true},
+		},
+		{
+			name:       "higher willingness first",
+			neighbours: map[string]int{"b": WillDefault, "c": WillHigh},
+			twoHop:     map[string][]string{"b": {"x", "y"}, "c": {"x", "y"}},
+			mprs:       map[string]bool{"c": true},
+		},
+		{
+			name:       "neighbours and self aren't two hop",
+			neighbours: map[string]int{"b": WillDefault, "c": WillDefault},
+			twoHop:     map[string][]string{"b": {"a", "c"}},
+			mprs:       map[string]bool{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := NewOLSR(OLSRConfig{}, sim.NewScheduler(1))
+			o.node = testNode{id: "a"}
+			o.Neighbours = tt.neighbours
+			o.TwoHop = twoHop(tt.twoHop)
+
+			o.selectMPRs()
+
+			if !maps.Equal(o.MPRs, tt.mprs) {
+				t.Errorf("MPRs %v, want %v", sortedKeys(o.MPRs), sortedKeys(tt.mprs))
+			}
+		})
+	}
+}
+
+func TestCalculateRoutes(t *testing.T) {
+	tests := []struct {
+		name       string
+		neighbours []string
+		twoHop     map[string][]string
+		topology   map[string][]string
+		routes     map[string]OLSRRoute
+	}{
+		{
+			name:       "neighbours only",
+			neighbours: []string{"b", "c"},
+			routes: map[string]OLSRRoute{
+				"b": {Destination: "b", NextHop: "b", Hops: 1},
+				"c": {Destination: "c", NextHop: "c", Hops: 1},
+			},
+		},
+		{
+			name:       "two hops through the first neighbour",
+			neighbours: []string{"b", "c"},
+			twoHop:     map[string][]string{"b": {"d", "a"}, "c": {"d", "e", "b"}},
+			routes: map[string]OLSRRoute{
+				"b": {Destination: "b", NextHop: "b", Hops: 1},
+				"c": {Destination: "c", NextHop: "c", Hops: 1},
+				"d": {Destination: "d", NextHop: "b", Hops: 2},
+				"e": {Destination: "e", NextHop: "c", Hops: 2},
+			},
+		},
+		{
+			name:       "advertised links",
+			neighbours: []string{"b", "c"},
+			twoHop:     map[string][]string{"b": {"d"}, "c": {"e"}},
+			topology:   map[string][]string{"d": {"f", "a"}, "e": {"f"}, "f": {"g", "d"}, "x": {"y"}},
+			routes: map[string]OLSRRoute{
+				"b": {Destination: "b", NextHop: "b", Hops: 1},
+				"c": {Destination: "c", NextHop: "c", Hops: 1},
+				"d": {Destination: "d", NextHop: "b", Hops: 2},
+				"e": {Destination: "e", NextHop: "c", Hops: 2},
+				"f": {Destination: "f", NextHop: "b", Hops: 3},
+				"g": {Destination: "g", NextHop: "b", Hops: 4},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := NewOLSR(OLSRConfig{}, sim.NewScheduler(1))
+			o.node = testNode{id: "a"}
+			for _, id := range tt.neighbours {
+				o.Neighbours[id] = WillDefault
+			}
+			o.TwoHop = twoHop(tt.twoHop)
+			for last, destinations := range twoHop(tt.topology) {
+				o.Topology[last] = &TopologyEntry{Destinations: destinations}
+			}
+
+			o.calculateRoutes()
+
+			if !maps.Equal(o.Routes, tt.routes) {
+				t.Errorf("routes %v, want %v", o.Routes, tt.routes)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package routing
+
+import (
+	"time"
+
+	"github.com/azaurus1/swarm/internal/sim"
+	"github.com/azaurus1/swarm/internal/types"
+)
+
+// Node is the drone a routing protocol runs on
+type Node interface {
+	ID() string
+	Position() types.Position
+	Velocity() types.Velocity
+	// Range is how far the drone's radio reaches
+	Range() float64
+}
+
+// Protocol is a MANET routing protocol as the drone and the transport and
+// control layers see it, so they don't care which one a scenario runs
+type Protocol interface {
+	// Name is the DroneMessage.Type the protocol's own frames are sent with
+	Name() string
+	// Start binds the protocol to node and schedules its periodic
+	// transmissions, nothing is sent until the scheduler runs
+	Start(node Node, sched *sim.Scheduler, radioQueue *sim.Queue)
+	// HandleMessage processes one of the protocol's own frames
+	HandleMessage(msg types.DroneMessage)
+	// Tick expires stale routes and neighbours, it is called every
+	// TickInterval
+	Tick()
+	TickInterval() time.Duration
+	// PendingTimeout is how long a packet may wait for a route to its
+	// destination before it is dropped
+	PendingTimeout() time.Duration
+
+	// HeardFrom is called for every frame received from neighbour
+	HeardFrom(neighbour string)
+	// LinkFailed is called when the link layer couldn't deliver to neighbour
+	LinkFailed(neighbour string)
+
+	// NextHop returns the neighbour to forward a packet for destination to
+	NextHop(destination string) (string, bool)
+	// RequestRoute asks for a route to destination, OnRoute or OnNoRoute
+	// tells how it went
+	RequestRoute(destination string)
+	// Repairing reports whether a route to destination is being repaired,
+	// packets for it should be held rather than dropped
+	Repairing(destination string) bool
+	// Unreachable reports that a packet for destination from previousHop
+	// couldn't be forwarded
+	Unreachable(destination string, previousHop string)
+	// SetRouteEvents sets the callbacks for routes being found or given up on
+	SetRouteEvents(events RouteEvents)
+}
+
+// RouteEvents are the callbacks a protocol raises as routes come and go
+type RouteEvents struct {
+	// OnRoute is called whenever a valid route to destination is installed
+	OnRoute func(destination string)
+	// OnNoRoute is called when no route to destination could be found
+	OnNoRoute func(destination string)
+}
+
+// Route calls OnRoute if it is set
+func (e RouteEvents) Route(destination string) {
+	if e.OnRoute != nil {
+		e.OnRoute(destination)
+	}
+}
+
+// NoRoute calls OnNoRoute if it is set
+func (e RouteEvents) NoRoute(destination string) {
+	if e.OnNoRoute != nil {
+		e.OnNoRoute(destination)
+	}
+}
+
+// A PacketRouter routes DATA packets by the route they carry rather than by
+// their recipient alone, as DSR does. The transport layer uses it in place of
+// NextHop when the protocol provides it.
+type PacketRouter interface {
+	// RoutePacket returns the next hop for packet, a packet we originate
+	// gets its route written into it
+	RoutePacket(packet *types.DataMessage) (string, bool)
+	// SalvagePacket finds another route for a packet whose next hop couldn't
+	// be reached
+	SalvagePacket(packet *types.DataMessage) (string, bool)
+}
+
+// A Custodian stores DATA packets and carries them until it meets a drone
+// to hand them to, as delay tolerant routing does, so no route to the
+// recipient is needed. The transport layer gives it every packet in place
+// of routing it.
+type Custodian interface {
+	// Store takes custody of a packet that isn't for us, from is the drone
+	// that handed it over, us for a packet we originate
+	Store(packet types.DataMessage, from string)
+	// Delivered records a packet that reached us, its recipient, so it isn't
+	// handed to us again
+	Delivered(packet types.DataMessage)
+}
@@ -0,0 +1,91 @@
+package routing
+
+import (
+	"log"
+
+	"github.com/azaurus1/swarm/internal/sim"
+	"github.com/azaurus1/swarm/internal/types"
+)
+
+// a local repair in progress (RFC3561 6.12)
+type repair struct {
+	// hop count before the break, a longer repaired route is reported
+	hopCount int
+	timer    *sim.Event
+}
+
+// Repairing reports whether a local repair of the route to destination is
+// running, packets for it should be held rather than dropped
+func (a *AODVListener) Repairing(destination string) bool {
+	_, exists := a.repairs[destination]
+	return exists
+}
+
+// canRepair decides whether a broken route is repaired where it broke rather
+// than reported upstream: only routes others forward through us, to
+// destinations no more than MaxRepairTTL hops away
+func (a *AODVListener) canRepair(entry RoutingTableEntry) bool {
+	return len(entry.Precursors) > 0 && entry.HopCount <= *a.Config.MaxRepairTTL
+}
+
+// startRepair looks for the destination of a broken route with an RREQ
+// that goes a little further than the destination was, the RERR is only sent
+// if that fails
+func (a *AODVListener) startRepair(droneId string, entry RoutingTableEntry, radioQueue *sim.Queue) {
+	if a.Repairing(entry.ID) {
+		return
+	}
+
+	// the originators of the traffic aren't known here, the last known
+	// distance to the destination is used for MIN_REPAIR_TTL
+	ttl := entry.HopCount + *a.Config.LocalAddTTL
+
+	log.Printf("%s: repairing route to %s locally with TTL %d", droneId, entry.ID, ttl)
+
+	r := &repair{hopCount: entry.HopCount}
+	a.repairs[entry.ID] = r
+
+	a.sentRREQs = append(a.sentRREQs, a.Clock.Now())
+	a.sendRREQ(droneId, entry.ID, ttl, radioQueue)
+
+	destination := entry.ID
+	r.timer = a.Clock.After(a.Config.RingTraversalTime(ttl), func() {
+		a.repairFailed(droneId, destination, radioQueue)
+	})
+}
+
+// repairFailed falls back to the RERR the break would have caused
+func (a *AODVListener) repairFailed(droneId string, destination string, radioQueue *sim.Queue) {
+	delete(a.repairs, destination)
+
+	log.Printf("%s: local repair of route to %s failed", droneId, destination)
+
+	entry, exists := a.RoutingTable.Entries[destination]
+	if exists && !entry.Valid {
+		unreachable := []types.UnreachableDestination{{ID: destination, SequenceNum: entry.SequenceNumber}}
+		a.sendRERR(droneId, unreachable, entry.Precursors, false, radioQueue)
+	}
+
+	a.Events.NoRoute(destination)
+}
+
+// repairDone stops the repair of the route to destination once it is back,
+// a route longer than the broken one is reported to the precursors with a
+// RERR with the N flag so they can look for a better one
+func (a *AODVListener) repairDone(droneId string, destination string, hopCount int) {
+	r, exists := a.repairs[destination]
+	if !exists {
+		return
+	}
+
+	r.timer.Cancel()
+	delete(a.repairs, destination)
+
+	log.Printf("%s: route to %s repaired, %d hops instead of %d", droneId, destination, hopCount, r.hopCount)
+
+	if hopCount > r.hopCount {
+		entry := a.RoutingTable.Entries[destination]
+		repaired := []types.UnreachableDestination{{ID: destination, SequenceNum: entry.SequenceNumber}}
+		a.sendRERR(droneId, repaired, entry.Precursors, true, a.radioQueue)
+	}
+}
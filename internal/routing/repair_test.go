@@ -0,0 +1,235 @@
+package routing
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/azaurus1/swarm/internal/sim"
+	"github.com/azaurus1/swarm/internal/types"
+)
+
+// sentRERR is a RERR as it went out, nextHop is empty if it was broadcast
+type sentRERR struct {
+	at           time.Duration
+	nextHop      string
+	noDelete     bool
+	destinations string
+}
+
+// recordAODV collects the RREQs and RERRs sent into queue
+func recordAODV(sched *sim.Scheduler, queue *sim.Queue) (*[]sentRREQ, *[]sentRERR) {
+	var rreqs []sentRREQ
+	var rerrs []sentRERR
+
+	sched.AfterEvent(func() {
+		for {
+			frame, ok := queue.Pop()
+			if !ok {
+				return
+			}
+			var msg types.DroneMessage
+			json.Unmarshal(frame, &msg)
+
+			switch aMsg := msg.AODVPayload; aMsg.Type {
+			case 1:
+				rreqs = append(rreqs, sentRREQ{sched.Elapsed(), aMsg.DestinationId, aMsg.TTL})
+			case 3:
+				rerr := sentRERR{at: sched.Elapsed(), nextHop: msg.NextHop, noDelete: aMsg.NoDelete}
+				for _, u := range aMsg.UnreachableDestinations {
+					rerr.destinations += u.ID
+				}
+				rerrs = append(rerrs, rerr)
+			}
+		}
+	})
+
+	return &rreqs, &rerrs
+}
+
+func TestLocalRepair(t *testing.T) {
+	ms := time.Millisecond
+
+	// b forwards a's packets for d through c, c goes away at 100ms
+	tests := []struct {
+		name string
+		// hop count from b to d before the break
+		hopCount int
+		// when a route comes back and how long it is, no RREP if zero
+		rrepAt       time.Duration
+		rrepHopCount int
+		rreqs        []sentRREQ
+		rerrs        []sentRERR
+		// the route to d is back via e at the end
+		repaired bool
+		// the repair gave up and dropped the held packets
+		noRoute bool
+	}{
+		{
+			name:         "repaired as long",
+			hopCount:     2,
+			rrepAt:       200 * ms,
+			rrepHopCount: 2,
+			rreqs:        []sentRREQ{{100 * ms, "d", 4}},
+			repaired:     true,
+		},
+		{
+			// the precursors are told, but keep the route
+			name:         "repaired longer",
+			hopCount:     2,
+			rrepAt:       200 * ms,
+			rrepHopCount: 3,
+			rreqs:        []sentRREQ{{100 * ms, "d", 4}},
+			rerrs:        []sentRERR{{200 * ms, "a", true, "d"}},
+			repaired:     true,
+		},
+		{
+			// the ring is 80ms*(4+2) across
+			name:     "repair fails",
+			hopCount: 2,
+			rreqs:    []sentRREQ{{100 * ms, "d", 4}},
+			rerrs:    []sentRERR{{580 * ms, "a", false, "d"}},
+			noRoute:  true,
+		},
+		{
+			name:         "answer too late",
+			hopCount:     2,
+			rrepAt:       600 * ms,
+			rrepHopCount: 2,
+			rreqs:        []sentRREQ{{100 * ms, "d", 4}},
+			rerrs:        []sentRERR{{580 * ms, "a", false, "d"}},
+			repaired:     true,
+			noRoute:      true,
+		},
+		{
+			// MaxRepairTTL is 10 with a NetDiameter of 35
+			name:     "too far to repair",
+			hopCount: 11,
+			rerrs:    []sentRERR{{100 * ms, "a", false, "d"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sched := sim.NewScheduler(1)
+			queue := sim.NewQueue()
+			rreqs, rerrs := recordAODV(sched, queue)
+
+			b := NewAODVListener(AODVConfig{}, sched)
+			b.radioQueue = queue
+			b.RoutingTable.Entries["d"] = RoutingTableEntry{
+				ID:             "d",
+				SequenceNumber: 5,
+				NextHop:        "c",
+				HopCount:       tt.hopCount,
+				Valid:          true,
+				Expiration:     sched.Now().Add(time.Minute),
+				Precursors:     []string{"a"},
+			}
+
+			var routes, noRoutes []time.Duration
+			b.SetRouteEvents(RouteEvents{
+				OnRoute:   func(string) { routes = append(routes, sched.Elapsed()) },
+				OnNoRoute: func(string) { noRoutes = append(noRoutes, sched.Elapsed()) },
+			})
+
+			var held bool
+			sched.At(100*ms, func() {
+				b.HandleLinkBreak("b", "c", queue)
+				// the transport layer holds packets for d rather than
+				// dropping them while this is true
+				held = b.Repairing("d")
+			})
+			if tt.rrepAt > 0 {
+				sched.At(tt.rrepAt, func() {
+					b.HandleAODVMessage("b", types.AODVMessage{
+						Source:                 "e",
+						Type:                   2,
+						OriginatorId:           "b",
+						DestinationId:          "d",
+						DestinationSequenceNum: 7,
+						HopCount:               tt.rrepHopCount,
+					}, queue)
+				})
+			}
+			sched.Run(time.Second)
+
+			if !slices.Equal(*rreqs, tt.rreqs) {
+				t.Errorf("sent RREQs %v, want %v", *rreqs, tt.rreqs)
+			}
+			if !slices.Equal(*rerrs, tt.rerrs) {
+				t.Errorf("sent RERRs %v, want %v", *rerrs, tt.rerrs)
+			}
+			if repairing := len(tt.rreqs) > 0; held != repairing {
+				t.Errorf("held packets during the repair: %v, want %v", held, repairing)
+			}
+			if b.Repairing("d") {
+				t.Errorf("still repairing at the end")
+			}
+
+			if next, exists := b.NextHop("d"); exists != tt.repaired || (exists && next != "e") {
+				t.Errorf("NextHop(d) = %s, %v, want e, %v", next, exists, tt.repaired)
+			}
+			// the route event is what flushes the held packets
+			if want := []time.Duration{tt.rrepAt}; tt.repaired && !slices.Equal(routes, want) {
+				t.Errorf("route events at %v, want %v", routes, want)
+			}
+			if gaveUp := len(noRoutes) > 0; gaveUp != tt.noRoute {
+				t.Errorf("no route events at %v, want any %v", noRoutes, tt.noRoute)
+			}
+		})
+	}
+}
+
+func TestRepairedRERR(t *testing.T) {
+	tests := []struct {
+		name string
+		// sender of the RERR, and whether it has the N flag set
+		source   string
+		noDelete bool
+		rerrs    []sentRERR
+		valid    bool
+	}{
+		{"repaired downstream", "b", true, []sentRERR{{0, "s", true, "d"}}, true},
+		{"not our next hop", "x", true, nil, true},
+		{"broken downstream", "b", false, []sentRERR{{0, "s", false, "d"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sched := sim.NewScheduler(1)
+			queue := sim.NewQueue()
+			_, rerrs := recordAODV(sched, queue)
+
+			// a forwards s's packets for d through b
+			a := NewAODVListener(AODVConfig{}, sched)
+			a.RoutingTable.Entries["d"] = RoutingTableEntry{
+				ID:             "d",
+				SequenceNumber: 5,
+				NextHop:        "b",
+				HopCount:       3,
+				Valid:          true,
+				Expiration:     sched.Now().Add(time.Minute),
+				Precursors:     []string{"s"},
+			}
+
+			sched.At(0, func() {
+				a.HandleAODVMessage("a", types.AODVMessage{
+					Source:                  tt.source,
+					Type:                    3,
+					UnreachableDestinations: []types.UnreachableDestination{{ID: "d", SequenceNum: 6}},
+					NoDelete:                tt.noDelete,
+				}, queue)
+			})
+			sched.Run(time.Second)
+
+			if !slices.Equal(*rerrs, tt.rerrs) {
+				t.Errorf("sent RERRs %v, want %v", *rerrs, tt.rerrs)
+			}
+			if entry := a.RoutingTable.Entries["d"]; entry.Valid != tt.valid || entry.NextHop != "b" {
+				t.Errorf("route to d valid %v via %s, want valid %v via b", entry.Valid, entry.NextHop, tt.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package routing
+
+import (
+	"encoding/json"
+	"log"
+	"slices"
+	"sort"
+
+	"github.com/azaurus1/swarm/internal/sim"
+	"github.com/azaurus1/swarm/internal/types"
+)
+
+// updateRoute installs entry as a valid route, keeping the precursors of any
+// route it replaces
+func (a *AODVListener) updateRoute(entry RoutingTableEntry) {
+	if old, exists := a.RoutingTable.Entries[entry.ID]; exists {
+		entry.Precursors = old.Precursors
+	}
+	entry.Valid = true
+
+	a.RoutingTable.Entries[entry.ID] = entry
+}
+
+func (a *AODVListener) addPrecursor(destination string, precursor string) {
+	entry, exists := a.RoutingTable.Entries[destination]
+	if !exists || precursor == "" || slices.Contains(entry.Precursors, precursor) {
+		return
+	}
+
+	entry.Precursors = append(entry.Precursors, precursor)
+	a.RoutingTable.Entries[destination] = entry
+}
+
+// HandleLinkBreak invalidates every route through neighbour and tells the
+// precursors of those routes (RFC3561 6.11 case i), unless the route can be
+// repaired locally
+func (a *AODVListener) HandleLinkBreak(droneId string, neighbour string, radioQueue *sim.Queue) {
+	var unreachable []types.UnreachableDestination
+	var precursors []string
+
+	for _, id := range sortedKeys(a.RoutingTable.Entries) {
+		entry := a.RoutingTable.Entries[id]
+		if !entry.Valid || a.failover(droneId, &entry, neighbour) || entry.NextHop != neighbour {
+			continue
+		}
+
+		log.Printf("%s: link to %s broken, invalidating route to %s", droneId, neighbour, id)
+
+		entry.SequenceNumber = seqNext(entry.SequenceNumber)
+		a.invalidate(&entry)
+
+		if a.canRepair(entry) {
+			a.startRepair(droneId, entry, radioQueue)
+			continue
+		}
+
+		unreachable = append(unreachable, types.UnreachableDestination{ID: id, SequenceNum: entry.SequenceNumber})
+		precursors = mergePrecursors(precursors, entry.Precursors)
+	}
+
+	a.sendRERR(droneId, unreachable, precursors, false, radioQueue)
+}
+
+// ReportUnreachable is sent when a packet for destination that came from
+// previousHop has to be dropped because there is no route to it (RFC3561
+// 6.11 case ii)
+func (a *AODVListener) ReportUnreachable(droneId string, destination string, previousHop string, radioQueue *sim.Queue) {
+	seqNum := 0
+	precursors := []string{previousHop}
+
+	if entry, exists := a.RoutingTable.Entries[destination]; exists {
+		seqNum = entry.SequenceNumber
+		precursors = mergePrecursors(precursors, entry.Precursors)
+	}
+
+	a.sendRERR(droneId, []types.UnreachableDestination{{ID: destination, SequenceNum: seqNum}}, precursors, false, radioQueue)
+}
+
+// handleRERR invalidates the routes in the RERR that go through its sender
+// and passes the news on to our own precursors (RFC3561 6.11 case iii)
+func (a *AODVListener) handleRERR(droneId string, aMsg types.AODVMessage, radioQueue *sim.Queue) {
+	if aMsg.NoDelete {
+		a.handleRepairedRERR(droneId, aMsg, radioQueue)
+		return
+	}
+
+	var unreachable []types.UnreachableDestination
+	var precursors []string
+
+	for _, u := range aMsg.UnreachableDestinations {
+		entry, exists := a.RoutingTable.Entries[u.ID]
+		if !exists || !entry.Valid || a.failover(droneId, &entry, aMsg.Source) || entry.NextHop != aMsg.Source {
+			continue
+		}
+
+		log.Printf("%s: route to %s via %s is broken", droneId, u.ID, aMsg.Source)
+
+		if seqNewer(u.SequenceNum, entry.SequenceNumber) {
+			entry.SequenceNumber = u.SequenceNum
+		}
+		a.invalidate(&entry)
+
+		unreachable = append(unreachable, types.UnreachableDestination{ID: u.ID, SequenceNum: entry.SequenceNumber})
+		precursors = mergePrecursors(precursors, entry.Precursors)
+	}
+
+	a.sendRERR(droneId, unreachable, precursors, false, radioQueue)
+}
+
+// handleRepairedRERR passes on a RERR with the N flag to the precursors of
+// the routes through its sender, the routes themselves are kept (RFC3561
+// 6.12)
+func (a *AODVListener) handleRepairedRERR(droneId string, aMsg types.AODVMessage, radioQueue *sim.Queue) {
+	var repaired []types.UnreachableDestination
+	var precursors []string
+
+	for _, u := range aMsg.UnreachableDestinations {
+		entry, exists := a.RoutingTable.Entries[u.ID]
+		if !exists || !entry.Valid || entry.NextHop != aMsg.Source {
+			continue
+		}
+
+		log.Printf("%s: route to %s via %s was repaired and is longer now", droneId, u.ID, aMsg.Source)
+
+		repaired = append(repaired, u)
+		precursors = mergePrecursors(precursors, entry.Precursors)
+	}
+
+	a.sendRERR(droneId, repaired, precursors, true, radioQueue)
+}
+
+// invalidate marks a route as broken, it is kept around for DeletePeriod so
+// its sequence number isn't forgotten
+func (a *AODVListener) invalidate(entry *RoutingTableEntry) {
+	entry.Valid = false
+	entry.Paths = nil
+	entry.Expiration = a.Clock.Now().Add(a.Config.DeletePeriod)
+	a.RoutingTable.Entries[entry.ID] = *entry
+}
+
+// sendRERR unicasts to a single precursor and broadcasts otherwise, noDelete
+// sets the N flag
+func (a *AODVListener) sendRERR(droneId string, unreachable []types.UnreachableDestination, precursors []string, noDelete bool, radioQueue *sim.Queue) {
+	if len(unreachable) == 0 || len(precursors) == 0 {
+		return
+	}
+
+	// RFC3561 6.11, at most RERRRateLimit RERRs a second, the rest are dropped
+	if rateLimited(a.Clock.Now(), &a.sentRERRs, a.Config.RERRRateLimit) > 0 {
+		log.Printf("%s: RERR rate limit reached, not sending", droneId)
+		return
+	}
+	a.sentRERRs = append(a.sentRERRs, a.Clock.Now())
+
+	nextHop := ""
+	if len(precursors) == 1 {
+		nextHop = precursors[0]
+	}
+
+	log.Printf("%s: sending RERR for %d destinations", droneId, len(unreachable))
+
+	errDMsg := types.DroneMessage{
+		Source:  droneId,
+		NextHop: nextHop,
+		Type:    "AODV",
+		AODVPayload: types.AODVMessage{
+			Source:                  droneId,
+			Type:                    3,
+			UnreachableDestinations: unreachable,
+			NoDelete:                noDelete,
+		},
+	}
+
+	data, _ := json.Marshal(errDMsg)
+
+	radioQueue.Push(data)
+}
+
+func mergePrecursors(precursors []string, more []string) []string {
+	for _, p := range more {
+		if !slices.Contains(precursors, p) {
+			precursors = append(precursors, p)
+		}
+	}
+	return precursors
+}
+
+// map iteration order is random, anything that sends messages while walking
+// a map walks it in key order so runs stay reproducible
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,246 @@
+package routing
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/azaurus1/swarm/internal/sim"
+	"github.com/azaurus1/swarm/internal/types"
+)
+
+// sequence numbers are 32 bit and roll over, a is newer than b if the signed
+// difference is positive (RFC3561 6.1)
+func seqNewer(a int, b int) bool {
+	return int32(uint32(a)-uint32(b)) > 0
+}
+
+func seqNext(s int) int {
+	return int(uint32(s) + 1)
+}
+
+// installRoute updates the route to destination if the advertised one is
+// fresher or better (RFC3561 6.2), see preferred. A re-advertised route only
+// gets its lifetime extended. A zero lifetime is ActiveRouteTimeout, with link
+// expiration prediction it ends LinkExpirationMargin before the path's
+// weakest link is predicted to break. With multipath routing a path with the
+// route's sequence number joins it instead, lastHop tells whether it is
+// disjoint from the others.
+func (a *AODVListener) installRoute(droneId string, destination string, seqNum int, nextHop string, lastHop string, hopCount int, metric float64, expiration time.Duration, lifetime time.Duration) bool {
+	if lifetime <= 0 {
+		lifetime = a.Config.ActiveRouteTimeout
+	}
+	linkExpiry := a.expiryIn(expiration)
+	if !linkExpiry.IsZero() {
+		lifetime = min(lifetime, max(expiration-*a.Config.LinkExpirationMargin, time.Millisecond))
+	}
+
+	entry, exists := a.RoutingTable.Entries[destination]
+
+	if a.Config.Multipath && exists && entry.Valid && seqNum == entry.SequenceNumber {
+		return a.joinPath(droneId, entry, Path{NextHop: nextHop, LastHop: lastHop, HopCount: hopCount, Expiration: a.Clock.Now().Add(lifetime)})
+	}
+
+	update := !exists ||
+		seqNewer(seqNum, entry.SequenceNumber) ||
+		(seqNum == entry.SequenceNumber && (!entry.Valid || a.preferred(hopCount, metric, linkExpiry, entry)))
+
+	if !update {
+		if entry.Valid && entry.NextHop == nextHop && seqNum == entry.SequenceNumber {
+			entry.Expiration = a.Clock.Now().Add(lifetime)
+			entry.LinkExpiry = linkExpiry
+			a.RoutingTable.Entries[destination] = entry
+		}
+		return false
+	}
+
+	route := fmt.Sprintf("seq %d, %d hops", seqNum, hopCount)
+	if a.Config.ETX {
+		route += fmt.Sprintf(", ETX %.2f", metric)
+	}
+	if !linkExpiry.IsZero() {
+		route += fmt.Sprintf(", link expires in %v", expiration.Round(time.Millisecond))
+	}
+	if exists {
+		log.Printf("%s: updating route to %s via %s (%s)", droneId, destination, nextHop, route)
+	} else {
+		log.Printf("%s: creating route to %s via %s (%s)", droneId, destination, nextHop, route)
+	}
+
+	a.updateRoute(RoutingTableEntry{
+		ID:             destination,
+		SequenceNumber: seqNum,
+		NextHop:        nextHop,
+		HopCount:       hopCount,
+		Metric:         metric,
+		LinkExpiry:     linkExpiry,
+		Expiration:     a.Clock.Now().Add(lifetime),
+		Paths:          a.firstPath(nextHop, lastHop, hopCount, a.Clock.Now().Add(lifetime)),
+	})
+
+	a.discoveryDone(destination)
+	a.repairDone(droneId, destination, hopCount)
+
+	a.Events.Route(destination)
+
+	return true
+}
+
+// preferred is true if a route of hopCount hops with metric and linkExpiry is
+// better than entry, which has the same sequence number. With link expiration
+// prediction the route predicted to last longer by more than
+// LinkExpirationMargin wins (Su, Lee and Gerla, 2001), otherwise the one with
+// the lower ETX with ETX metrics or the shorter one.
+func (a *AODVListener) preferred(hopCount int, metric float64, linkExpiry time.Time, entry RoutingTableEntry) bool {
+	if a.Config.LinkExpiration {
+		// a zero expiry is a route that isn't predicted to break
+		switch {
+		case linkExpiry.IsZero() && !entry.LinkExpiry.IsZero():
+			return true
+		case entry.LinkExpiry.IsZero() && !linkExpiry.IsZero():
+			return false
+		case linkExpiry.Sub(entry.LinkExpiry) > *a.Config.LinkExpirationMargin:
+			return true
+		case entry.LinkExpiry.Sub(linkExpiry) > *a.Config.LinkExpirationMargin:
+			return false
+		}
+	}
+	if a.Config.ETX {
+		return metric < entry.Metric
+	}
+
+	return hopCount < entry.HopCount
+}
+
+// sendRREQ broadcasts a new RREQ for destination that travels ttl hops
+// (RFC3561 6.3)
+func (a *AODVListener) sendRREQ(droneId string, destination string, ttl int, radioQueue *sim.Queue) {
+	a.SequenceNumber = seqNext(a.SequenceNumber)
+	a.RREQID = seqNext(a.RREQID)
+
+	reqMsg := types.AODVMessage{
+		Source:                droneId,
+		Type:                  1,
+		RREQID:                strconv.Itoa(a.RREQID),
+		OriginatorId:          droneId,
+		OriginatorSequenceNum: a.SequenceNumber,
+		DestinationId:         destination,
+		UnknownSequenceNum:    true,
+		Gratuitous:            a.Config.Gratuitous,
+		DestinationOnly:       a.Config.DestinationOnly,
+		TTL:                   ttl,
+	}
+
+	// ask for a route at least as fresh as the last one we knew of
+	if entry, exists := a.RoutingTable.Entries[destination]; exists {
+		reqMsg.DestinationSequenceNum = entry.SequenceNumber
+		reqMsg.UnknownSequenceNum = false
+	}
+
+	a.ReceivedRREQs[fmt.Sprintf("%s-%s", droneId, reqMsg.RREQID)] = a.Clock.Now()
+
+	log.Printf("%s: sending RREQ %s for %s with TTL %d", droneId, reqMsg.RREQID, destination, ttl)
+
+	reqDMsg := types.DroneMessage{
+		Source:      droneId,
+		Type:        "AODV",
+		AODVPayload: reqMsg,
+	}
+
+	data, _ := json.Marshal(reqDMsg)
+
+	radioQueue.Push(data)
+}
+
+// SendHello advertises ourselves to our neighbours, a HELLO is an unsolicited
+// RREP for our own route (RFC3561 6.9)
+func (a *AODVListener) SendHello(droneId string, position types.Position, radioQueue *sim.Queue) {
+	helloMsg := types.AODVMessage{
+		Source:                 droneId,
+		Type:                   2,
+		HopCount:               1,
+		DestinationId:          droneId,
+		DestinationSequenceNum: a.SequenceNumber,
+		OriginatorId:           droneId,
+		LifeTime:               time.Duration(a.Config.AllowedHelloLoss) * a.Config.HelloInterval,
+		TTL:                    1,
+		Position:               &position,
+	}
+
+	if a.Config.LinkExpiration {
+		velocity := a.node.Velocity()
+		helloMsg.Velocity = &velocity
+	}
+
+	if a.Config.ETX {
+		helloMsg.LinkQualities = make(map[string]float64)
+		for _, id := range a.Neighbours.IDs() {
+			if n := a.Neighbours.Entries[id]; !n.LastHello.IsZero() {
+				helloMsg.LinkQualities[id] = n.LinkQuality
+			}
+		}
+	}
+
+	helloDMsg := types.DroneMessage{
+		Source:      droneId,
+		Type:        "AODV",
+		AODVPayload: helloMsg,
+	}
+
+	data, _ := json.Marshal(helloDMsg)
+
+	radioQueue.Push(data)
+}
+
+// handleHello refreshes the neighbour and the one hop route to it
+// (RFC3561 6.9). The neighbour table breaks the route as soon as the
+// neighbour goes quiet, so it gets the usual lifetime rather than the HELLO's.
+// With ETX metrics the HELLO also tells how well the neighbour hears us.
+func (a *AODVListener) handleHello(droneId string, aMsg types.AODVMessage) {
+	a.Neighbours.HeardHello(aMsg.Source, aMsg.Position)
+	if a.Config.LinkExpiration {
+		a.Neighbours.Entries[aMsg.Source].Velocity = aMsg.Velocity
+	}
+	metric := a.linkMetric(aMsg.Source)
+
+	if a.Config.ETX {
+		a.Neighbours.Entries[aMsg.Source].ReverseQuality = aMsg.LinkQualities[droneId]
+		metric = a.linkMetric(aMsg.Source)
+
+		// the HELLO only tells the neighbour is there, a route to it over
+		// better links stays even though the HELLO's sequence number is newer
+		if entry, exists := a.RoutingTable.Entries[aMsg.Source]; exists && entry.Valid && entry.NextHop != aMsg.Source && entry.Metric < metric {
+			return
+		}
+	}
+
+	a.installRoute(droneId, aMsg.DestinationId, aMsg.DestinationSequenceNum, aMsg.Source, droneId, 1, metric, a.linkExpiration(aMsg.Source), 0)
+}
+
+// linkMetric is the ETX of the link to neighbour with ETX metrics, nothing
+// without so the messages stay as they were
+func (a *AODVListener) linkMetric(neighbour string) float64 {
+	if !a.Config.ETX {
+		return 0
+	}
+
+	return a.Neighbours.ETX(neighbour)
+}
+
+// betterCopy is true if a copy of an RREQ or RREP we already handled came
+// along a better path, see preferred. With ETX metrics or link expiration
+// prediction it is handled again, the best path should win rather than the
+// fastest.
+func (a *AODVListener) betterCopy(key string, hopCount int, metric float64, expiration time.Duration) bool {
+	best, exists := a.paths[key]
+
+	return (a.Config.ETX || a.Config.LinkExpiration) && exists && a.preferred(hopCount, metric, a.expiryIn(expiration), best)
+}
+
+func (a *AODVListener) recordPath(key string, hopCount int, metric float64, expiration time.Duration) {
+	if a.Config.ETX || a.Config.LinkExpiration {
+		a.paths[key] = RoutingTableEntry{HopCount: hopCount, Metric: metric, LinkExpiry: a.expiryIn(expiration)}
+	}
+}
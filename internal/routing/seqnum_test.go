@@ -0,0 +1,52 @@
+package routing
+
+import "testing"
+
+const maxSeq = 1<<32 - 1
+
+func TestSeqNewer(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  int
+		newer bool
+	}{
+		{"next", 1, 0, true},
+		{"previous", 0, 1, false},
+		{"same", 5, 5, false},
+		{"far ahead", 1000, 1, true},
+		{"rolled over", 0, maxSeq, true},
+		{"before rollover", maxSeq, 0, false},
+		{"rolled over further", 10, maxSeq - 10, true},
+		{"half the space ahead", 1 << 31, 0, false},
+		{"just under half ahead", 1<<31 - 1, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := seqNewer(tt.a, tt.b); got != tt.newer {
+				t.Errorf("seqNewer(%d, %d) = %v, want %v", tt.a, tt.b, got, tt.newer)
+			}
+		})
+	}
+}
+
+func TestSeqNext(t *testing.T) {
+	tests := []struct {
+		s, next int
+	}{
+		{0, 1},
+		{41, 42},
+		{maxSeq - 1, maxSeq},
+		{maxSeq, 0},
+	}
+
+	for _, tt := range tests {
+		next := seqNext(tt.s)
+		if next != tt.next {
+			t.Errorf("seqNext(%d) = %d, want %d", tt.s, next, tt.next)
+		}
+		if !seqNewer(next, tt.s) {
+			t.Errorf("seqNext(%d) = %d isn't newer", tt.s, next)
+		}
+	}
+}
@@ -0,0 +1,656 @@
+package scenario
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A ValidationError points at the line and column of the offending value in
+// the scenario file.
+type ValidationError struct {
+	Line    int
+	Column  int
+	Field   string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+	}
+	return fmt.Sprintf("%d:%d: %s: %s", e.Line, e.Column, e.Field, e.Message)
+}
+
+// ValidationErrors collects every problem found in a scenario file so they
+// can all be fixed in one go.
+type ValidationErrors struct {
+	File   string
+	Errors []ValidationError
+}
+
+func (e *ValidationErrors) Error() string {
+	lines := make([]string, 0, len(e.Errors))
+	for _, vErr := range e.Errors {
+		lines = append(lines, fmt.Sprintf("%s:%s", e.File, vErr.Error()))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Load reads a scenario from a YAML or JSON file. JSON is a subset of YAML,
+// so both formats go through the same decoder, which is what lets us report
+// line numbers for either.
+func Load(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(path, data)
+}
+
+// Parse decodes and validates a scenario, name is only used in error messages.
+func Parse(name string, data []byte) (*Scenario, error) {
+	var root yaml.Node
+
+	err := yaml.Unmarshal(data, &root)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	if len(root.Content) == 0 {
+		return nil, fmt.Errorf("%s: scenario is empty", name)
+	}
+
+	s := &Scenario{}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+
+	err = dec.Decode(s)
+	if err != nil {
+		var tErr *yaml.TypeError
+		if !errors.As(err, &tErr) {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		vErrs := &ValidationErrors{File: name}
+		for _, msg := range tErr.Errors {
+			vErrs.Errors = append(vErrs.Errors, typeError(msg))
+		}
+
+		return nil, vErrs
+	}
+
+	s.applyDefaults()
+
+	v := validator{root: root.Content[0]}
+	s.validate(&v)
+
+	if len(v.errs) > 0 {
+		return nil, &ValidationErrors{File: name, Errors: v.errs}
+	}
+
+	return s, nil
+}
+
+// yaml type errors look like "line 12: cannot unmarshal ..."
+func typeError(msg string) ValidationError {
+	rest, found := strings.CutPrefix(msg, "line ")
+	if !found {
+		return ValidationError{Message: msg}
+	}
+
+	lineStr, text, found := strings.Cut(rest, ": ")
+	if !found {
+		return ValidationError{Message: msg}
+	}
+
+	line, err := strconv.Atoi(lineStr)
+	if err != nil {
+		return ValidationError{Message: msg}
+	}
+
+	return ValidationError{Line: line, Column: 1, Message: text}
+}
+
+type validator struct {
+	root *yaml.Node
+	errs []ValidationError
+}
+
+// errorf records a problem with the value at path, path elements are mapping
+// keys (string) or sequence indexes (int).
+func (v *validator) errorf(path []any, format string, args ...any) {
+	line, column := position(v.root, path)
+
+	v.errs = append(v.errs, ValidationError{
+		Line:    line,
+		Column:  column,
+		Field:   fieldName(path),
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// position finds the node at path, falling back to the closest ancestor that
+// exists in the file so defaulted or missing fields still point somewhere useful.
+func position(node *yaml.Node, path []any) (int, int) {
+	for _, p := range path {
+		var next *yaml.Node
+
+		switch key := p.(type) {
+		case string:
+			if node.Kind != yaml.MappingNode {
+				break
+			}
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == key {
+					next = node.Content[i+1]
+					break
+				}
+			}
+		case int:
+			if node.Kind == yaml.SequenceNode && key < len(node.Content) {
+				next = node.Content[key]
+			}
+		}
+
+		if next == nil {
+			break
+		}
+		node = next
+	}
+
+	return node.Line, node.Column
+}
+
+func fieldName(path []any) string {
+	var sb strings.Builder
+
+	for _, p := range path {
+		switch key := p.(type) {
+		case string:
+			if sb.Len() > 0 {
+				sb.WriteByte('.')
+			}
+			sb.WriteString(key)
+		case int:
+			fmt.Fprintf(&sb, "[%d]", key)
+		}
+	}
+
+	return sb.String()
+}
+
+func (s *Scenario) validate(v *validator) {
+	if s.Tick < 0 {
+		v.errorf([]any{"tick"}, "must be positive, got %s", s.Tick)
+	}
+	if s.Duration < 0 {
+		v.errorf([]any{"duration"}, "must be positive, got %s", s.Duration)
+	}
+
+	if s.Arena.Right <= s.Arena.Left {
+		v.errorf([]any{"arena", "right"}, "must be greater than left (%g), got %g", s.Arena.Left, s.Arena.Right)
+	}
+	if s.Arena.Top <= s.Arena.Bottom {
+		v.errorf([]any{"arena", "top"}, "must be greater than bottom (%g), got %g", s.Arena.Bottom, s.Arena.Top)
+	}
+
+	switch s.Radio.Model {
+	case ModelDisk, ModelFreeSpace, ModelLogDistance, ModelTwoRayGround:
+	default:
+		v.errorf([]any{"radio", "model"}, "unknown propagation model %q, expected one of %s, %s, %s or %s", s.Radio.Model, ModelDisk, ModelFreeSpace, ModelLogDistance, ModelTwoRayGround)
+	}
+	switch s.Radio.Fading {
+	case FadingNone, FadingRayleigh, FadingRician:
+		if s.Radio.Fading != FadingNone && s.Radio.Model == ModelDisk {
+			v.errorf([]any{"radio", "fading"}, "fading needs a propagation model other than %s", ModelDisk)
+		}
+	default:
+		v.errorf([]any{"radio", "fading"}, "unknown fading model %q, expected one of %s, %s or %s", s.Radio.Fading, FadingNone, FadingRayleigh, FadingRician)
+	}
+
+	positive := []struct {
+		name  string
+		value float64
+	}{
+		{"frequency_hz", s.Radio.FrequencyHz},
+		{"path_loss_exponent", s.Radio.PathLossExponent},
+		{"reference_distance", s.Radio.ReferenceDistance},
+		{"antenna_height", s.Radio.AntennaHeight},
+	}
+	for _, p := range positive {
+		if p.value <= 0 {
+			v.errorf([]any{"radio", p.name}, "must be positive, got %g", p.value)
+		}
+	}
+	if s.Radio.ShadowingSigmaDB < 0 {
+		v.errorf([]any{"radio", "shadowing_sigma_db"}, "must not be negative, got %g", s.Radio.ShadowingSigmaDB)
+	}
+	if s.Radio.RicianK < 0 {
+		v.errorf([]any{"radio", "rician_k"}, "must not be negative, got %g", s.Radio.RicianK)
+	}
+
+	switch s.Radio.Loss {
+	case LossNone, LossLinkQuality:
+	case LossPERCurve:
+		if len(s.Radio.PERCurve) == 0 {
+			v.errorf([]any{"radio", "per_curve"}, "at least one point is required for loss %s", LossPERCurve)
+		}
+	default:
+		v.errorf([]any{"radio", "loss"}, "unknown loss model %q, expected one of %s, %s or %s", s.Radio.Loss, LossNone, LossLinkQuality, LossPERCurve)
+	}
+	for i, p := range s.Radio.PERCurve {
+		if p.Quality < 0 || p.Quality > 1 {
+			v.errorf([]any{"radio", "per_curve", i, "quality"}, "must be between 0 and 1, got %g", p.Quality)
+		}
+		if p.PER < 0 || p.PER > 1 {
+			v.errorf([]any{"radio", "per_curve", i, "per"}, "must be between 0 and 1, got %g", p.PER)
+		}
+		if i > 0 && p.Quality == s.Radio.PERCurve[i-1].Quality {
+			v.errorf([]any{"radio", "per_curve", i, "quality"}, "duplicate quality %g", p.Quality)
+		}
+	}
+	if s.Radio.ProcessingDelay < 0 {
+		v.errorf([]any{"radio", "processing_delay"}, "must not be negative, got %s", s.Radio.ProcessingDelay)
+	}
+	if s.Radio.Jitter < 0 {
+		v.errorf([]any{"radio", "jitter"}, "must not be negative, got %s", s.Radio.Jitter)
+	}
+	if *s.Radio.RetryLimit < 0 {
+		v.errorf([]any{"radio", "retry_limit"}, "must not be negative, got %d", *s.Radio.RetryLimit)
+	}
+
+	if s.Radio.SINR != nil {
+		if s.Radio.Model == ModelDisk {
+			v.errorf([]any{"radio", "sinr"}, "needs a propagation model other than %s", ModelDisk)
+		}
+		if s.MAC == nil {
+			v.errorf([]any{"radio", "sinr"}, "needs a mac section, without one transmissions never overlap")
+		}
+	}
+
+	if s.MAC != nil {
+		if s.MAC.BitrateBps <= 0 {
+			v.errorf([]any{"mac", "bitrate_bps"}, "must be positive, got %g", s.MAC.BitrateBps)
+		}
+		if s.MAC.HeaderBytes < 0 {
+			v.errorf([]any{"mac", "header_bytes"}, "must not be negative, got %d", s.MAC.HeaderBytes)
+		}
+		if s.MAC.SlotTime < 0 {
+			v.errorf([]any{"mac", "slot_time"}, "must be positive, got %s", s.MAC.SlotTime)
+		}
+		if s.MAC.DIFS < 0 {
+			v.errorf([]any{"mac", "difs"}, "must be positive, got %s", s.MAC.DIFS)
+		}
+		if s.MAC.CWMin < 0 {
+			v.errorf([]any{"mac", "cw_min"}, "must be positive, got %d", s.MAC.CWMin)
+		}
+		if s.MAC.CWMax < s.MAC.CWMin {
+			v.errorf([]any{"mac", "cw_max"}, "must be at least cw_min (%d), got %d", s.MAC.CWMin, s.MAC.CWMax)
+		}
+		if s.MAC.QueueLimit < 0 {
+			v.errorf([]any{"mac", "queue_limit"}, "must be positive, got %d", s.MAC.QueueLimit)
+		}
+	}
+
+	switch s.Routing {
+	case RoutingAODV, RoutingOLSR, RoutingDSR, RoutingGPSR, RoutingBATMAN, RoutingDTN:
+	default:
+		v.errorf([]any{"routing"}, "unknown routing protocol %q, expected one of %s, %s, %s, %s, %s or %s", s.Routing, RoutingAODV, RoutingOLSR, RoutingDSR, RoutingGPSR, RoutingBATMAN, RoutingDTN)
+	}
+	if s.PendingQueueLimit < 0 {
+		v.errorf([]any{"pending_queue_limit"}, "must be positive, got %d", s.PendingQueueLimit)
+	}
+	validateAODV(v, []any{"aodv"}, s.AODV)
+	validateOLSR(v, []any{"olsr"}, s.OLSR)
+	validateDSR(v, []any{"dsr"}, s.DSR)
+	validateGPSR(v, []any{"gpsr"}, s.GPSR)
+	validateBATMAN(v, []any{"batman"}, s.BATMAN)
+	validateDTN(v, []any{"dtn"}, s.DTN)
+	validateMulticast(v, []any{"multicast"}, s.Multicast)
+
+	if len(s.Drones) == 0 {
+		v.errorf([]any{"drones"}, "at least one drone is required")
+	}
+
+	ids := make(map[string]int)
+	for i, d := range s.Drones {
+		if d.ID == "" {
+			v.errorf([]any{"drones", i}, "id is required")
+		} else if first, exists := ids[d.ID]; exists {
+			v.errorf([]any{"drones", i, "id"}, "duplicate drone id %q, first used by drones[%d]", d.ID, first)
+		} else {
+			ids[d.ID] = i
+		}
+
+		if d.X < s.Arena.Left || d.X > s.Arena.Right {
+			v.errorf([]any{"drones", i, "x"}, "%g is outside the arena [%g, %g]", d.X, s.Arena.Left, s.Arena.Right)
+		}
+		if d.Y < s.Arena.Bottom || d.Y > s.Arena.Top {
+			v.errorf([]any{"drones", i, "y"}, "%g is outside the arena [%g, %g]", d.Y, s.Arena.Bottom, s.Arena.Top)
+		}
+		if d.TransmissionRange <= 0 {
+			v.errorf([]any{"drones", i, "transmission_range"}, "must be positive, got %g", d.TransmissionRange)
+		}
+		if d.AODV != nil {
+			validateAODV(v, []any{"drones", i, "aodv"}, *d.AODV)
+		}
+		if d.OLSR != nil {
+			validateOLSR(v, []any{"drones", i, "olsr"}, *d.OLSR)
+		}
+		if d.DSR != nil {
+			validateDSR(v, []any{"drones", i, "dsr"}, *d.DSR)
+		}
+		if d.GPSR != nil {
+			validateGPSR(v, []any{"drones", i, "gpsr"}, *d.GPSR)
+		}
+		if d.BATMAN != nil {
+			validateBATMAN(v, []any{"drones", i, "batman"}, *d.BATMAN)
+		}
+		if d.DTN != nil {
+			validateDTN(v, []any{"drones", i, "dtn"}, *d.DTN)
+		}
+		for j, group := range d.Groups {
+			if group == "" {
+				v.errorf([]any{"drones", i, "groups", j}, "must not be empty")
+			}
+		}
+	}
+
+	for i, t := range s.Traffic {
+		if t.At < 0 {
+			v.errorf([]any{"traffic", i, "at"}, "must not be negative, got %s", t.At)
+		}
+		if t.At > s.Duration {
+			v.errorf([]any{"traffic", i, "at"}, "%s is after the end of the scenario (%s)", t.At, s.Duration)
+		}
+
+		toGroup := false
+		switch t.Type {
+		case TrafficRREQ, TrafficData:
+		case TrafficControl:
+			if t.Command == "" {
+				v.errorf([]any{"traffic", i, "command"}, "is required for control traffic")
+			}
+		case TrafficJoin, TrafficLeave, TrafficMulticast:
+			toGroup = true
+			if t.Group == "" {
+				v.errorf([]any{"traffic", i, "group"}, "is required for %s traffic", t.Type)
+			}
+		default:
+			v.errorf([]any{"traffic", i, "type"}, "unknown traffic type %q, expected one of %s, %s, %s, %s, %s or %s", t.Type, TrafficRREQ, TrafficData, TrafficControl, TrafficJoin, TrafficLeave, TrafficMulticast)
+		}
+
+		if _, exists := ids[t.From]; !exists {
+			v.errorf([]any{"traffic", i, "from"}, "unknown drone %q", t.From)
+		}
+		if toGroup {
+			continue
+		}
+		if _, exists := ids[t.To]; !exists {
+			v.errorf([]any{"traffic", i, "to"}, "unknown drone %q", t.To)
+		} else if t.To == t.From {
+			v.errorf([]any{"traffic", i, "to"}, "drone %q cannot send traffic to itself", t.To)
+		}
+	}
+}
+
+// validateAODV checks an aodv section, zero means the default so only
+// negative values are wrong
+func validateAODV(v *validator, path []any, a AODVSpec) {
+	timers := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"active_route_timeout", a.ActiveRouteTimeout},
+		{"blacklist_timeout", a.BlacklistTimeout},
+		{"delete_period", a.DeletePeriod},
+		{"hello_interval", a.HelloInterval},
+		{"my_route_timeout", a.MyRouteTimeout},
+		{"next_hop_wait", a.NextHopWait},
+		{"node_traversal_time", a.NodeTraversalTime},
+		{"path_discovery_time", a.PathDiscoveryTime},
+		{"expiry_check_interval", a.ExpiryCheckInterval},
+		{"link_expiration_margin", deref(a.LinkExpirationMargin)},
+	}
+	for _, t := range timers {
+		if t.value < 0 {
+			v.errorf(append(path, t.name), "must be positive, got %s", t.value)
+		}
+	}
+
+	counts := []struct {
+		name  string
+		value int
+	}{
+		{"allowed_hello_loss", a.AllowedHelloLoss},
+		{"local_add_ttl", deref(a.LocalAddTTL)},
+		{"max_repair_ttl", deref(a.MaxRepairTTL)},
+		{"net_diameter", a.NetDiameter},
+		{"rerr_ratelimit", a.RERRRateLimit},
+		{"rreq_retries", deref(a.RREQRetries)},
+		{"rreq_ratelimit", a.RREQRateLimit},
+		{"timeout_buffer", deref(a.TimeoutBuffer)},
+		{"ttl_start", a.TTLStart},
+		{"ttl_increment", a.TTLIncrement},
+		{"ttl_threshold", a.TTLThreshold},
+		{"max_paths", a.MaxPaths},
+	}
+	for _, c := range counts {
+		if c.value < 0 {
+			v.errorf(append(path, c.name), "must be positive, got %d", c.value)
+		}
+	}
+}
+
+// deref is what p points at, zero if it is nil
+func deref[T any](p *T) T {
+	if p == nil {
+		var zero T
+		return zero
+	}
+	return *p
+}
+
+// validateOLSR checks an olsr section, zero timers mean the default
+func validateOLSR(v *validator, path []any, o OLSRSpec) {
+	timers := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"hello_interval", o.HelloInterval},
+		{"tc_interval", o.TCInterval},
+		{"neighb_hold_time", o.NeighbHoldTime},
+		{"top_hold_time", o.TopHoldTime},
+		{"dup_hold_time", o.DupHoldTime},
+		{"expiry_check_interval", o.ExpiryCheckInterval},
+	}
+	for _, t := range timers {
+		if t.value < 0 {
+			v.errorf(append(path, t.name), "must be positive, got %s", t.value)
+		}
+	}
+
+	if o.Willingness != nil && (*o.Willingness < 0 || *o.Willingness > 7) {
+		v.errorf(append(path, "willingness"), "must be between 0 and 7, got %d", *o.Willingness)
+	}
+}
+
+// validateDSR checks a dsr section, zero means the default so only negative
+// values are wrong
+func validateDSR(v *validator, path []any, d DSRSpec) {
+	timers := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"nonprop_request_timeout", d.NonpropRequestTimeout},
+		{"request_period", d.RequestPeriod},
+		{"max_request_period", d.MaxRequestPeriod},
+		{"route_cache_timeout", d.RouteCacheTimeout},
+		{"send_buffer_timeout", d.SendBufferTimeout},
+		{"expiry_check_interval", d.ExpiryCheckInterval},
+	}
+	for _, t := range timers {
+		if t.value < 0 {
+			v.errorf(append(path, t.name), "must be positive, got %s", t.value)
+		}
+	}
+
+	counts := []struct {
+		name  string
+		value int
+	}{
+		{"discovery_hop_limit", d.DiscoveryHopLimit},
+		{"max_request_rexmt", d.MaxRequestRexmt},
+		{"max_salvage_count", d.MaxSalvageCount},
+	}
+	for _, c := range counts {
+		if c.value < 0 {
+			v.errorf(append(path, c.name), "must be positive, got %d", c.value)
+		}
+	}
+}
+
+// validateGPSR checks a gpsr section, zero means the default so only
+// negative values are wrong
+func validateGPSR(v *validator, path []any, g GPSRSpec) {
+	timers := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"beacon_interval", g.BeaconInterval},
+		{"location_timeout", g.LocationTimeout},
+		{"query_timeout", g.QueryTimeout},
+		{"expiry_check_interval", g.ExpiryCheckInterval},
+	}
+	for _, t := range timers {
+		if t.value < 0 {
+			v.errorf(append(path, t.name), "must be positive, got %s", t.value)
+		}
+	}
+
+	counts := []struct {
+		name  string
+		value int
+	}{
+		{"allowed_beacon_loss", g.AllowedBeaconLoss},
+		{"max_hops", g.MaxHops},
+		{"query_ttl", g.QueryTTL},
+		{"query_retries", g.QueryRetries},
+	}
+	for _, c := range counts {
+		if c.value < 0 {
+			v.errorf(append(path, c.name), "must be positive, got %d", c.value)
+		}
+	}
+}
+
+// validateBATMAN checks a batman section, zero means the default so only
+// negative values are wrong
+func validateBATMAN(v *validator, path []any, b BATMANSpec) {
+	timers := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"originator_interval", b.OriginatorInterval},
+		{"purge_timeout", b.PurgeTimeout},
+		{"expiry_check_interval", b.ExpiryCheckInterval},
+	}
+	for _, t := range timers {
+		if t.value < 0 {
+			v.errorf(append(path, t.name), "must be positive, got %s", t.value)
+		}
+	}
+
+	counts := []struct {
+		name  string
+		value int
+	}{
+		{"ttl", b.TTL},
+		{"window_size", b.WindowSize},
+		{"bidirect_timeout", b.BidirectTimeout},
+	}
+	for _, c := range counts {
+		if c.value < 0 {
+			v.errorf(append(path, c.name), "must be positive, got %d", c.value)
+		}
+	}
+}
+
+// validateDTN checks a dtn section, zero means the default so only negative
+// values are wrong, and the PRoPHET parameters are probabilities
+func validateDTN(v *validator, path []any, d DTNSpec) {
+	switch d.Mode {
+	case "", DTNEpidemic, DTNSprayAndWait, DTNProphet:
+	default:
+		v.errorf(append(path, "mode"), "unknown mode %q, expected one of %s, %s or %s", d.Mode, DTNEpidemic, DTNSprayAndWait, DTNProphet)
+	}
+
+	timers := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"hello_interval", d.HelloInterval},
+		{"summary_interval", d.SummaryInterval},
+		{"message_lifetime", d.MessageLifetime},
+		{"aging_unit", d.AgingUnit},
+		{"expiry_check_interval", d.ExpiryCheckInterval},
+	}
+	for _, t := range timers {
+		if t.value < 0 {
+			v.errorf(append(path, t.name), "must be positive, got %s", t.value)
+		}
+	}
+
+	counts := []struct {
+		name  string
+		value int
+	}{
+		{"allowed_hello_loss", d.AllowedHelloLoss},
+		{"buffer_size", d.BufferSize},
+		{"copies", d.Copies},
+	}
+	for _, c := range counts {
+		if c.value < 0 {
+			v.errorf(append(path, c.name), "must be positive, got %d", c.value)
+		}
+	}
+
+	probabilities := []struct {
+		name  string
+		value float64
+	}{
+		{"p_init", d.PInit},
+		{"beta", d.Beta},
+		{"gamma", d.Gamma},
+	}
+	for _, p := range probabilities {
+		if p.value < 0 || p.value > 1 {
+			v.errorf(append(path, p.name), "must be between 0 and 1, got %g", p.value)
+		}
+	}
+}
+
+// validateMulticast checks the multicast section, zero means the default
+func validateMulticast(v *validator, path []any, m MulticastSpec) {
+	if m.AnnounceInterval < 0 {
+		v.errorf(append(path, "announce_interval"), "must be positive, got %s", m.AnnounceInterval)
+	}
+	if m.MemberTimeout < 0 {
+		v.errorf(append(path, "member_timeout"), "must be positive, got %s", m.MemberTimeout)
+	}
+	if m.TTL < 0 {
+		v.errorf(append(path, "ttl"), "must be positive, got %d", m.TTL)
+	}
+	if m.DupHoldTime < 0 {
+		v.errorf(append(path, "dup_hold_time"), "must be positive, got %s", m.DupHoldTime)
+	}
+}
@@ -0,0 +1,222 @@
+package scenario
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		data string
+	}{
+		{
+			name: "yaml",
+			file: "line.yaml",
+			data: `name: line
+tick: 50ms
+arena: {right: 10, top: 10}
+routing: dtn
+dtn: {mode: prophet, p_init: 0.75}
+drones:
+  - {id: a, x: 1, y: 1, transmission_range: 5}
+  - {id: b, x: 6, y: 1, transmission_range: 5}
+traffic:
+  - {at: 1s, type: data, from: a, to: b, data: hi}
+`,
+		},
+		{
+			name: "json",
+			file: "line.json",
+			data: `{
+  "name": "line",
+  "tick": "50ms",
+  "arena": {"right": 10, "top": 10},
+  "routing": "dtn",
+  "dtn": {"mode": "prophet", "p_init": 0.75},
+  "drones": [
+    {"id": "a", "x": 1, "y": 1, "transmission_range": 5},
+    {"id": "b", "x": 6, "y": 1, "transmission_range": 5}
+  ],
+  "traffic": [
+    {"at": "1s", "type": "data", "from": "a", "to": "b", "data": "hi"}
+  ]
+}
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse(tt.file, []byte(tt.data))
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+
+			if s.Name != "line" || s.Tick != 50*time.Millisecond || s.Routing != RoutingDTN {
+				t.Errorf("got name %q, tick %s, routing %q", s.Name, s.Tick, s.Routing)
+			}
+			if s.DTN.Mode != DTNProphet || s.DTN.PInit != 0.75 {
+				t.Errorf("got dtn mode %q, p_init %g", s.DTN.Mode, s.DTN.PInit)
+			}
+			if len(s.Drones) != 2 || s.Drones[1].X != 6 {
+				t.Errorf("got drones %+v", s.Drones)
+			}
+			if len(s.Traffic) != 1 || s.Traffic[0].At != time.Second || s.Traffic[0].To != "b" {
+				t.Errorf("got traffic %+v", s.Traffic)
+			}
+
+			// left out, so defaulted
+			if s.Duration != DefaultDuration || s.Radio.Model != ModelDisk {
+				t.Errorf("got duration %s, radio model %q", s.Duration, s.Radio.Model)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		errors []string
+	}{
+		{
+			name: "unknown key",
+			data: `arena: {right: 10, top: 10}
+colour: red
+drones:
+  - {id: a, x: 1, y: 1, transmission_range: 5}
+`,
+			errors: []string{"2:1: field colour not found in type scenario.Scenario"},
+		},
+		{
+			name: "unknown drone key",
+			data: `arena: {right: 10, top: 10}
+drones:
+  - {id: a, x: 1, y: 1, z: 1, transmission_range: 5}
+`,
+			errors: []string{"3:1: field z not found in type scenario.DroneSpec"},
+		},
+		{
+			name: "negative values",
+			data: `tick: -1s
+arena: {right: 10, top: 10}
+pending_queue_limit: -1
+aodv:
+  hello_interval: -1s
+  rreq_retries: -2
+drones:
+  - {id: a, x: 1, y: 1, transmission_range: -5}
+`,
+			errors: []string{
+				"1:7: tick: must be positive, got -1s",
+				"3:22: pending_queue_limit: must be positive, got -1",
+				"5:19: aodv.hello_interval: must be positive, got -1s",
+				"6:17: aodv.rreq_retries: must be positive, got -2",
+				"8:45: drones[0].transmission_range: must be positive, got -5",
+			},
+		},
+		{
+			name: "dtn probabilities out of range",
+			data: `arena: {right: 10, top: 10}
+routing: dtn
+dtn:
+  p_init: 1.5
+  beta: -0.25
+  gamma: 1
+drones:
+  - {id: a, x: 1, y: 1, transmission_range: 5, dtn: {gamma: 2}}
+`,
+			errors: []string{
+				"4:11: dtn.p_init: must be between 0 and 1, got 1.5",
+				"5:9: dtn.beta: must be between 0 and 1, got -0.25",
+				"8:53: drones[0].dtn.p_init: must be between 0 and 1, got 1.5",
+				"8:53: drones[0].dtn.beta: must be between 0 and 1, got -0.25",
+				"8:61: drones[0].dtn.gamma: must be between 0 and 1, got 2",
+			},
+		},
+		{
+			// the drone's aodv section inherits the bad value, so it is
+			// reported there as well, at the section
+			name: "inherited section",
+			data: `arena: {right: 10, top: 10}
+aodv:
+  net_diameter: -1
+drones:
+  - id: a
+    x: 1
+    y: 1
+    transmission_range: 5
+    aodv:
+      hello_interval: 2s
+  - {id: b, x: 2, y: 1, transmission_range: 5}
+`,
+			errors: []string{
+				"3:17: aodv.net_diameter: must be positive, got -1",
+				"10:7: drones[0].aodv.net_diameter: must be positive, got -1",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse("test.yaml", []byte(tt.data))
+
+			var vErrs *ValidationErrors
+			if !errors.As(err, &vErrs) {
+				t.Fatalf("Parse error %v, want ValidationErrors", err)
+			}
+
+			var got []string
+			for _, vErr := range vErrs.Errors {
+				got = append(got, vErr.Error())
+			}
+			if !slices.Equal(got, tt.errors) {
+				t.Errorf("errors\n%q\nwant\n%q", got, tt.errors)
+			}
+		})
+	}
+}
+
+func TestInheritFields(t *testing.T) {
+	retries, inherited := 0, 2
+	tests := []struct {
+		name  string
+		drone AODVSpec
+		from  AODVSpec
+		want  AODVSpec
+	}{
+		{
+			name:  "unset fields inherited",
+			drone: AODVSpec{HelloInterval: 2 * time.Second},
+			from:  AODVSpec{HelloInterval: time.Second, NetDiameter: 10},
+			want:  AODVSpec{HelloInterval: 2 * time.Second, NetDiameter: 10},
+		},
+		{
+			name:  "pointer set to zero kept",
+			drone: AODVSpec{RREQRetries: &retries},
+			from:  AODVSpec{RREQRetries: &inherited, TTLStart: 3},
+			want:  AODVSpec{RREQRetries: &retries, TTLStart: 3},
+		},
+		{
+			name:  "nothing to inherit",
+			drone: AODVSpec{TTLStart: 2},
+			from:  AODVSpec{},
+			want:  AODVSpec{TTLStart: 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inheritFields(&tt.drone, tt.from)
+
+			if tt.drone.HelloInterval != tt.want.HelloInterval || tt.drone.NetDiameter != tt.want.NetDiameter ||
+				tt.drone.TTLStart != tt.want.TTLStart || tt.drone.RREQRetries != tt.want.RREQRetries {
+				t.Errorf("got %+v, want %+v", tt.drone, tt.want)
+			}
+		})
+	}
+}
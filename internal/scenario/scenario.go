@@ -0,0 +1,465 @@
+package scenario
+
+import (
+	"reflect"
+	"time"
+)
+
+// A Scenario describes everything needed to run a simulation: the arena the
+// drones fly in, the drones themselves, the protocol timers and the traffic
+// that is injected while the simulation runs.
+type Scenario struct {
+	Name     string        `yaml:"name"`
+	Seed     int64         `yaml:"seed"`
+	Tick     time.Duration `yaml:"tick"`
+	Duration time.Duration `yaml:"duration"`
+	Arena    Arena         `yaml:"arena"`
+	Radio    RadioSpec     `yaml:"radio"`
+	MAC      *MACSpec      `yaml:"mac"`
+	Routing  string        `yaml:"routing"`
+	// PendingQueueLimit is how many packets per destination a drone holds
+	// while it waits for a route, 64 if unset
+	PendingQueueLimit int           `yaml:"pending_queue_limit"`
+	AODV              AODVSpec      `yaml:"aodv"`
+	OLSR              OLSRSpec      `yaml:"olsr"`
+	DSR               DSRSpec       `yaml:"dsr"`
+	GPSR              GPSRSpec      `yaml:"gpsr"`
+	BATMAN            BATMANSpec    `yaml:"batman"`
+	DTN               DTNSpec       `yaml:"dtn"`
+	Multicast         MulticastSpec `yaml:"multicast"`
+	Drones            []DroneSpec   `yaml:"drones"`
+	Traffic           []TrafficSpec `yaml:"traffic"`
+}
+
+type Arena struct {
+	Left   float64 `yaml:"left"`
+	Right  float64 `yaml:"right"`
+	Bottom float64 `yaml:"bottom"`
+	Top    float64 `yaml:"top"`
+}
+
+// Propagation models understood by RadioSpec.Model
+const (
+	ModelDisk         = "disk"
+	ModelFreeSpace    = "free_space"
+	ModelLogDistance  = "log_distance"
+	ModelTwoRayGround = "two_ray_ground"
+)
+
+// Fading models understood by RadioSpec.Fading
+const (
+	FadingNone     = "none"
+	FadingRayleigh = "rayleigh"
+	FadingRician   = "rician"
+)
+
+// A RadioSpec selects the propagation model. With the disk model a drone
+// hears everything within its transmission_range, the other models compute
+// received power and compare it against sensitivity_dbm. Unless
+// tx_power_dbm is given, each drone's transmit power is calibrated so the
+// mean received power at its transmission_range equals the sensitivity.
+//
+// Frames that arrive can still be lost, with a probability taken from the
+// link quality or a PER curve, and are delayed by the propagation time plus
+// processing_delay and up to jitter.
+type RadioSpec struct {
+	Model             string   `yaml:"model"`
+	Fading            string   `yaml:"fading"`
+	FrequencyHz       float64  `yaml:"frequency_hz"`
+	TxPowerDBm        *float64 `yaml:"tx_power_dbm"`
+	SensitivityDBm    float64  `yaml:"sensitivity_dbm"`
+	PathLossExponent  float64  `yaml:"path_loss_exponent"`
+	ReferenceDistance float64  `yaml:"reference_distance"`
+	ShadowingSigmaDB  float64  `yaml:"shadowing_sigma_db"`
+	AntennaHeight     float64  `yaml:"antenna_height"`
+	RicianK           float64  `yaml:"rician_k"`
+
+	Loss            string        `yaml:"loss"`
+	PERCurve        []PERPoint    `yaml:"per_curve"`
+	ProcessingDelay time.Duration `yaml:"processing_delay"`
+	Jitter          time.Duration `yaml:"jitter"`
+	// RetryLimit is how often a unicast frame is resent before the link
+	// counts as broken
+	RetryLimit *int `yaml:"retry_limit"`
+
+	SINR *SINRSpec `yaml:"sinr"`
+}
+
+// A SINRSpec switches reception from "any overlap collides" to an SINR
+// threshold with interference summed over concurrent transmissions. It needs
+// a propagation model other than disk and a mac section.
+type SINRSpec struct {
+	ThresholdDB     float64  `yaml:"threshold_db"`
+	NoiseFloorDBm   float64  `yaml:"noise_floor_dbm"`
+	CarrierSenseDBm *float64 `yaml:"carrier_sense_dbm"`
+}
+
+// Loss models understood by RadioSpec.Loss
+const (
+	LossNone        = "none"
+	LossLinkQuality = "link_quality"
+	LossPERCurve    = "per_curve"
+)
+
+// PERPoint is a point on a packet error rate curve, link quality runs from 0
+// at the edge of a drone's transmission_range to 1 on top of it.
+type PERPoint struct {
+	Quality float64 `yaml:"quality"`
+	PER     float64 `yaml:"per"`
+}
+
+// A MACSpec makes the drones share the medium with CSMA/CA, leaving the
+// section out gives the air unlimited capacity.
+type MACSpec struct {
+	BitrateBps  float64       `yaml:"bitrate_bps"`
+	HeaderBytes int           `yaml:"header_bytes"`
+	SlotTime    time.Duration `yaml:"slot_time"`
+	DIFS        time.Duration `yaml:"difs"`
+	CWMin       int           `yaml:"cw_min"`
+	CWMax       int           `yaml:"cw_max"`
+	QueueLimit  int           `yaml:"queue_limit"`
+}
+
+// Routing protocols understood by Scenario.Routing, every drone runs the same
+// one so protocols can be compared on identical mobility and traffic
+const (
+	RoutingAODV   = "aodv"
+	RoutingOLSR   = "olsr"
+	RoutingDSR    = "dsr"
+	RoutingGPSR   = "gpsr"
+	RoutingBATMAN = "batman"
+	RoutingDTN    = "dtn"
+)
+
+// An AODVSpec sets the AODV protocol parameters of RFC3561 section 10,
+// anything left out takes the RFC's default, 3s for active_route_timeout
+// and 5.6s for path_discovery_time. A drone's own aodv section overrides
+// the scenario's field by field. The parameters that can be zero
+// and the switches are pointers, so zero and false can be given.
+type AODVSpec struct {
+	ActiveRouteTimeout  time.Duration `yaml:"active_route_timeout"`
+	AllowedHelloLoss    int           `yaml:"allowed_hello_loss"`
+	BlacklistTimeout    time.Duration `yaml:"blacklist_timeout"`
+	DeletePeriod        time.Duration `yaml:"delete_period"`
+	HelloInterval       time.Duration `yaml:"hello_interval"`
+	LocalAddTTL         *int          `yaml:"local_add_ttl"`
+	MaxRepairTTL        *int          `yaml:"max_repair_ttl"`
+	MyRouteTimeout      time.Duration `yaml:"my_route_timeout"`
+	NetDiameter         int           `yaml:"net_diameter"`
+	NextHopWait         time.Duration `yaml:"next_hop_wait"`
+	NodeTraversalTime   time.Duration `yaml:"node_traversal_time"`
+	PathDiscoveryTime   time.Duration `yaml:"path_discovery_time"`
+	RERRRateLimit       int           `yaml:"rerr_ratelimit"`
+	RREQRetries         *int          `yaml:"rreq_retries"`
+	RREQRateLimit       int           `yaml:"rreq_ratelimit"`
+	TimeoutBuffer       *int          `yaml:"timeout_buffer"`
+	TTLStart            int           `yaml:"ttl_start"`
+	TTLIncrement        int           `yaml:"ttl_increment"`
+	TTLThreshold        int           `yaml:"ttl_threshold"`
+	ExpiryCheckInterval time.Duration `yaml:"expiry_check_interval"`
+	Gratuitous          *bool         `yaml:"gratuitous"`
+	DestinationOnly     *bool         `yaml:"destination_only"`
+	RREPAck             *bool         `yaml:"rrep_ack"`
+	ETX                 *bool         `yaml:"etx"`
+	// LinkExpiration has routes expire before their links are predicted to
+	// break as the drones fly apart, LinkExpirationMargin before
+	LinkExpiration       *bool          `yaml:"link_expiration"`
+	LinkExpirationMargin *time.Duration `yaml:"link_expiration_margin"`
+	// Multipath keeps up to MaxPaths link-disjoint paths per route (AOMDV),
+	// LoadBalance spreads DATA packets over them
+	Multipath   *bool `yaml:"multipath"`
+	MaxPaths    int   `yaml:"max_paths"`
+	LoadBalance *bool `yaml:"load_balance"`
+}
+
+// An OLSRSpec sets the OLSR parameters of RFC3626 section 18, anything left
+// out takes the RFC's default. Willingness runs from 0, never relay for
+// others, to 7, always relay. A drone's own olsr section overrides the
+// scenario's field by field.
+type OLSRSpec struct {
+	HelloInterval       time.Duration `yaml:"hello_interval"`
+	TCInterval          time.Duration `yaml:"tc_interval"`
+	NeighbHoldTime      time.Duration `yaml:"neighb_hold_time"`
+	TopHoldTime         time.Duration `yaml:"top_hold_time"`
+	DupHoldTime         time.Duration `yaml:"dup_hold_time"`
+	Willingness         *int          `yaml:"willingness"`
+	ExpiryCheckInterval time.Duration `yaml:"expiry_check_interval"`
+}
+
+// A DSRSpec sets the DSR parameters of RFC4728 section 9, anything left out
+// takes the RFC's default. A drone's own dsr section overrides the
+// scenario's field by field.
+type DSRSpec struct {
+	DiscoveryHopLimit     int           `yaml:"discovery_hop_limit"`
+	NonpropRequestTimeout time.Duration `yaml:"nonprop_request_timeout"`
+	RequestPeriod         time.Duration `yaml:"request_period"`
+	MaxRequestPeriod      time.Duration `yaml:"max_request_period"`
+	MaxRequestRexmt       int           `yaml:"max_request_rexmt"`
+	RouteCacheTimeout     time.Duration `yaml:"route_cache_timeout"`
+	MaxSalvageCount       int           `yaml:"max_salvage_count"`
+	SendBufferTimeout     time.Duration `yaml:"send_buffer_timeout"`
+	ExpiryCheckInterval   time.Duration `yaml:"expiry_check_interval"`
+}
+
+// A GPSRSpec sets the GPSR beacon and location service parameters, anything
+// left out takes its default. A drone's own gpsr section overrides the
+// scenario's field by field.
+type GPSRSpec struct {
+	BeaconInterval      time.Duration `yaml:"beacon_interval"`
+	AllowedBeaconLoss   int           `yaml:"allowed_beacon_loss"`
+	MaxHops             int           `yaml:"max_hops"`
+	LocationTimeout     time.Duration `yaml:"location_timeout"`
+	QueryTTL            int           `yaml:"query_ttl"`
+	QueryTimeout        time.Duration `yaml:"query_timeout"`
+	QueryRetries        int           `yaml:"query_retries"`
+	ExpiryCheckInterval time.Duration `yaml:"expiry_check_interval"`
+}
+
+// A BATMANSpec sets the B.A.T.M.A.N. originator message parameters, anything
+// left out takes its default. A drone's own batman section overrides the
+// scenario's field by field.
+type BATMANSpec struct {
+	OriginatorInterval  time.Duration `yaml:"originator_interval"`
+	TTL                 int           `yaml:"ttl"`
+	WindowSize          int           `yaml:"window_size"`
+	BidirectTimeout     int           `yaml:"bidirect_timeout"`
+	PurgeTimeout        time.Duration `yaml:"purge_timeout"`
+	ExpiryCheckInterval time.Duration `yaml:"expiry_check_interval"`
+}
+
+// Delay tolerant routing modes understood by DTNSpec.Mode
+const (
+	DTNEpidemic     = "epidemic"
+	DTNSprayAndWait = "spray_and_wait"
+	DTNProphet      = "prophet"
+)
+
+// A DTNSpec sets the delay tolerant routing mode and its parameters,
+// anything left out takes its default. A drone's own dtn section overrides
+// the scenario's field by field.
+type DTNSpec struct {
+	// Mode is epidemic, spray_and_wait or prophet, epidemic if unset
+	Mode                string        `yaml:"mode"`
+	HelloInterval       time.Duration `yaml:"hello_interval"`
+	AllowedHelloLoss    int           `yaml:"allowed_hello_loss"`
+	SummaryInterval     time.Duration `yaml:"summary_interval"`
+	BufferSize          int           `yaml:"buffer_size"`
+	MessageLifetime     time.Duration `yaml:"message_lifetime"`
+	Copies              int           `yaml:"copies"`
+	PInit               float64       `yaml:"p_init"`
+	Beta                float64       `yaml:"beta"`
+	Gamma               float64       `yaml:"gamma"`
+	AgingUnit           time.Duration `yaml:"aging_unit"`
+	ExpiryCheckInterval time.Duration `yaml:"expiry_check_interval"`
+}
+
+// A MulticastSpec sets how multicast group members announce themselves and
+// how far group traffic travels, anything left out takes its default
+type MulticastSpec struct {
+	AnnounceInterval time.Duration `yaml:"announce_interval"`
+	MemberTimeout    time.Duration `yaml:"member_timeout"`
+	TTL              int           `yaml:"ttl"`
+	DupHoldTime      time.Duration `yaml:"dup_hold_time"`
+}
+
+// inheritFields fills the fields a drone's protocol section leaves unset, the
+// zero ones, from the same fields of the scenario's section
+func inheritFields[T any](to *T, from T) {
+	v := reflect.ValueOf(to).Elem()
+	f := reflect.ValueOf(from)
+
+	for i := 0; i < v.NumField(); i++ {
+		if v.Field(i).IsZero() {
+			v.Field(i).Set(f.Field(i))
+		}
+	}
+}
+
+type DroneSpec struct {
+	ID                string      `yaml:"id"`
+	X                 float64     `yaml:"x"`
+	Y                 float64     `yaml:"y"`
+	VX                float64     `yaml:"vx"`
+	VY                float64     `yaml:"vy"`
+	TransmissionRange float64     `yaml:"transmission_range"`
+	AODV              *AODVSpec   `yaml:"aodv"`
+	OLSR              *OLSRSpec   `yaml:"olsr"`
+	DSR               *DSRSpec    `yaml:"dsr"`
+	GPSR              *GPSRSpec   `yaml:"gpsr"`
+	BATMAN            *BATMANSpec `yaml:"batman"`
+	DTN               *DTNSpec    `yaml:"dtn"`
+	// Groups are the multicast groups the drone starts out in
+	Groups []string `yaml:"groups"`
+}
+
+// Traffic types understood by TrafficSpec.Type
+const (
+	TrafficRREQ    = "rreq"
+	TrafficData    = "data"
+	TrafficControl = "control"
+	// multicast traffic names a group rather than a drone to send to
+	TrafficJoin      = "join"
+	TrafficLeave     = "leave"
+	TrafficMulticast = "multicast"
+)
+
+// A TrafficSpec is a single message injected by drone From at time At.
+type TrafficSpec struct {
+	At      time.Duration     `yaml:"at"`
+	Type    string            `yaml:"type"`
+	From    string            `yaml:"from"`
+	To      string            `yaml:"to"`
+	Data    string            `yaml:"data"`
+	Command string            `yaml:"command"`
+	Params  map[string]string `yaml:"params"`
+	Group   string            `yaml:"group"`
+}
+
+const (
+	DefaultSeed              = 1
+	DefaultTick              = 100 * time.Millisecond
+	DefaultDuration          = 60 * time.Second
+	DefaultFrequencyHz       = 2.4e9
+	DefaultSensitivityDBm    = -90
+	DefaultPathLossExponent  = 2.7
+	DefaultReferenceDistance = 1
+	DefaultAntennaHeight     = 1.5
+	DefaultRicianK           = 4
+	DefaultRetryLimit        = 3
+	DefaultSINRThresholdDB   = 10
+	DefaultNoiseFloorDBm     = -100
+	DefaultBitrateBps        = 1e6
+	DefaultHeaderBytes       = 52
+	DefaultSlotTime          = 20 * time.Microsecond
+	DefaultDIFS              = 50 * time.Microsecond
+	DefaultCWMin             = 31
+	DefaultCWMax             = 1023
+	DefaultQueueLimit        = 256
+)
+
+// Default returns the five drone line scenario that swarm run uses when no
+// scenario file is given.
+func Default() *Scenario {
+	s := &Scenario{
+		Name:  "default",
+		Arena: Arena{Left: 0, Right: 550, Bottom: 0, Top: 550},
+		Drones: []DroneSpec{
+			{ID: "1", X: 1, Y: 50, VX: 0.1, VY: 0, TransmissionRange: 1},
+			{ID: "2", X: 2, Y: 50, VX: 0, VY: 0, TransmissionRange: 1},
+			{ID: "3", X: 3, Y: 50, VX: 0, VY: 0, TransmissionRange: 1},
+			{ID: "4", X: 4, Y: 50, VX: 0, VY: 0, TransmissionRange: 1},
+			{ID: "5", X: 5, Y: 50, VX: 0, VY: 0, TransmissionRange: 1},
+		},
+		Traffic: []TrafficSpec{
+			{At: 0, Type: TrafficRREQ, From: "1", To: "5"},
+			{At: 3 * time.Second, Type: TrafficData, From: "1", To: "5", Data: "Hello"},
+			{At: 3 * time.Second, Type: TrafficControl, From: "1", To: "5", Command: "move", Params: map[string]string{"x": "2", "y": "1"}},
+		},
+	}
+	s.applyDefaults()
+
+	return s
+}
+
+// fill in anything left unset by the scenario file
+func (s *Scenario) applyDefaults() {
+	if s.Seed == 0 {
+		s.Seed = DefaultSeed
+	}
+	if s.Tick == 0 {
+		s.Tick = DefaultTick
+	}
+	if s.Duration == 0 {
+		s.Duration = DefaultDuration
+	}
+	if s.Routing == "" {
+		s.Routing = RoutingAODV
+	}
+	if s.Radio.Model == "" {
+		s.Radio.Model = ModelDisk
+	}
+	if s.Radio.Fading == "" {
+		s.Radio.Fading = FadingNone
+	}
+	if s.Radio.FrequencyHz == 0 {
+		s.Radio.FrequencyHz = DefaultFrequencyHz
+	}
+	if s.Radio.SensitivityDBm == 0 {
+		s.Radio.SensitivityDBm = DefaultSensitivityDBm
+	}
+	if s.Radio.PathLossExponent == 0 {
+		s.Radio.PathLossExponent = DefaultPathLossExponent
+	}
+	if s.Radio.ReferenceDistance == 0 {
+		s.Radio.ReferenceDistance = DefaultReferenceDistance
+	}
+	if s.Radio.AntennaHeight == 0 {
+		s.Radio.AntennaHeight = DefaultAntennaHeight
+	}
+	if s.Radio.Loss == "" {
+		s.Radio.Loss = LossNone
+	}
+	if s.Radio.Fading == FadingRician && s.Radio.RicianK == 0 {
+		s.Radio.RicianK = DefaultRicianK
+	}
+	if s.Radio.RetryLimit == nil {
+		retryLimit := DefaultRetryLimit
+		s.Radio.RetryLimit = &retryLimit
+	}
+	if s.Radio.SINR != nil {
+		if s.Radio.SINR.ThresholdDB == 0 {
+			s.Radio.SINR.ThresholdDB = DefaultSINRThresholdDB
+		}
+		if s.Radio.SINR.NoiseFloorDBm == 0 {
+			s.Radio.SINR.NoiseFloorDBm = DefaultNoiseFloorDBm
+		}
+		if s.Radio.SINR.CarrierSenseDBm == nil {
+			// sense anything strong enough to decode
+			cs := s.Radio.SensitivityDBm
+			s.Radio.SINR.CarrierSenseDBm = &cs
+		}
+	}
+	if s.MAC != nil {
+		if s.MAC.BitrateBps == 0 {
+			s.MAC.BitrateBps = DefaultBitrateBps
+		}
+		if s.MAC.HeaderBytes == 0 {
+			s.MAC.HeaderBytes = DefaultHeaderBytes
+		}
+		if s.MAC.SlotTime == 0 {
+			s.MAC.SlotTime = DefaultSlotTime
+		}
+		if s.MAC.DIFS == 0 {
+			s.MAC.DIFS = DefaultDIFS
+		}
+		if s.MAC.CWMin == 0 {
+			s.MAC.CWMin = DefaultCWMin
+		}
+		if s.MAC.CWMax == 0 {
+			s.MAC.CWMax = DefaultCWMax
+		}
+		if s.MAC.QueueLimit == 0 {
+			s.MAC.QueueLimit = DefaultQueueLimit
+		}
+	}
+	for i := range s.Drones {
+		if s.Drones[i].AODV != nil {
+			inheritFields(s.Drones[i].AODV, s.AODV)
+		}
+		if s.Drones[i].OLSR != nil {
+			inheritFields(s.Drones[i].OLSR, s.OLSR)
+		}
+		if s.Drones[i].DSR != nil {
+			inheritFields(s.Drones[i].DSR, s.DSR)
+		}
+		if s.Drones[i].GPSR != nil {
+			inheritFields(s.Drones[i].GPSR, s.GPSR)
+		}
+		if s.Drones[i].BATMAN != nil {
+			inheritFields(s.Drones[i].BATMAN, s.BATMAN)
+		}
+		if s.Drones[i].DTN != nil {
+			inheritFields(s.Drones[i].DTN, s.DTN)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package sim
+
+// A Queue holds the frames the drones transmit while an event runs until the
+// radio picks them up after it. It grows as needed, a single event can send
+// any number of frames.
+type Queue struct {
+	frames [][]byte
+}
+
+func NewQueue() *Queue {
+	return &Queue{}
+}
+
+// Push adds a frame to the back of the queue
+func (q *Queue) Push(frame []byte) {
+	q.frames = append(q.frames, frame)
+}
+
+// Pop takes the frame at the front of the queue, false if it is empty
+func (q *Queue) Pop() ([]byte, bool) {
+	if len(q.frames) == 0 {
+		return nil, false
+	}
+
+	frame := q.frames[0]
+	q.frames[0] = nil
+	q.frames = q.frames[1:]
+
+	return frame, true
+}
+
+// Len is how many frames are waiting
+func (q *Queue) Len() int {
+	return len(q.frames)
+}
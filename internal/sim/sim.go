@@ -0,0 +1,209 @@
+package sim
+
+import (
+	"container/heap"
+	"fmt"
+	"io"
+	"math/rand"
+	"time"
+)
+
+// Epoch is the wall clock time that virtual time zero maps to, it is fixed so
+// that route expirations and traces are identical between runs.
+var Epoch = time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// A Clock tells the protocol layers what time it is, in a simulation this is
+// the virtual clock of the Scheduler rather than the wall clock.
+type Clock interface {
+	Now() time.Time
+}
+
+// A Timer is a Clock that can also run a callback later, for protocol timers
+// like retransmissions.
+type Timer interface {
+	Clock
+	After(delay time.Duration, fn func()) *Event
+}
+
+// An Event is a callback scheduled to run at a point in virtual time.
+type Event struct {
+	at        time.Duration
+	seq       uint64
+	fn        func()
+	cancelled bool
+}
+
+// Cancel stops the event from running, cancelling an event that has already
+// run does nothing.
+func (e *Event) Cancel() {
+	e.cancelled = true
+}
+
+// A Ticker runs a callback repeatedly until it is stopped.
+type Ticker struct {
+	next    *Event
+	stopped bool
+}
+
+func (t *Ticker) Stop() {
+	t.stopped = true
+	if t.next != nil {
+		t.next.Cancel()
+	}
+}
+
+// Scheduler is a discrete-event simulation kernel. Everything in a simulation
+// happens inside an event popped off a single priority queue, ordered by
+// virtual time and then by the order the events were scheduled in, so a run
+// is fully determined by its inputs and the seed of Rand.
+type Scheduler struct {
+	Rand *rand.Rand
+
+	now        time.Duration
+	seq        uint64
+	queue      eventQueue
+	stopped    bool
+	afterEvent []func()
+}
+
+func NewScheduler(seed int64) *Scheduler {
+	return &Scheduler{
+		Rand: rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Now returns the current virtual time as a wall clock time.
+func (s *Scheduler) Now() time.Time {
+	return Epoch.Add(s.now)
+}
+
+// Elapsed returns the virtual time since the start of the simulation.
+func (s *Scheduler) Elapsed() time.Duration {
+	return s.now
+}
+
+// At schedules fn to run at virtual time at, times in the past run as soon as
+// the events already due have been processed.
+func (s *Scheduler) At(at time.Duration, fn func()) *Event {
+	if at < s.now {
+		at = s.now
+	}
+
+	s.seq++
+	e := &Event{at: at, seq: s.seq, fn: fn}
+	heap.Push(&s.queue, e)
+
+	return e
+}
+
+// After schedules fn to run delay after the current virtual time.
+func (s *Scheduler) After(delay time.Duration, fn func()) *Event {
+	return s.At(s.now+delay, fn)
+}
+
+// Every runs fn first after delay and then every interval after that.
+func (s *Scheduler) Every(first time.Duration, interval time.Duration, fn func()) *Ticker {
+	t := &Ticker{}
+
+	var tick func()
+	tick = func() {
+		if t.stopped {
+			return
+		}
+		fn()
+		if !t.stopped {
+			t.next = s.After(interval, tick)
+		}
+	}
+	t.next = s.After(first, tick)
+
+	return t
+}
+
+// AfterEvent registers fn to be called after every event, it is how
+// components that buffer work during an event (like the radio draining the
+// air) get a chance to schedule it.
+func (s *Scheduler) AfterEvent(fn func()) {
+	s.afterEvent = append(s.afterEvent, fn)
+}
+
+// Run processes events until the queue is empty, Stop is called or the next
+// event is after until. The clock is left at until so a later Run carries on
+// from there.
+func (s *Scheduler) Run(until time.Duration) {
+	s.stopped = false
+
+	for !s.stopped && s.queue.Len() > 0 {
+		if s.queue[0].at > until {
+			break
+		}
+
+		e := heap.Pop(&s.queue).(*Event)
+		if e.cancelled {
+			continue
+		}
+
+		s.now = e.at
+		e.fn()
+
+		for _, fn := range s.afterEvent {
+			fn()
+		}
+	}
+
+	if !s.stopped && s.now < until {
+		s.now = until
+	}
+}
+
+// Stop makes Run return once the current event has finished.
+func (s *Scheduler) Stop() {
+	s.stopped = true
+}
+
+// LogWriter prefixes every line written to w with the current virtual time,
+// use it with log.SetOutput and log.SetFlags(0) so traces are reproducible.
+func (s *Scheduler) LogWriter(w io.Writer) io.Writer {
+	return &logWriter{sched: s, w: w}
+}
+
+type logWriter struct {
+	sched *Scheduler
+	w     io.Writer
+}
+
+func (l *logWriter) Write(p []byte) (int, error) {
+	_, err := fmt.Fprintf(l.w, "[%12.6fs] %s", l.sched.now.Seconds(), p)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+type eventQueue []*Event
+
+func (q eventQueue) Len() int { return len(q) }
+
+func (q eventQueue) Less(i, j int) bool {
+	if q[i].at == q[j].at {
+		return q[i].seq < q[j].seq
+	}
+	return q[i].at < q[j].at
+}
+
+func (q eventQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *eventQueue) Push(x any) {
+	*q = append(*q, x.(*Event))
+}
+
+func (q *eventQueue) Pop() any {
+	old := *q
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+
+	return e
+}
@@ -0,0 +1,74 @@
+package sim
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+// trace schedules a batch of timers with random delays, some at the same
+// instant and some from inside other events, and returns the order they ran in
+func trace(seed int64) []string {
+	s := NewScheduler(seed)
+	var order []string
+
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("e%d", i)
+		delay := time.Duration(s.Rand.Intn(5)) * time.Second
+		s.After(delay, func() {
+			order = append(order, fmt.Sprintf("%s@%s", name, s.Elapsed()))
+			s.After(time.Duration(s.Rand.Intn(3))*time.Second, func() {
+				order = append(order, fmt.Sprintf("%s'@%s", name, s.Elapsed()))
+			})
+		})
+	}
+	s.Run(time.Minute)
+
+	return order
+}
+
+func TestSchedulerDeterminism(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b int64
+		same bool
+	}{
+		{"same seed", 1, 1, true},
+		{"another seed", 42, 42, true},
+		{"different seeds", 1, 2, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := trace(tt.a), trace(tt.b)
+			if len(a) != 40 || len(b) != 40 {
+				t.Fatalf("ran %d and %d events, want 40", len(a), len(b))
+			}
+			if slices.Equal(a, b) != tt.same {
+				t.Errorf("seeds %d and %d ran\n%v\n%v", tt.a, tt.b, a, b)
+			}
+		})
+	}
+}
+
+func TestSchedulerOrder(t *testing.T) {
+	s := NewScheduler(1)
+	var order []string
+
+	s.At(2*time.Second, func() { order = append(order, "late") })
+	s.At(time.Second, func() { order = append(order, "first") })
+	s.At(time.Second, func() { order = append(order, "second") })
+	cancelled := s.At(time.Second, func() { order = append(order, "cancelled") })
+	cancelled.Cancel()
+	s.At(3*time.Second, func() { order = append(order, "after until") })
+
+	s.Run(2500 * time.Millisecond)
+
+	if want := []string{"first", "second", "late"}; !slices.Equal(order, want) {
+		t.Errorf("ran %v, want %v", order, want)
+	}
+	if s.Elapsed() != 2500*time.Millisecond {
+		t.Errorf("clock at %s, want 2.5s", s.Elapsed())
+	}
+}
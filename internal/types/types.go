@@ -6,8 +6,15 @@ import (
 
 type DroneMessage struct {
 	Source         string         `json:"source"`
+	NextHop        string         `json:"next_hop,omitempty"` // link layer destination, empty is a broadcast
 	Type           string         `json:"type"`
 	AODVPayload    AODVMessage    `json:"aodv_payload"`
+	OLSRPayload    *OLSRMessage   `json:"olsr_payload,omitempty"`
+	DSRPayload     *DSRMessage    `json:"dsr_payload,omitempty"`
+	GPSRPayload    *GPSRMessage   `json:"gpsr_payload,omitempty"`
+	OGMPayload     *OGM           `json:"ogm_payload,omitempty"`
+	DTNPayload     *DTNMessage    `json:"dtn_payload,omitempty"`
+	GroupPayload   *GroupMessage  `json:"group_payload,omitempty"`
 	DataPayload    DataMessage    `json:"data_payload"`
 	ControlPayload ControlMessage `json:"control_payload"`
 }
@@ -17,6 +24,23 @@ type DataMessage struct {
 	RecipientID string `json:"recipient_id"`
 	SenderID    string `json:"sender_id"`
 	Data        []byte `json:"data"`
+	// DSR only, the route the packet follows from its sender, or from the
+	// drone that salvaged it, to its recipient and how often it was salvaged
+	SourceRoute []string `json:"source_route,omitempty"`
+	Salvage     int      `json:"salvage,omitempty"`
+	// GPSR only, where the packet is headed
+	Geo *GeoHeader `json:"geo,omitempty"`
+	// spray and wait only, how many copies the carrier may still hand out
+	Copies int `json:"copies,omitempty"`
+	// DTN only, when the sender handed the packet to its first carrier, the
+	// packet's lifetime counts from here whoever carries it
+	Created *time.Time `json:"created,omitempty"`
+	// multicast only, the group the packet is for, how many hops the drone
+	// that sent it on is from each member it knows of and how many more hops
+	// it may travel
+	Group      string         `json:"group,omitempty"`
+	MemberHops map[string]int `json:"member_hops,omitempty"`
+	TTL        int            `json:"ttl,omitempty"`
 }
 
 type AODVMessage struct {
@@ -31,6 +55,164 @@ type AODVMessage struct {
 	LifeTime               time.Duration `json:"lifetime"`
 	UnknownSequenceNum     bool          `json:"unknown_sequence_num"`
 	TTL                    int           `json:"ttl"`
+	// Metric is the ETX of the path from the advertised drone to the
+	// sender, only with ETX metrics
+	Metric float64 `json:"metric,omitempty"`
+	// LinkExpiration is how long the weakest link of that path is predicted
+	// to last as it is sent, zero if it isn't predicted to break, only with
+	// link expiration prediction
+	LinkExpiration time.Duration `json:"link_expiration,omitempty"`
+	// FirstHop is the drone after the advertised one on the path the RREQ or
+	// RREP came along, empty if the sender is that drone, only with
+	// multipath routing
+	FirstHop string `json:"first_hop,omitempty"`
+	// RREQ flags, G asks an intermediate node that answers to send the
+	// destination a gratuitous RREP, D only lets the destination answer
+	Gratuitous      bool `json:"gratuitous"`
+	DestinationOnly bool `json:"destination_only"`
+	// RREP flag, the receiver must answer with an RREP-ACK
+	AckRequired bool `json:"ack_required"`
+	// HELLO only, where the sender is, with link expiration prediction how
+	// it moves and, with ETX metrics, the share of each neighbour's HELLOs it
+	// receives
+	Position      *Position          `json:"position,omitempty"`
+	Velocity      *Velocity          `json:"velocity,omitempty"`
+	LinkQualities map[string]float64 `json:"link_qualities,omitempty"`
+	// RERR only, N reports routes that were repaired locally and got longer,
+	// they aren't to be deleted
+	UnreachableDestinations []UnreachableDestination `json:"unreachable_destinations,omitempty"`
+	NoDelete                bool                     `json:"no_delete,omitempty"`
+}
+
+type Position struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Velocity is in units per second
+type Velocity struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+type UnreachableDestination struct {
+	ID          string `json:"id"`
+	SequenceNum int    `json:"sequence_num"`
+}
+
+// OLSRMessage is an OLSR HELLO (type 1) or TC (type 2), RFC3626 section 3.3
+type OLSRMessage struct {
+	Type int `json:"olsr_type"`
+	// VTime is how long the receiver may keep the information
+	VTime          time.Duration `json:"vtime"`
+	OriginatorId   string        `json:"originator_id"`
+	TTL            int           `json:"ttl"`
+	HopCount       int           `json:"hop_count"`
+	SequenceNumber int           `json:"sequence_number"`
+	// HELLO only
+	Willingness int        `json:"willingness,omitempty"`
+	Links       []OLSRLink `json:"links,omitempty"`
+	// TC only, the advertised neighbour sequence number and the neighbours
+	// that picked the originator as their MPR
+	ANSN       int      `json:"ansn,omitempty"`
+	Advertised []string `json:"advertised,omitempty"`
+}
+
+// OLSRLink is a neighbour listed in a HELLO with the state of the link to it
+// and of the neighbour (RFC3626 6.1.1)
+type OLSRLink struct {
+	ID            string `json:"id"`
+	LinkType      int    `json:"link_type"`
+	NeighbourType int    `json:"neighbour_type"`
+}
+
+// DSRMessage is a DSR Route Request (type 1), Route Reply (type 2) or Route
+// Error (type 3), RFC4728 section 6
+type DSRMessage struct {
+	Type int `json:"dsr_type"`
+	// SourceRoute is the way a reply or error travels, the request is
+	// flooded instead
+	SourceRoute []string `json:"source_route,omitempty"`
+	// RREQ and RREP, the route from the originator as far as the request got
+	// or, in a reply, all the way to the target
+	Identification int      `json:"identification,omitempty"`
+	OriginatorId   string   `json:"originator_id,omitempty"`
+	Target         string   `json:"target,omitempty"`
+	Route          []string `json:"route,omitempty"`
+	TTL            int      `json:"ttl,omitempty"`
+	// RERR only, the link from ErrorSource to UnreachableNode is broken
+	ErrorSource     string `json:"error_source,omitempty"`
+	UnreachableNode string `json:"unreachable_node,omitempty"`
+}
+
+// GPSRMessage is a GPSR beacon (type 1), or a location query (type 2) or
+// reply (type 3) of the location service that goes with it
+type GPSRMessage struct {
+	Type int `json:"gpsr_type"`
+	// where the beacon's sender, the query's originator or the replying
+	// target is
+	Position     Position `json:"position"`
+	QueryID      int      `json:"query_id,omitempty"`
+	OriginatorId string   `json:"originator_id,omitempty"`
+	Target       string   `json:"target,omitempty"`
+	TTL          int      `json:"ttl,omitempty"`
+	// replies are routed geographically back to the querier
+	Geo *GeoHeader `json:"geo,omitempty"`
+}
+
+// GeoHeader carries the state GPSR forwards a message by (Karp and Kung,
+// GPSR, 2000), the drones along the way keep none
+type GeoHeader struct {
+	Destination Position `json:"destination"`
+	Perimeter   bool     `json:"perimeter"`
+	// perimeter mode only, where the message entered it, where it entered
+	// the current face and the first edge it took on that face
+	EnteredAt     Position `json:"entered_at"`
+	FaceAt        Position `json:"face_at"`
+	FirstEdgeFrom string   `json:"first_edge_from,omitempty"`
+	FirstEdgeTo   string   `json:"first_edge_to,omitempty"`
+	// the drone that sent it last and where it was
+	Previous         string   `json:"previous,omitempty"`
+	PreviousPosition Position `json:"previous_position"`
+	TTL              int      `json:"ttl"`
+}
+
+// OGM is a B.A.T.M.A.N. originator message, every drone floods one each
+// originator interval
+type OGM struct {
+	OriginatorId   string `json:"originator_id"`
+	SequenceNumber int    `json:"sequence_number"`
+	TTL            int    `json:"ttl"`
+	// the neighbour the rebroadcasting drone got the OGM from
+	PreviousSender string `json:"previous_sender"`
+	// DirectLink is set when a drone rebroadcasts the OGM of its neighbour,
+	// Unidirectional when it can hear that neighbour but not the other way
+	DirectLink     bool `json:"direct_link,omitempty"`
+	Unidirectional bool `json:"unidirectional,omitempty"`
+}
+
+// DTNMessage is a delay tolerant routing HELLO or the summary vector two
+// drones exchange when they meet
+type DTNMessage struct {
+	// 1 HELLO, 2 summary vector
+	Type int `json:"type"`
+	// the checksums of the packets the sender carries and of those it knows
+	// reached their recipient
+	Summary   []string `json:"summary,omitempty"`
+	Delivered []string `json:"delivered,omitempty"`
+	// PRoPHET only, how likely the sender is to meet each drone
+	Predictabilities map[string]float64 `json:"predictabilities,omitempty"`
+}
+
+// GroupMessage announces the multicast groups Member belongs to, none once
+// it has left them all. It is flooded so every drone learns how many hops
+// away each member is.
+type GroupMessage struct {
+	Member         string   `json:"member"`
+	Groups         []string `json:"groups,omitempty"`
+	SequenceNumber int      `json:"sequence_number"`
+	HopCount       int      `json:"hop_count"`
+	TTL            int      `json:"ttl"`
 }
 
 type ControlMessage struct {